@@ -19,6 +19,161 @@ type Credential struct {
 	ClientSecret string `yaml:"client_secret"`
 }
 
+// ModerationCategory 敏感词分类
+type ModerationCategory struct {
+	// 分类名称
+	Name string `yaml:"name"`
+	// 命中后的处理动作：block 拦截，mask 打码，warn 提醒，notify 通知管理员
+	Action string `yaml:"action"`
+	// 词库
+	Words []string `yaml:"words"`
+	// 从文件加载词库，每行一个词，# 开头为注释
+	WordFiles []string `yaml:"word_files"`
+}
+
+// Moderation 内容审核配置
+type Moderation struct {
+	// 敏感词分类
+	Categories []ModerationCategory `yaml:"categories"`
+	// 是否调用模型服务的内容审核接口
+	ApiOn bool `yaml:"api_on"`
+	// 审核接口命中后的处理动作，默认为 block
+	ApiAction string `yaml:"api_action"`
+}
+
+// SecretGuard 敏感信息扫描配置
+type SecretGuard struct {
+	// 是否开启
+	Enable bool `yaml:"enable"`
+	// 启用的检测器，留空则全部启用：api_key, token, private_key, id_card, phone, injection
+	Detectors []string `yaml:"detectors"`
+}
+
+// KnowledgeBase 知识库配置
+type KnowledgeBase struct {
+	// 是否开启
+	Enable bool `yaml:"enable"`
+	// 启动时导入的文档目录，支持 md、txt、docx、pdf 文件
+	Dir string `yaml:"dir"`
+	// 目录导入到的集合名称，默认为 default
+	Collection string `yaml:"collection"`
+	// 向量化模型，默认为 text-embedding-3-small
+	EmbeddingModel string `yaml:"embedding_model"`
+	// 片段长度（字符数），默认为 500
+	ChunkSize int `yaml:"chunk_size"`
+	// 相邻片段重叠的字符数，默认为 50
+	ChunkOverlap int `yaml:"chunk_overlap"`
+	// 每次检索注入的片段数，默认为 4
+	TopK int `yaml:"top_k"`
+	// 最低相似度，低于该值的片段不会注入，默认为 0.3
+	MinScore float64 `yaml:"min_score"`
+	// 哪些群组（ConversationID）的对话总是使用知识库回答
+	AlwaysGroups []string `yaml:"always_groups"`
+}
+
+// Voice 语音消息配置
+type Voice struct {
+	// 是否处理语音消息
+	Enable bool `yaml:"enable"`
+	// 钉钉没有返回识别结果时使用的语音转写模型，默认为 whisper-1
+	TranscribeModel string `yaml:"transcribe_model"`
+	// 是否同时以语音回复
+	Reply bool `yaml:"reply"`
+	// 语音合成模型，默认为 tts-1
+	TTSModel string `yaml:"tts_model"`
+	// 语音合成音色，默认为 alloy
+	TTSVoice string `yaml:"tts_voice"`
+	// 超过该字数的回答不合成语音，默认为 300
+	ReplyMaxChars int `yaml:"reply_max_chars"`
+}
+
+// Tools 工具调用配置
+type Tools struct {
+	// 是否允许模型在对话中调用工具
+	Enable bool `yaml:"enable"`
+	// 一次提问最多调用工具的轮数，默认为 5
+	MaxSteps int `yaml:"max_steps"`
+	// 禁用的工具名称
+	Disabled []string `yaml:"disabled"`
+}
+
+// Ops 运维工具配置
+type Ops struct {
+	// 总是允许探测的网段，可用于放行指定的内网地址
+	AllowNetworks []string `yaml:"allow_networks"`
+	// 禁止探测的网段，为空时默认禁止内网、回环、链路本地等地址
+	DenyNetworks []string `yaml:"deny_networks"`
+	// #dns 默认使用的 DNS 服务器，为空时使用系统解析器
+	DNSServer string `yaml:"dns_server"`
+	// #ip 查询 ASN 使用的本地数据库，iptoasn.com 的 ip2asn-combined.tsv 格式
+	ASNDB string `yaml:"asn_db"`
+}
+
+// Monitor 证书及域名到期监控配置
+type Monitor struct {
+	// 是否开启到期监控
+	Enable bool `yaml:"enable"`
+	// 每天检查的时间，格式为 HH:MM，默认为 09:30
+	CheckTime string `yaml:"check_time"`
+	// 证书剩余天数小于等于该值时告警，默认为 15
+	CertDays int `yaml:"cert_days"`
+	// 域名剩余天数小于等于该值时告警，默认为 30
+	DomainDays int `yaml:"domain_days"`
+	// 每个会话最多登记的监控数量，默认为 50
+	MaxWatches int `yaml:"max_watches"`
+}
+
+// Schedule 定时任务配置
+type Schedule struct {
+	// 是否开启定时任务
+	Enable bool `yaml:"enable"`
+	// 每个会话最多登记的定时任务数量，默认为 10
+	MaxJobs int `yaml:"max_jobs"`
+	// 服务停止期间错过的任务，在该时间（小时）内的启动后补发一次，更早的跳过，默认为 12
+	CatchUpHours int `yaml:"catch_up_hours"`
+}
+
+// GroupRecord 群消息记录配置
+type GroupRecord struct {
+	// 是否允许管理员在群里开启消息记录
+	Enable bool `yaml:"enable"`
+	// 每个群最多保留的消息数量，默认为 2000
+	MaxMessages int `yaml:"max_messages"`
+	// 消息保留的天数，默认为 7
+	RetentionDays int `yaml:"retention_days"`
+	// #总结 未指定条数时总结的消息数量，默认为 100
+	SummaryMessages int `yaml:"summary_messages"`
+}
+
+// Feedback 回答评价配置
+type Feedback struct {
+	// 评价周报的 cron 表达式，留空则不发送周报
+	ReportSpec string `yaml:"report_spec"`
+	// 周报中列出的差评回答数量，默认为 5
+	ReportLimit int `yaml:"report_limit"`
+}
+
+// Hook 接收外部告警的 Webhook，接口地址为 /hooks/<name>
+type Hook struct {
+	// 名称，只能使用字母、数字、下划线和中划线
+	Name string `yaml:"name"`
+	// 访问令牌，请求时通过 Authorization: Bearer <token> 请求头或 token 查询参数携带
+	Token string `yaml:"token"`
+	// 告警发送到的群，填写群的 openConversationId，在群里 @机器人 发送「群ID」后可在日志中查看
+	Group string `yaml:"group"`
+	// 发送消息使用的机器人，填写凭证的 client_id，留空时使用第一个凭证
+	RobotCode string `yaml:"robot_code"`
+	// 总结告警使用的提示词模板，留空时使用默认模板
+	Prompt string `yaml:"prompt"`
+}
+
+// Webhook 外部告警接入配置
+type Webhook struct {
+	// 相同告警在该时间（分钟）内只发送一次，默认为 10
+	DedupMinutes int    `yaml:"dedup_minutes"`
+	Hooks        []Hook `yaml:"hooks"`
+}
+
 // Configuration 项目配置
 type Configuration struct {
 	// 日志级别，info或者debug
@@ -33,6 +188,12 @@ type Configuration struct {
 	Model string `yaml:"model"`
 	// 使用绘画模型
 	ImageModel string `yaml:"image_model"`
+	// 识图模型，提问中带有图片时使用，留空则使用 model
+	VisionModel string `yaml:"vision_model"`
+	// #重来 时可以指定的模型，model 和 vision_model 总是可以指定
+	RetryModels []string `yaml:"retry_models"`
+	// 用户发送的图片保存的天数，过期后删除，默认3天
+	UploadRetentionDays int `yaml:"upload_retention_days"`
 	// 会话超时时间
 	SessionTimeout time.Duration `yaml:"session_timeout"`
 	// 最大问题长度
@@ -69,6 +230,28 @@ type Configuration struct {
 	AppSecrets []string `yaml:"app_secrets"`
 	// 敏感词，提问时触发，则不允许提问，回答的内容中触发，则以 🚫 代替
 	SensitiveWords []string `yaml:"sensitive_words"`
+	// 内容审核
+	Moderation Moderation `yaml:"moderation"`
+	// 敏感信息扫描
+	SecretGuard SecretGuard `yaml:"secret_guard"`
+	// 知识库
+	KnowledgeBase KnowledgeBase `yaml:"knowledge_base"`
+	// 语音消息
+	Voice Voice `yaml:"voice"`
+	// 工具调用
+	Tools Tools `yaml:"tools"`
+	// 运维工具
+	Ops Ops `yaml:"ops"`
+	// 到期监控
+	Monitor Monitor `yaml:"monitor"`
+	// 定时任务
+	Schedule Schedule `yaml:"schedule"`
+	// 群消息记录
+	GroupRecord GroupRecord `yaml:"group_record"`
+	// 回答评价
+	Feedback Feedback `yaml:"feedback"`
+	// 外部告警接入
+	Webhook Webhook `yaml:"webhook"`
 	// 自定义帮助信息
 	Help string `yaml:"help"`
 	// AzureOpenAI 配置
@@ -83,6 +266,10 @@ type Configuration struct {
 	StreamMode bool `yaml:"stream_mode"`
 	// 钉钉卡片模板ID(用于流式输出)
 	CardTemplateID string `yaml:"card_template_id"`
+	// 流式卡片是否带操作按钮，需要卡片模板中配置对应的按钮
+	CardActions bool `yaml:"card_actions"`
+	// 审计日志查询接口的访问令牌
+	AuditToken string `yaml:"audit_token"`
 }
 
 var (
@@ -125,6 +312,10 @@ func LoadConfig() *Configuration {
 		if model != "" {
 			config.Model = model
 		}
+		visionModel := os.Getenv("VISION_MODEL")
+		if visionModel != "" {
+			config.VisionModel = visionModel
+		}
 		sessionTimeout := os.Getenv("SESSION_TIMEOUT")
 		if sessionTimeout != "" {
 			duration, err := strconv.ParseInt(sessionTimeout, 10, 64)
@@ -233,6 +424,11 @@ func LoadConfig() *Configuration {
 			config.AzureOpenAIToken = azureOpenaiToken
 		}
 
+		auditToken := os.Getenv("AUDIT_TOKEN")
+		if auditToken != "" {
+			config.AuditToken = auditToken
+		}
+
 		credentials := os.Getenv("DINGTALK_CREDENTIALS")
 		if credentials != "" {
 			config.Credentials = []Credential{}
@@ -255,6 +451,12 @@ func LoadConfig() *Configuration {
 	if config.Model == "" {
 		config.Model = "gpt-3.5-turbo"
 	}
+	if config.VisionModel == "" {
+		config.VisionModel = config.Model
+	}
+	if config.UploadRetentionDays <= 0 {
+		config.UploadRetentionDays = 3
+	}
 	if config.DefaultMode == "" {
 		config.DefaultMode = "单聊"
 	}
@@ -278,5 +480,74 @@ func LoadConfig() *Configuration {
 	if config.MaxText == 0 {
 		config.MaxText = 4096
 	}
+	if config.Moderation.ApiAction == "" {
+		config.Moderation.ApiAction = "block"
+	}
+	if config.Voice.TranscribeModel == "" {
+		config.Voice.TranscribeModel = "whisper-1"
+	}
+	if config.Voice.TTSModel == "" {
+		config.Voice.TTSModel = "tts-1"
+	}
+	if config.Voice.TTSVoice == "" {
+		config.Voice.TTSVoice = "alloy"
+	}
+	if config.Voice.ReplyMaxChars == 0 {
+		config.Voice.ReplyMaxChars = 300
+	}
+	if config.KnowledgeBase.Collection == "" {
+		config.KnowledgeBase.Collection = "default"
+	}
+	if config.KnowledgeBase.EmbeddingModel == "" {
+		config.KnowledgeBase.EmbeddingModel = "text-embedding-3-small"
+	}
+	if config.KnowledgeBase.ChunkSize == 0 {
+		config.KnowledgeBase.ChunkSize = 500
+	}
+	if config.KnowledgeBase.ChunkOverlap == 0 {
+		config.KnowledgeBase.ChunkOverlap = 50
+	}
+	if config.KnowledgeBase.TopK == 0 {
+		config.KnowledgeBase.TopK = 4
+	}
+	if config.KnowledgeBase.MinScore == 0 {
+		config.KnowledgeBase.MinScore = 0.3
+	}
+	if config.Tools.MaxSteps == 0 {
+		config.Tools.MaxSteps = 5
+	}
+	if config.Monitor.CheckTime == "" {
+		config.Monitor.CheckTime = "09:30"
+	}
+	if config.Monitor.CertDays == 0 {
+		config.Monitor.CertDays = 15
+	}
+	if config.Monitor.DomainDays == 0 {
+		config.Monitor.DomainDays = 30
+	}
+	if config.Monitor.MaxWatches == 0 {
+		config.Monitor.MaxWatches = 50
+	}
+	if config.Schedule.MaxJobs == 0 {
+		config.Schedule.MaxJobs = 10
+	}
+	if config.Schedule.CatchUpHours == 0 {
+		config.Schedule.CatchUpHours = 12
+	}
+	if config.GroupRecord.MaxMessages == 0 {
+		config.GroupRecord.MaxMessages = 2000
+	}
+	if config.GroupRecord.RetentionDays == 0 {
+		config.GroupRecord.RetentionDays = 7
+	}
+	if config.GroupRecord.SummaryMessages == 0 {
+		config.GroupRecord.SummaryMessages = 100
+	}
+	if config.Feedback.ReportLimit == 0 {
+		config.Feedback.ReportLimit = 5
+	}
+	if config.Webhook.DedupMinutes == 0 {
+		config.Webhook.DedupMinutes = 10
+	}
 	return config
 }
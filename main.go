@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,8 +15,13 @@ import (
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/chatbot"
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/client"
 
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/hook"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/moderation"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/process"
 	"github.com/eryajf/chatgpt-dingtalk/public"
 )
@@ -22,8 +29,33 @@ import (
 func init() {
 	// 初始化加载配置，数据库，模板等
 	public.InitSvc()
+	// 开启后，提问与回答还会经过模型服务的内容审核接口
+	if public.Config.Moderation.ApiOn {
+		public.Moderator.SetRemote(moderation.RemoteFunc(llm.Moderate))
+	}
 	// 指定日志等级
 	logger.InitLogger(public.Config.LogLevel)
+	// 知识库使用模型服务的向量化接口，并在后台导入配置的文档目录
+	if public.KnowledgeBase != nil {
+		public.KnowledgeBase.SetEmbedder(kb.EmbedderFunc(llm.Embed))
+		go process.IngestKnowledgeDir()
+	}
+	// 命名话题的串聊上下文保存到数据库
+	llm.Store = process.ThreadStore()
+	// 注册模型可以调用的工具
+	process.InitTools()
+	// 每天定时检查证书及域名到期监控
+	go process.StartWatchScheduler()
+	// 每分钟检查到期的定时任务
+	go process.StartJobScheduler()
+	// 定时清理超过保留天数的群消息
+	go process.StartGroupRecordCleaner()
+	// 定时清理超过保存天数的图片
+	go process.StartUploadCleaner()
+	// 定时把回答评价报告发送给管理员
+	go process.StartFeedbackReporter()
+	// 外部告警接入
+	process.InitHooks()
 }
 
 func main() {
@@ -58,6 +90,10 @@ func StartStream(clientId, clientSecret string) {
 
 	//注册callback类型的处理函数
 	cli.RegisterChatBotCallbackRouter(receiver.OnChatBotMessageReceived)
+	// 回答卡片上的按钮回调
+	if public.Config.CardActions {
+		cli.RegisterCardCallbackRouter(process.OnCardCallback)
+	}
 
 	err := cli.Start(context.Background())
 	if err != nil {
@@ -88,6 +124,7 @@ func (r *ChatReceiver) OnChatBotMessageReceived(ctx context.Context, data *chatb
 		Text:                      dingbot.Text(data.Text),
 		RobotCode:                 r.clientId, // 使用 clientId 作为 RobotCode
 		Msgtype:                   dingbot.MsgType(data.Msgtype),
+		Content:                   dingbot.ParseContent(data.Content),
 	}
 	clientId := r.clientId
 	var c gin.Context
@@ -124,6 +161,94 @@ func StartHttp() {
 		c.Header("Content-Type", "application/octet-stream")
 		c.File("./data/chatHistory/" + filename)
 	})
+	// 查询审计日志，需要在请求头中携带 Authorization: Bearer <audit_token>
+	app.GET("/audit", func(c *gin.Context) {
+		if !public.CheckAuditToken(c.GetHeader("Authorization")) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "unauthorized",
+			})
+			return
+		}
+		var req db.AuditListReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		if req.Limit <= 0 {
+			req.Limit = 100
+		}
+		var audit db.Audit
+		audits, err := audit.List(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+			"data":   audits,
+		})
+	})
+	// 接收 Alertmanager、Grafana 等推送的告警，由模型总结后发送到配置的群
+	app.POST("/hooks/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("token")
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		post, err := public.Hooks.Handle(name, token, body)
+		switch {
+		case errors.Is(err, hook.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		case errors.Is(err, hook.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		if post == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "ok",
+				"message": "duplicate alert grouped",
+			})
+			return
+		}
+		// 模型总结耗时较长，异步发送，避免告警方请求超时后重试
+		go func() {
+			if err := public.Hooks.Deliver(post); err != nil {
+				logger.Warning(fmt.Errorf("deliver hook %s error: %v", name, err))
+			}
+		}()
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "ok",
+			"message": "accepted",
+		})
+	})
 	// 服务器健康检测
 	app.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -178,19 +303,27 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 		c.Set(public.DingTalkClientIdKeyName, clientId)
 	}
 	// 再校验回调参数是否有价值
-	if msgObj.Text.Content == "" || msgObj.ChatbotUserID == "" {
+	// 图文消息的文字部分作为提问内容
+	if msgObj.Msgtype == dingbot.RICHTEXT {
+		msgObj.Text.Content = msgObj.Content.RichTextContent()
+	}
+	// 语音消息优先使用钉钉的识别结果
+	voice := msgObj.Msgtype == dingbot.AUDIO && public.Config.Voice.Enable
+	if voice {
+		msgObj.Text.Content = msgObj.Content.Recognition
+	}
+	if (msgObj.Text.Content == "" && msgObj.Msgtype != dingbot.FILE && msgObj.Msgtype != dingbot.PICTURE && !voice) || msgObj.ChatbotUserID == "" {
 		logger.Warning("从钉钉回调过来的内容为空，根据过往的经验，或许重新创建一下机器人，能解决这个问题")
 		return
 	}
 	// 去除问题的前后空格
 	msgObj.Text.Content = strings.TrimSpace(msgObj.Text.Content)
-	if public.JudgeSensitiveWord(msgObj.Text.Content) {
-		logger.Info(fmt.Sprintf("🙋 %s提问的问题中包含敏感词汇，userid：%#v，消息: %#v", msgObj.SenderNick, msgObj.SenderStaffId, msgObj.Text.Content))
-		_, err := msgObj.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，您提问的问题中包含敏感词汇，请审核自己的对话内容之后再进行！**")
-		if err != nil {
-			logger.Warning(fmt.Errorf("send message error: %v", err))
-			return
-		}
+	// 开启了消息记录的群，未 @机器人 的消息只记录不回复
+	if process.RecordGroupMessage(&msgObj) {
+		return
+	}
+	// 内容审核，命中拦截规则时直接返回
+	if !process.ModerateQuestion(&msgObj) {
 		return
 	}
 	// 打印钉钉回调过来的请求明细，调试时打开
@@ -198,6 +331,7 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 
 	if public.Config.ChatType != "0" && msgObj.ConversationType != public.Config.ChatType {
 		logger.Info(fmt.Sprintf("🙋 %s使用了禁用的聊天方式", msgObj.SenderNick))
+		process.AddAudit(&msgObj, process.AuditActionChat, "", db.AuditDeny, "聊天方式被禁用")
 		_, err := msgObj.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，管理员禁用了这种聊天方式，请选择其他聊天方式与机器人对话！**")
 		if err != nil {
 			logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -219,6 +353,7 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 	// 不在允许群组，不在允许用户（包括在黑名单），满足任一条件，拒绝会话；管理员不受限制
 	if msgObj.ConversationType == "2" && !public.JudgeGroup(msgObj.ConversationID) && !public.JudgeAdminUsers(msgObj.SenderStaffId) && msgObj.SenderStaffId != "" {
 		logger.Info(fmt.Sprintf("🙋『%s』群组未被验证通过，群ID: %#v，userid：%#v, 昵称: %#v，消息: %#v", msgObj.ConversationTitle, msgObj.ConversationID, msgObj.SenderStaffId, msgObj.SenderNick, msgObj.Text.Content))
+		process.AddAudit(&msgObj, process.AuditActionChat, msgObj.ConversationID, db.AuditDeny, "群组未被认证")
 		_, err := msgObj.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，该群组未被认证通过，无法使用机器人对话功能。**\n>如需继续使用，请联系管理员申请访问权限。")
 		if err != nil {
 			logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -227,6 +362,7 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 		return
 	} else if !public.JudgeUsers(msgObj.SenderStaffId) && !public.JudgeAdminUsers(msgObj.SenderStaffId) && msgObj.SenderStaffId != "" {
 		logger.Info(fmt.Sprintf("🙋 %s身份信息未被验证通过，userid：%#v，消息: %#v", msgObj.SenderNick, msgObj.SenderStaffId, msgObj.Text.Content))
+		process.AddAudit(&msgObj, process.AuditActionChat, "", db.AuditDeny, "用户未被认证")
 		_, err := msgObj.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，您的身份信息未被认证通过，无法使用机器人对话功能。**\n>如需继续使用，请联系管理员申请访问权限。")
 		if err != nil {
 			logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -234,6 +370,30 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 		}
 		return
 	}
+	// 语音消息没有识别结果时，调用语音转写接口，转写结果同样需要经过内容审核
+	if voice && msgObj.Text.Content == "" {
+		if !process.TranscribeVoice(c, &msgObj) || !process.ModerateQuestion(&msgObj) {
+			return
+		}
+	}
+	// 文件消息导入知识库或者作为会话附件
+	if msgObj.Msgtype == dingbot.FILE {
+		logger.Info(fmt.Sprintf("🙋 %s发送了文件: %#v", msgObj.SenderNick, msgObj.Content.FileName))
+		err := process.ReceiveFile(c, &msgObj)
+		if err != nil {
+			logger.Warning(fmt.Errorf("process request: %v", err))
+		}
+		return
+	}
+	// 带有图片的消息交给识图模型处理
+	if len(msgObj.PictureCodes()) > 0 {
+		process.GuardQuestion(&msgObj)
+		err := process.ImageQuestion(c, &msgObj)
+		if err != nil {
+			logger.Warning(fmt.Errorf("process request: %v", err))
+		}
+		return
+	}
 	if len(msgObj.Text.Content) == 0 || msgObj.Text.Content == "帮助" {
 		// 欢迎信息
 		_, err := msgObj.ReplyToDingtalk(string(dingbot.MARKDOWN), public.Config.Help)
@@ -245,6 +405,14 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 		logger.Info(fmt.Sprintf("🙋 %s发起的问题: %#v", msgObj.SenderNick, msgObj.Text.Content))
 		// 除去帮助之外的逻辑分流在这里处理
 		switch {
+		case msgObj.Text.Content == "停止":
+			// 停止不调用模型，不计入请求次数，超过次数限制后也可以停止正在生成的回答
+			err := process.StopAnswer(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
 		case strings.HasPrefix(msgObj.Text.Content, "#图片"):
 			err := process.ImageGenerate(c, &msgObj)
 			if err != nil {
@@ -259,6 +427,49 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 				return
 			}
 			return
+		case strings.HasPrefix(msgObj.Text.Content, "#审计"):
+			err := process.SelectAudit(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#附件"):
+			err := process.ListAttachments(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#知识库列表"):
+			err := process.ListKnowledge(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#入库"):
+			err := process.PrepareIngest(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#删除文档"):
+			err := process.RemoveKnowledge(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#知识库"):
+			process.GuardQuestion(&msgObj)
+			err := process.KnowledgeQa(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
 		case strings.HasPrefix(msgObj.Text.Content, "#域名"):
 			err := process.DomainMsg(&msgObj)
 			if err != nil {
@@ -273,6 +484,148 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 				return
 			}
 			return
+		case strings.HasPrefix(msgObj.Text.Content, "#群记录"):
+			err := process.SwitchGroupRecord(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#总结"):
+			err := process.SummarizeGroup(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#新话题"):
+			err := process.NewThread(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#话题列表"):
+			err := process.ListThreads(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#切换"):
+			err := process.SwitchThread(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#删除话题"):
+			err := process.DeleteThread(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#重来"):
+			err := process.RetryAnswer(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#改"):
+			err := process.EditQuestion(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#反馈"):
+			err := process.Feedback(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#定时列表"):
+			err := process.ListJobs(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#删除定时"):
+			err := process.RemoveJob(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#定时"):
+			// 定时任务的内容会保存到数据库并在之后发给模型，先脱敏
+			process.GuardQuestion(&msgObj)
+			err := process.AddJob(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#监控列表"):
+			err := process.ListWatches(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#监控证书"):
+			err := process.AddWatch(&msgObj, db.WatchCert)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#监控域名"):
+			err := process.AddWatch(&msgObj, db.WatchDomain)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#取消监控"):
+			err := process.RemoveWatch(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#dns"):
+			err := process.DNSMsg(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#http"):
+			err := process.HTTPMsg(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#tcp"):
+			err := process.TCPMsg(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
+		case strings.HasPrefix(msgObj.Text.Content, "#ip"):
+			err := process.IPMsg(&msgObj)
+			if err != nil {
+				logger.Warning(fmt.Errorf("process request: %v", err))
+				return
+			}
+			return
 		default:
 			var err error
 			msgObj.Text.Content, err = process.GeneratePrompt(msgObj.Text.Content)
@@ -285,6 +638,8 @@ func DoRequest(msgObj dingbot.ReceiveMsg, c *gin.Context) {
 				}
 				return
 			}
+			// 发送给模型之前，对提问中的密钥、证件号等敏感信息脱敏
+			process.GuardQuestion(&msgObj)
 			err = process.ProcessRequest(&msgObj)
 			if err != nil {
 				logger.Warning(fmt.Errorf("process request: %v", err))
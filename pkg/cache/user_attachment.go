@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+)
+
+// Attachment 会话中上传的文档
+type Attachment struct {
+	Name string
+	// 提取出的文本
+	Text string
+	// 文档较长时建立的索引，提问时检索相关片段，为空时直接使用全文
+	Index   *kb.Index
+	AddedAt time.Time
+}
+
+// GetUserAttachments 获取用户会话中的文档
+func (s *UserService) GetUserAttachments(userId string) []Attachment {
+	attachments, ok := s.cache.Get(userId + "_attachments")
+	if !ok {
+		return nil
+	}
+	return attachments.([]Attachment)
+}
+
+// SetUserAttachments 设置用户会话中的文档，与会话同时过期
+func (s *UserService) SetUserAttachments(userId string, attachments []Attachment) {
+	s.cache.Set(userId+"_attachments", attachments, cache.DefaultExpiration)
+}
+
+// ClearUserAttachments 清空用户会话中的文档
+func (s *UserService) ClearUserAttachments(userId string) {
+	s.cache.Delete(userId + "_attachments")
+}
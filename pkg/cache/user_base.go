@@ -25,6 +25,14 @@ type UserServiceInterface interface {
 	SetAnswerID(userId, chattype string, current uint)
 	GetAnswerID(uerId, chattype string) uint
 	ClearAnswerID(userId, chattitle string)
+	// 用户待入库的知识库集合
+	SetIngestCollection(userId, collection string)
+	GetIngestCollection(userId string) string
+	ClearIngestCollection(userId string)
+	// 用户会话中的文档
+	GetUserAttachments(userId string) []Attachment
+	SetUserAttachments(userId string, attachments []Attachment)
+	ClearUserAttachments(userId string)
 }
 
 var _ UserServiceInterface = (*UserService)(nil)
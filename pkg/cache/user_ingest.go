@@ -0,0 +1,22 @@
+package cache
+
+import "time"
+
+// SetIngestCollection 设置用户下一个文件要导入的知识库集合，10分钟内有效
+func (s *UserService) SetIngestCollection(userId, collection string) {
+	s.cache.Set(userId+"_ingest", collection, time.Minute*10)
+}
+
+// GetIngestCollection 获取用户待导入的知识库集合
+func (s *UserService) GetIngestCollection(userId string) string {
+	collection, ok := s.cache.Get(userId + "_ingest")
+	if !ok {
+		return ""
+	}
+	return collection.(string)
+}
+
+// ClearIngestCollection 清除用户待导入的知识库集合
+func (s *UserService) ClearIngestCollection(userId string) {
+	s.cache.Delete(userId + "_ingest")
+}
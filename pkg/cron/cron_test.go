@@ -0,0 +1,73 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	// 2024-05-20 是星期一
+	from := time.Date(2024, 5, 20, 10, 30, 15, 0, loc)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 20, 10, 31, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2024, 5, 20, 10, 45, 0, 0, loc)},
+		{"0 9 * * 1", time.Date(2024, 5, 27, 9, 0, 0, 0, loc)},
+		{"0 17 * * fri", time.Date(2024, 5, 24, 17, 0, 0, 0, loc)},
+		{"30 9-18/3 * * mon-fri", time.Date(2024, 5, 20, 12, 30, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2024, 6, 1, 0, 0, 0, 0, loc)},
+		{"0 8 31 * *", time.Date(2024, 5, 31, 8, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		{"0 10 * * 0", time.Date(2024, 5, 26, 10, 0, 0, 0, loc)},
+		{"0 10 * * 7", time.Date(2024, 5, 26, 10, 0, 0, 0, loc)},
+		// 日期和星期都有限制时满足任一即可
+		{"0 10 1 * 3", time.Date(2024, 5, 22, 10, 0, 0, 0, loc)},
+		{"@daily", time.Date(2024, 5, 21, 0, 0, 0, 0, loc)},
+		{"@hourly", time.Date(2024, 5, 20, 11, 0, 0, 0, loc)},
+		{"0 9 1 jan,jul *", time.Date(2024, 7, 1, 9, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.spec, tt.want, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+	// 不存在的日期
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected zero time, got %v", next)
+	}
+}
+
+func TestSplitSpec(t *testing.T) {
+	tests := []struct {
+		text, spec, rest string
+	}{
+		{"0 9 * * 1 总结上周的 行业新闻", "0 9 * * 1", "总结上周的 行业新闻"},
+		{"@daily  早上好", "@daily", "早上好"},
+		{"0 9 * *", "0 9 * *", ""},
+	}
+	for _, tt := range tests {
+		spec, rest := SplitSpec(tt.text)
+		if spec != tt.spec || rest != tt.rest {
+			t.Errorf("%q: got %q %q", tt.text, spec, rest)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 审计结果
+const (
+	AuditAllow = "allow"
+	AuditDeny  = "deny"
+)
+
+// Audit 审计日志，只追加，不提供修改和删除
+type Audit struct {
+	gorm.Model
+	Actor    string `gorm:"type:varchar(50);comment:'操作人昵称'" json:"actor"`
+	ActorID  string `gorm:"type:varchar(64);index;comment:'操作人userid'" json:"actor_id"`
+	Action   string `gorm:"type:varchar(32);index;comment:'动作'" json:"action"`
+	Target   string `gorm:"type:varchar(128);comment:'操作对象'" json:"target"`
+	Decision string `gorm:"type:varchar(16);comment:'结果:allow, deny'" json:"decision"`
+	Reason   string `gorm:"type:varchar(255);comment:'原因'" json:"reason"`
+	Source   string `gorm:"type:varchar(50);comment:'来源：群聊名字，私聊'" json:"source"`
+}
+
+type AuditListReq struct {
+	Actor    string `json:"actor" form:"actor"`
+	Action   string `json:"action" form:"action"`
+	Decision string `json:"decision" form:"decision"`
+	Limit    int    `json:"limit" form:"limit"`
+}
+
+// Add 添加审计记录
+func (a Audit) Add() (uint, error) {
+	err := DB.Create(&a).Error
+	return a.ID, err
+}
+
+// List 获取审计记录，按时间倒序
+func (a Audit) List(req AuditListReq) ([]*Audit, error) {
+	var list []*Audit
+	db := DB.Model(&Audit{}).Order("created_at DESC")
+
+	actor := strings.TrimSpace(req.Actor)
+	if actor != "" {
+		db = db.Where("actor = ? OR actor_id = ?", actor, actor)
+	}
+	action := strings.TrimSpace(req.Action)
+	if action != "" {
+		db = db.Where("action = ?", action)
+	}
+	decision := strings.TrimSpace(req.Decision)
+	if decision != "" {
+		db = db.Where("decision = ?", decision)
+	}
+	if req.Limit > 0 {
+		db = db.Limit(req.Limit)
+	}
+
+	err := db.Find(&list).Error
+	return list, err
+}
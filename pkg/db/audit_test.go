@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB 使用内存数据库代替 DB
+func openTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个连接都是一个独立的内存数据库，只使用一个连接
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := conn.AutoMigrate(Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := DB
+	DB = conn
+	t.Cleanup(func() { DB = prev })
+}
+
+func TestAuditList_Filters(t *testing.T) {
+	openTestDB(t)
+	for _, a := range []Audit{
+		{Actor: "张三", ActorID: "u1", Action: "chat", Decision: AuditDeny},
+		{Actor: "张三", ActorID: "u1", Action: "history", Decision: AuditAllow},
+		{Actor: "李四", ActorID: "u2", Action: "history", Decision: AuditDeny},
+		{Actor: "李四", ActorID: "u2", Action: "chat", Decision: AuditAllow},
+	} {
+		if _, err := a.Add(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		req  AuditListReq
+		want int
+	}{
+		{"all", AuditListReq{}, 4},
+		{"actor by nick", AuditListReq{Actor: "张三"}, 2},
+		{"actor by userid", AuditListReq{Actor: " u2 "}, 2},
+		{"action", AuditListReq{Action: "history"}, 2},
+		{"decision", AuditListReq{Decision: AuditDeny}, 2},
+		{"combined", AuditListReq{Actor: "李四", Action: "history", Decision: AuditDeny}, 1},
+		{"no match", AuditListReq{Actor: "王五"}, 0},
+		{"limit", AuditListReq{Limit: 3}, 3},
+	}
+	for _, tt := range tests {
+		list, err := Audit{}.List(tt.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(list) != tt.want {
+			t.Errorf("%s: expected %d records, got %d", tt.name, tt.want, len(list))
+		}
+	}
+}
+
+func TestAuditList_NewestFirst(t *testing.T) {
+	openTestDB(t)
+	for _, target := range []string{"first", "second", "third"} {
+		if _, err := (Audit{Actor: "张三", Action: "chat", Target: target}).Add(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := Audit{}.List(AuditListReq{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Target != "third" || list[1].Target != "second" {
+		t.Errorf("expected the two newest records first, got %+v", list)
+	}
+}
@@ -12,13 +12,18 @@ type ChatType uint
 const Q ChatType = 1
 const A ChatType = 2
 
+// T 模型在回答过程中发起的工具调用
+const T ChatType = 3
+
 type Chat struct {
 	gorm.Model
-	Username      string   `gorm:"type:varchar(50);not null;comment:'用户名'" json:"username"`        // 用户名
-	Source        string   `gorm:"type:varchar(50);comment:'用户来源：群聊名字，私聊'" json:"source"`          // 对话来源
-	ChatType      ChatType `gorm:"type:tinyint(1);default:1;comment:'类型:1问, 2答'" json:"chat_type"` // 状态
+	Username      string   `gorm:"type:varchar(50);not null;comment:'用户名'" json:"username"`               // 用户名
+	Source        string   `gorm:"type:varchar(50);comment:'用户来源：群聊名字，私聊'" json:"source"`                 // 对话来源
+	ChatType      ChatType `gorm:"type:tinyint(1);default:1;comment:'类型:1问, 2答, 3工具调用'" json:"chat_type"` // 状态
 	ParentContent uint     `gorm:"default:0;comment:'父消息编号(编号为0时表示为首条)'" json:"parent_content"`
 	Content       string   `gorm:"type:varchar(128);comment:'内容'" json:"content"` // 问题或回答的内容
+	TrackID       string   `gorm:"type:varchar(64);index;comment:'回答卡片的追踪ID'" json:"track_id"`
+	ModelName     string   `gorm:"column:model;type:varchar(64);comment:'生成回答的模型'" json:"model"`
 }
 
 type ChatListReq struct {
@@ -37,6 +42,11 @@ func (c Chat) Find(filter map[string]interface{}, data *Chat) error {
 	return DB.Where(filter).First(&data).Error
 }
 
+// FindByTrackID 获取卡片中最新的一条回答
+func (c Chat) FindByTrackID(trackID string, data *Chat) error {
+	return DB.Where("track_id = ? AND chat_type = ?", trackID, A).Order("id DESC").First(data).Error
+}
+
 // List 获取数据列表
 func (c Chat) List(req ChatListReq) ([]*Chat, error) {
 	var list []*Chat
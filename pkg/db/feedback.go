@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 评分
+const (
+	FeedbackGood = 1
+	FeedbackBad  = -1
+)
+
+// Feedback 用户对回答的评价，每个用户对同一条回答只保留最后一次评价
+type Feedback struct {
+	gorm.Model
+	ChatID    uint   `gorm:"index;comment:'回答的对话记录编号'" json:"chat_id"`
+	UserID    string `gorm:"type:varchar(64);comment:'评价人userid'" json:"user_id"`
+	Username  string `gorm:"type:varchar(50);comment:'评价人昵称'" json:"username"`
+	Source    string `gorm:"type:varchar(50);comment:'来源：群聊名字，私聊'" json:"source"`
+	ModelName string `gorm:"column:model;type:varchar(64);comment:'回答使用的模型'" json:"model"`
+	Template  string `gorm:"type:varchar(64);comment:'提问使用的提示词模板'" json:"template"`
+	Rating    int    `gorm:"comment:'评分:1好, -1差'" json:"rating"`
+	Reason    string `gorm:"type:varchar(255);comment:'原因'" json:"reason"`
+}
+
+// Save 保存评价，同一用户重复评价时覆盖之前的评价
+func (f Feedback) Save() error {
+	var old Feedback
+	err := DB.Where("chat_id = ? AND user_id = ?", f.ChatID, f.UserID).First(&old).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DB.Create(&f).Error
+	}
+	if err != nil {
+		return err
+	}
+	return DB.Model(&old).Updates(map[string]interface{}{
+		"rating":   f.Rating,
+		"reason":   f.Reason,
+		"username": f.Username,
+	}).Error
+}
+
+// FeedbackStat 评价统计
+type FeedbackStat struct {
+	Name string `json:"name"`
+	Good int    `json:"good"`
+	Bad  int    `json:"bad"`
+}
+
+// FeedbackAnswer 一条回答的评价汇总
+type FeedbackAnswer struct {
+	ChatID   uint   `json:"chat_id"`
+	Source   string `json:"source"`
+	Template string `json:"template"`
+	Good     int    `json:"good"`
+	Bad      int    `json:"bad"`
+	Reason   string `json:"reason"`
+}
+
+const feedbackCount = "SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END) AS good, SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END) AS bad"
+
+// Stats 按模型(model)、模板(template)或来源(source)统计 since 之后的评价，差评多的排在前面
+func (f Feedback) Stats(column string, since time.Time) ([]FeedbackStat, error) {
+	switch column {
+	case "model", "template", "source":
+	default:
+		return nil, fmt.Errorf("unsupported column %q", column)
+	}
+	var list []FeedbackStat
+	err := DB.Model(&Feedback{}).
+		Select(column+" AS name, "+feedbackCount).
+		Where("updated_at >= ?", since).
+		Group(column).
+		Order("bad DESC, good ASC").
+		Scan(&list).Error
+	return list, err
+}
+
+// WorstAnswers 返回 since 之后差评最多的回答
+func (f Feedback) WorstAnswers(since time.Time, limit int) ([]FeedbackAnswer, error) {
+	var list []FeedbackAnswer
+	err := DB.Model(&Feedback{}).
+		Select("chat_id, MAX(source) AS source, MAX(template) AS template, MAX(reason) AS reason, "+feedbackCount).
+		Where("updated_at >= ?", since).
+		Group("chat_id").
+		Having("SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END) > 0").
+		Order("bad DESC, good ASC").
+		Limit(limit).
+		Scan(&list).Error
+	return list, err
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job 定时任务，按 cron 表达式定时向模型提问，并把回答发送到登记时的会话
+type Job struct {
+	gorm.Model
+	Spec              string    `gorm:"type:varchar(64);comment:'cron 表达式'" json:"spec"`
+	Prompt            string    `gorm:"type:text;comment:'提问内容'" json:"prompt"`
+	ConversationType  string    `gorm:"type:varchar(4);comment:'会话类型:1单聊, 2群聊'" json:"conversation_type"`
+	ConversationID    string    `gorm:"type:varchar(128);index;comment:'会话ID'" json:"conversation_id"`
+	ConversationTitle string    `gorm:"type:varchar(128);comment:'群聊名字'" json:"conversation_title"`
+	RobotCode         string    `gorm:"type:varchar(128);comment:'机器人编码'" json:"robot_code"`
+	UserID            string    `gorm:"type:varchar(64);comment:'登记人userid，单聊时发送给该用户'" json:"user_id"`
+	Creator           string    `gorm:"type:varchar(50);comment:'登记人昵称'" json:"creator"`
+	NextRunAt         time.Time `gorm:"index;comment:'下一次执行时间'" json:"next_run_at"`
+	LastRunAt         time.Time `gorm:"comment:'最近一次执行时间'" json:"last_run_at"`
+	LastError         string    `gorm:"type:varchar(255);comment:'最近一次执行的错误'" json:"last_error"`
+}
+
+type JobListReq struct {
+	ConversationID string    `json:"conversation_id" form:"conversation_id"`
+	DueBefore      time.Time `json:"due_before" form:"due_before"`
+}
+
+// Add 添加定时任务
+func (j Job) Add() (uint, error) {
+	err := DB.Create(&j).Error
+	return j.ID, err
+}
+
+// List 获取定时任务列表，按登记时间排序
+func (j Job) List(req JobListReq) ([]*Job, error) {
+	var list []*Job
+	db := DB.Model(&Job{}).Order("created_at ASC")
+
+	conversationID := strings.TrimSpace(req.ConversationID)
+	if conversationID != "" {
+		db = db.Where("conversation_id = ?", conversationID)
+	}
+	if !req.DueBefore.IsZero() {
+		db = db.Where("next_run_at <= ?", req.DueBefore)
+	}
+
+	err := db.Find(&list).Error
+	return list, err
+}
+
+// Delete 删除定时任务
+func (j Job) Delete(ids []uint) error {
+	return DB.Delete(&Job{}, ids).Error
+}
+
+// UpdateNextRun 更新下一次执行时间，执行前先更新，避免重复执行
+func (j Job) UpdateNextRun(next time.Time) error {
+	return DB.Model(&Job{}).Where("id = ?", j.ID).Update("next_run_at", next).Error
+}
+
+// UpdateResult 保存执行结果
+func (j Job) UpdateResult(lastError string) error {
+	return DB.Model(&Job{}).Where("id = ?", j.ID).Updates(map[string]interface{}{
+		"last_run_at": time.Now(),
+		"last_error":  lastError,
+	}).Error
+}
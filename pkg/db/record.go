@@ -0,0 +1,84 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecordGroup 开启了群消息记录的群
+type RecordGroup struct {
+	gorm.Model
+	ConversationID    string `gorm:"type:varchar(128);uniqueIndex;comment:'会话ID'" json:"conversation_id"`
+	ConversationTitle string `gorm:"type:varchar(128);comment:'群聊名字'" json:"conversation_title"`
+	Operator          string `gorm:"type:varchar(50);comment:'开启人昵称'" json:"operator"`
+}
+
+// GroupMessage 记录的群消息，用于 #总结
+type GroupMessage struct {
+	gorm.Model
+	ConversationID string `gorm:"type:varchar(128);index;comment:'会话ID'" json:"conversation_id"`
+	SenderNick     string `gorm:"type:varchar(50);comment:'发送人昵称'" json:"sender_nick"`
+	SenderStaffId  string `gorm:"type:varchar(64);comment:'发送人userid'" json:"sender_staff_id"`
+	Content        string `gorm:"type:text;comment:'消息内容'" json:"content"`
+}
+
+// Add 开启群消息记录
+func (r RecordGroup) Add() error {
+	return DB.Create(&r).Error
+}
+
+// Exist 判断群是否开启了消息记录
+func (r RecordGroup) Exist(conversationID string) bool {
+	var dataObj RecordGroup
+	err := DB.Where("conversation_id = ?", conversationID).First(&dataObj).Error
+	return !errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// Delete 关闭群消息记录，同时删除已经记录的消息
+func (r RecordGroup) Delete(conversationID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("conversation_id = ?", conversationID).Delete(&RecordGroup{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("conversation_id = ?", conversationID).Delete(&GroupMessage{}).Error
+	})
+}
+
+// Add 记录一条群消息
+func (m GroupMessage) Add() error {
+	return DB.Create(&m).Error
+}
+
+// List 获取群里 since 之后最近的 limit 条消息，按时间先后排序
+func (m GroupMessage) List(conversationID string, since time.Time, limit int) ([]*GroupMessage, error) {
+	var list []*GroupMessage
+	db := DB.Model(&GroupMessage{}).Where("conversation_id = ?", conversationID)
+	if !since.IsZero() {
+		db = db.Where("created_at >= ?", since)
+	}
+	if err := db.Order("id DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list, nil
+}
+
+// Trim 每个群只保留最近的 keep 条消息
+func (m GroupMessage) Trim(conversationID string, keep int) error {
+	var ids []uint
+	err := DB.Model(&GroupMessage{}).Where("conversation_id = ?", conversationID).
+		Order("id DESC").Offset(keep).Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return DB.Unscoped().Where("conversation_id = ? AND id <= ?", conversationID, ids[0]).Delete(&GroupMessage{}).Error
+}
+
+// PurgeBefore 删除 before 之前记录的消息
+func (m GroupMessage) PurgeBefore(before time.Time) error {
+	return DB.Unscoped().Where("created_at < ?", before).Delete(&GroupMessage{}).Error
+}
@@ -23,6 +23,13 @@ func InitDB() {
 func dbAutoMigrate() {
 	_ = DB.AutoMigrate(
 		Chat{},
+		Audit{},
+		Watch{},
+		Job{},
+		RecordGroup{},
+		GroupMessage{},
+		Feedback{},
+		Thread{},
 	)
 }
 
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Thread 用户的串聊话题，Name 为空的是默认话题
+type Thread struct {
+	gorm.Model
+	UserID         string    `gorm:"type:varchar(64);index;comment:'用户标识'" json:"user_id"`
+	Name           string    `gorm:"type:varchar(64);comment:'话题名称'" json:"name"`
+	Title          string    `gorm:"type:varchar(128);comment:'模型生成的标题'" json:"title"`
+	TitleRequested bool      `gorm:"default:false;comment:'是否已经请求生成标题'" json:"-"`
+	Context        string    `gorm:"type:text;comment:'对话上下文(base64)'" json:"-"`
+	Current        bool      `gorm:"column:is_current;comment:'是否为当前话题'" json:"current"`
+	LastUsedAt     time.Time `gorm:"comment:'最后使用时间'" json:"last_used_at"`
+}
+
+// Add 新建话题
+func (t Thread) Add() (uint, error) {
+	err := DB.Create(&t).Error
+	return t.ID, err
+}
+
+// Find 获取用户的指定话题，不存在时返回 nil
+func (t Thread) Find(userID, name string) (*Thread, error) {
+	var data Thread
+	err := DB.Where("user_id = ? AND name = ?", userID, name).First(&data).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &data, err
+}
+
+// FindCurrent 获取用户的当前话题，没有时返回 nil，表示使用默认话题
+func (t Thread) FindCurrent(userID string) (*Thread, error) {
+	var data Thread
+	err := DB.Where("user_id = ? AND is_current = ?", userID, true).First(&data).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &data, err
+}
+
+// List 获取用户的全部话题，最近使用的排在前面
+func (t Thread) List(userID string) ([]*Thread, error) {
+	var list []*Thread
+	err := DB.Where("user_id = ?", userID).Order("last_used_at DESC").Find(&list).Error
+	return list, err
+}
+
+// SetCurrent 把 id 设为用户的当前话题，id 为 0 时回到默认话题
+func (t Thread) SetCurrent(userID string, id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Thread{}).Where("user_id = ? AND is_current = ?", userID, true).Update("is_current", false).Error; err != nil {
+			return err
+		}
+		if id == 0 {
+			return nil
+		}
+		return tx.Model(&Thread{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"is_current":   true,
+			"last_used_at": time.Now(),
+		}).Error
+	})
+}
+
+// UpdateContext 保存话题的对话上下文并更新最后使用时间
+func (t Thread) UpdateContext(context string) error {
+	return DB.Model(&Thread{}).Where("id = ?", t.ID).Updates(map[string]interface{}{
+		"context":      context,
+		"last_used_at": time.Now(),
+	}).Error
+}
+
+// ClaimTitle 标记话题已经请求生成标题，只有第一次标记成功时返回 true
+func (t Thread) ClaimTitle() (bool, error) {
+	rst := DB.Model(&Thread{}).Where("id = ? AND title_requested = ?", t.ID, false).Update("title_requested", true)
+	return rst.RowsAffected == 1, rst.Error
+}
+
+// UpdateTitle 更新话题标题
+func (t Thread) UpdateTitle(title string) error {
+	return DB.Model(&Thread{}).Where("id = ?", t.ID).Update("title", title).Error
+}
+
+// Delete 删除话题
+func (t Thread) Delete() error {
+	return DB.Unscoped().Delete(&Thread{}, t.ID).Error
+}
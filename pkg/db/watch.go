@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 监控类型
+const (
+	WatchCert   = "cert"
+	WatchDomain = "domain"
+)
+
+// Watch 证书及域名到期监控，按会话（群聊或单聊）登记，告警发送到登记时的会话
+type Watch struct {
+	gorm.Model
+	Kind              string    `gorm:"type:varchar(16);index;comment:'类型:cert, domain'" json:"kind"`
+	Target            string    `gorm:"type:varchar(255);comment:'监控的域名或地址'" json:"target"`
+	ConversationType  string    `gorm:"type:varchar(4);comment:'会话类型:1单聊, 2群聊'" json:"conversation_type"`
+	ConversationID    string    `gorm:"type:varchar(128);index;comment:'会话ID'" json:"conversation_id"`
+	ConversationTitle string    `gorm:"type:varchar(128);comment:'群聊名字'" json:"conversation_title"`
+	RobotCode         string    `gorm:"type:varchar(128);comment:'机器人编码'" json:"robot_code"`
+	UserID            string    `gorm:"type:varchar(64);comment:'登记人userid，单聊告警发送给该用户'" json:"user_id"`
+	Creator           string    `gorm:"type:varchar(50);comment:'登记人昵称'" json:"creator"`
+	ExpireAt          time.Time `gorm:"comment:'最近一次检查得到的到期时间'" json:"expire_at"`
+	CheckedAt         time.Time `gorm:"comment:'最近一次检查时间'" json:"checked_at"`
+	LastError         string    `gorm:"type:varchar(255);comment:'最近一次检查的错误'" json:"last_error"`
+}
+
+type WatchListReq struct {
+	Kind           string `json:"kind" form:"kind"`
+	ConversationID string `json:"conversation_id" form:"conversation_id"`
+	Target         string `json:"target" form:"target"`
+}
+
+// Add 添加监控
+func (w Watch) Add() (uint, error) {
+	err := DB.Create(&w).Error
+	return w.ID, err
+}
+
+// Find 获取单个监控
+func (w Watch) Find(filter map[string]interface{}, data *Watch) error {
+	return DB.Where(filter).First(data).Error
+}
+
+// List 获取监控列表，按登记时间排序
+func (w Watch) List(req WatchListReq) ([]*Watch, error) {
+	var list []*Watch
+	db := DB.Model(&Watch{}).Order("created_at ASC")
+
+	kind := strings.TrimSpace(req.Kind)
+	if kind != "" {
+		db = db.Where("kind = ?", kind)
+	}
+	conversationID := strings.TrimSpace(req.ConversationID)
+	if conversationID != "" {
+		db = db.Where("conversation_id = ?", conversationID)
+	}
+	target := strings.TrimSpace(req.Target)
+	if target != "" {
+		db = db.Where("target = ?", target)
+	}
+
+	err := db.Find(&list).Error
+	return list, err
+}
+
+// Exist 判断监控是否存在
+func (w Watch) Exist(filter map[string]interface{}) bool {
+	var dataObj Watch
+	err := DB.Where(filter).First(&dataObj).Error
+	return !errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// Delete 删除监控
+func (w Watch) Delete(ids []uint) error {
+	return DB.Delete(&Watch{}, ids).Error
+}
+
+// UpdateResult 保存检查结果
+func (w Watch) UpdateResult(expireAt time.Time, lastError string) error {
+	return DB.Model(&Watch{}).Where("id = ?", w.ID).Updates(map[string]interface{}{
+		"expire_at":  expireAt,
+		"checked_at": time.Now(),
+		"last_error": lastError,
+	}).Error
+}
@@ -0,0 +1,142 @@
+package dingbot
+
+import (
+	"sync"
+	"time"
+)
+
+// CardUpdateFunc 执行一次卡片流式更新
+type CardUpdateFunc func(req *StreamingUpdateRequest) error
+
+// 卡片更新的默认参数
+var (
+	// CardUpdateInterval 两次更新之间的最小间隔，间隔内的多次更新会合并为最新的一次
+	CardUpdateInterval = 300 * time.Millisecond
+	// CardUpdateBackoff 更新失败后第一次重试的等待时间，之后每次翻倍
+	CardUpdateBackoff = 200 * time.Millisecond
+)
+
+const (
+	// cardUpdateRetries 中间更新失败后的重试次数，有更新的内容时不再重试
+	cardUpdateRetries = 2
+	// cardFinalRetries 最后一次更新失败后的重试次数
+	cardFinalRetries = 5
+)
+
+// CardUpdater 单张流式卡片的更新协程：按最小间隔合并更新，失败时退避重试，保证最后一次更新一定会发出
+type CardUpdater struct {
+	trackID  string
+	update   CardUpdateFunc
+	interval time.Duration
+	backoff  time.Duration
+
+	mu      sync.Mutex
+	pending *StreamingUpdateRequest
+	closed  bool
+	err     error
+
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// NewCardUpdater 创建卡片的更新协程，update 为实际调用卡片接口的函数
+func NewCardUpdater(trackID string, update CardUpdateFunc) *CardUpdater {
+	u := &CardUpdater{
+		trackID:  trackID,
+		update:   update,
+		interval: CardUpdateInterval,
+		backoff:  CardUpdateBackoff,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go u.run()
+	return u
+}
+
+// Update 更新卡片内容，不会阻塞，还没有发出的旧内容会被丢弃
+func (u *CardUpdater) Update(content string) {
+	u.push(&StreamingUpdateRequest{Content: content})
+}
+
+// Finish 以 content 完成卡片，等待所有更新结束，返回最后一次更新的错误
+func (u *CardUpdater) Finish(content string) error {
+	u.push(&StreamingUpdateRequest{Content: content, IsFinalize: true})
+	return u.wait()
+}
+
+// Fail 以 content 完成卡片并标记为出错，等待所有更新结束，返回最后一次更新的错误
+func (u *CardUpdater) Fail(content string) error {
+	u.push(&StreamingUpdateRequest{Content: content, IsFinalize: true, IsError: true})
+	return u.wait()
+}
+
+func (u *CardUpdater) push(req *StreamingUpdateRequest) {
+	req.OutTrackID = u.trackID
+	req.Key = "content"
+	req.IsFull = true
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return
+	}
+	u.pending = req
+	u.closed = req.IsFinalize
+	u.mu.Unlock()
+	select {
+	case u.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (u *CardUpdater) wait() error {
+	<-u.done
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.err
+}
+
+func (u *CardUpdater) run() {
+	defer close(u.done)
+	for range u.notify {
+		u.mu.Lock()
+		req := u.pending
+		u.pending = nil
+		u.mu.Unlock()
+		if req == nil {
+			continue
+		}
+		err := u.send(req)
+		u.mu.Lock()
+		u.err = err
+		u.mu.Unlock()
+		if req.IsFinalize {
+			return
+		}
+		time.Sleep(u.interval)
+	}
+}
+
+// send 发送一次更新，失败时退避重试；中间更新在有更新的内容待发送时放弃重试
+func (u *CardUpdater) send(req *StreamingUpdateRequest) error {
+	retries := cardUpdateRetries
+	if req.IsFinalize {
+		retries = cardFinalRetries
+	}
+	backoff := u.backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = u.update(req); err == nil || attempt >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if !req.IsFinalize {
+			u.mu.Lock()
+			superseded := u.pending != nil
+			u.mu.Unlock()
+			if superseded {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dingbot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCardAPI 记录收到的卡片更新，前 failures 次调用返回错误
+type fakeCardAPI struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	updates  []StreamingUpdateRequest
+}
+
+func (f *fakeCardAPI) update(req *StreamingUpdateRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("card api unavailable")
+	}
+	f.updates = append(f.updates, *req)
+	return nil
+}
+
+func newTestCardUpdater(api *fakeCardAPI) *CardUpdater {
+	u := NewCardUpdater("track-1", api.update)
+	u.interval = 20 * time.Millisecond
+	u.backoff = time.Millisecond
+	return u
+}
+
+func TestCardUpdater_Coalesce(t *testing.T) {
+	api := &fakeCardAPI{}
+	u := newTestCardUpdater(api)
+	for i := 1; i <= 100; i++ {
+		u.Update(fmt.Sprintf("content %d", i))
+	}
+	if err := u.Finish("final"); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.updates) >= 100 {
+		t.Errorf("expected updates to be coalesced, got %d", len(api.updates))
+	}
+	last := api.updates[len(api.updates)-1]
+	if last.Content != "final" || !last.IsFinalize || last.IsError {
+		t.Errorf("unexpected final update %+v", last)
+	}
+	for _, up := range api.updates {
+		if up.OutTrackID != "track-1" || up.Key != "content" || !up.IsFull {
+			t.Errorf("unexpected update %+v", up)
+		}
+	}
+	// 完成之后的更新会被忽略
+	n := len(api.updates)
+	u.Update("after")
+	time.Sleep(50 * time.Millisecond)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.updates) != n {
+		t.Errorf("update after finish should be ignored, got %+v", api.updates[n:])
+	}
+}
+
+func TestCardUpdater_RetryFinal(t *testing.T) {
+	api := &fakeCardAPI{failures: 3}
+	u := newTestCardUpdater(api)
+	if err := u.Finish("done"); err != nil {
+		t.Fatalf("expected final update to succeed after retries, got %v", err)
+	}
+	if api.calls != 4 || len(api.updates) != 1 || !api.updates[0].IsFinalize {
+		t.Errorf("expected 4 calls and 1 final update, got %d calls, %+v", api.calls, api.updates)
+	}
+}
+
+func TestCardUpdater_GiveUp(t *testing.T) {
+	api := &fakeCardAPI{failures: 100}
+	u := newTestCardUpdater(api)
+	if err := u.Finish("done"); err == nil {
+		t.Fatal("expected error")
+	}
+	if api.calls != cardFinalRetries+1 {
+		t.Errorf("expected %d calls, got %d", cardFinalRetries+1, api.calls)
+	}
+}
+
+func TestCardUpdater_Fail(t *testing.T) {
+	api := &fakeCardAPI{}
+	u := newTestCardUpdater(api)
+	u.Update("partial")
+	if err := u.Fail("出错了"); err != nil {
+		t.Fatal(err)
+	}
+	last := api.updates[len(api.updates)-1]
+	if last.Content != "出错了" || !last.IsFinalize || !last.IsError {
+		t.Errorf("unexpected final update %+v", last)
+	}
+	// 重复完成只会发送一次
+	if err := u.Finish("again"); err != nil {
+		t.Fatal(err)
+	}
+	if api.updates[len(api.updates)-1].Content != "出错了" {
+		t.Errorf("second finish should be ignored")
+	}
+}
@@ -0,0 +1,85 @@
+package dingbot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ChunkStream 把流式内容按段落分批发送：累计超过 minRunes 后在代码块之外的空行处切分，
+// 超过 maxRunes 仍没有段落边界时在最后一个换行处强制切分，切在代码块中时补全代码块标记。
+// send 返回错误后不再发送，但会继续读完 contentCh，返回完整内容及第一次发送的错误
+func ChunkStream(contentCh <-chan string, minRunes, maxRunes int, send func(chunk string) error) (string, error) {
+	var full, buf strings.Builder
+	var sendErr error
+	emit := func(chunk string) {
+		chunk = strings.TrimSpace(chunk)
+		if chunk == "" || sendErr != nil {
+			return
+		}
+		sendErr = send(chunk)
+	}
+	for content := range contentCh {
+		full.WriteString(content)
+		buf.WriteString(content)
+		for {
+			chunk, rest, ok := splitChunk(buf.String(), minRunes, maxRunes)
+			if !ok {
+				break
+			}
+			emit(chunk)
+			buf.Reset()
+			buf.WriteString(rest)
+		}
+	}
+	emit(buf.String())
+	return full.String(), sendErr
+}
+
+// splitChunk 从 buf 中切出一段可以发送的内容
+func splitChunk(buf string, minRunes, maxRunes int) (chunk, rest string, ok bool) {
+	inFence := false
+	// lastNewline 最后一个完整行的结尾，lastFence 为该处是否在代码块中
+	lastNewline, lastFence := -1, false
+	for pos := 0; pos < len(buf); {
+		nl := strings.IndexByte(buf[pos:], '\n')
+		if nl < 0 {
+			break
+		}
+		line := strings.TrimSpace(buf[pos : pos+nl])
+		pos += nl + 1
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+		}
+		if line == "" && !inFence && utf8.RuneCountInString(buf[:pos]) >= minRunes {
+			return buf[:pos], buf[pos:], true
+		}
+		lastNewline, lastFence = pos, inFence
+	}
+	if maxRunes <= 0 || utf8.RuneCountInString(buf) <= maxRunes || lastNewline <= 0 {
+		return "", buf, false
+	}
+	chunk, rest = buf[:lastNewline], buf[lastNewline:]
+	if lastFence {
+		// 代码块被切开时，前一段补上结束标记，后一段重新打开代码块
+		fence := fenceOpening(chunk)
+		chunk += "```"
+		rest = fence + "\n" + rest
+	}
+	return chunk, rest, true
+}
+
+// fenceOpening 返回内容中最后一个未闭合代码块的开始标记，保留语言标识
+func fenceOpening(s string) string {
+	opening := "```"
+	inFence := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+			if inFence {
+				opening = line
+			}
+		}
+	}
+	return opening
+}
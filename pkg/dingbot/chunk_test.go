@@ -0,0 +1,98 @@
+package dingbot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeStream 按固定长度把文本切成流式分片
+func fakeStream(text string, size int) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		runes := []rune(text)
+		for i := 0; i < len(runes); i += size {
+			end := i + size
+			if end > len(runes) {
+				end = len(runes)
+			}
+			ch <- string(runes[i:end])
+		}
+	}()
+	return ch
+}
+
+func TestChunkStream_Paragraphs(t *testing.T) {
+	text := "第一段内容比较长，需要单独发送。\n\n短。\n\n第三段也足够长，可以单独发送。\n\n结尾"
+	var chunks []string
+	full, err := ChunkStream(fakeStream(text, 3), 10, 0, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full != text {
+		t.Errorf("expected full content %q, got %q", text, full)
+	}
+	want := []string{"第一段内容比较长，需要单独发送。", "短。\n\n第三段也足够长，可以单独发送。", "结尾"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, chunks)
+	}
+}
+
+func TestChunkStream_CodeBlock(t *testing.T) {
+	// 代码块中的空行不是段落边界
+	text := "示例：\n\n```go\nfunc a() {}\n\nfunc b() {}\n```\n\n完毕"
+	var chunks []string
+	_, err := ChunkStream(fakeStream(text, 4), 1, 0, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"示例：", "```go\nfunc a() {}\n\nfunc b() {}\n```", "完毕"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, chunks)
+	}
+}
+
+func TestChunkStream_ForceSplit(t *testing.T) {
+	text := "```python\n" + strings.Repeat("print(1)\n", 10) + "```"
+	var chunks []string
+	_, err := ChunkStream(fakeStream(text, 5), 1000, 40, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected the code block to be split, got %q", chunks)
+	}
+	for _, c := range chunks {
+		if strings.Count(c, "```")%2 != 0 {
+			t.Errorf("unbalanced code fence in %q", c)
+		}
+		if !strings.HasPrefix(c, "```python") {
+			t.Errorf("expected chunk to reopen the code block, got %q", c)
+		}
+	}
+}
+
+func TestChunkStream_SendError(t *testing.T) {
+	text := "第一段足够长。\n\n第二段足够长。\n\n第三段"
+	calls := 0
+	full, err := ChunkStream(fakeStream(text, 2), 1, 0, func(chunk string) error {
+		calls++
+		return errors.New("send failed")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected one failed send, got %d calls, err %v", calls, err)
+	}
+	if full != text {
+		t.Errorf("expected the stream to be drained, got %q", full)
+	}
+}
@@ -26,6 +26,12 @@ const (
 	MimeTypeImagePng string = "image/png"
 )
 
+// 语音文件的大小上限，以及语音消息的时长上限（毫秒）
+const (
+	MaxVoiceBytes    = 2 << 20
+	MaxVoiceDuration = 60 * 1000
+)
+
 type MediaUploadResult struct {
 	ErrorCode    int64  `json:"errcode"`
 	ErrorMessage string `json:"errmsg"`
@@ -34,6 +40,15 @@ type MediaUploadResult struct {
 	Type         string `json:"type"`
 }
 
+type MessageFileDownloadResult struct {
+	DownloadUrl string `json:"downloadUrl"`
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+}
+
+// MaxMessageFileSize 下载的消息文件大小上限
+const MaxMessageFileSize = 20 << 20
+
 type OAuthTokenResult struct {
 	ErrorCode    int    `json:"errcode"`
 	ErrorMessage string `json:"errmsg"`
@@ -44,10 +59,15 @@ type OAuthTokenResult struct {
 type DingTalkClientInterface interface {
 	GetAccessToken() (string, error)
 	UploadMedia(content []byte, filename, mediaType, mimeType string) (*MediaUploadResult, error)
+	DownloadMessageFile(downloadCode, robotCode string) ([]byte, error)
+	SendRobotMessage(conversationType, openConversationId string, userIds []string, msg RobotMessage) error
+	SendToGroup(openConversationId string, msg RobotMessage) error
+	SendToUsers(userIds []string, msg RobotMessage) error
 }
 
 type DingTalkClientManagerInterface interface {
 	GetClientByOAuthClientID(clientId string) DingTalkClientInterface
+	GetDefaultClient() DingTalkClientInterface
 }
 
 type DingTalkClient struct {
@@ -92,6 +112,14 @@ func (m *DingTalkClientManager) GetClientByOAuthClientID(clientId string) DingTa
 	return nil
 }
 
+// GetDefaultClient 没有收到消息时（定时任务、告警等）使用第一个凭证对应的客户端，未配置凭证时返回 nil
+func (m *DingTalkClientManager) GetDefaultClient() DingTalkClientInterface {
+	if len(m.Credentials) == 0 {
+		return nil
+	}
+	return m.GetClientByOAuthClientID(m.Credentials[0].ClientID)
+}
+
 func (c *DingTalkClient) GetAccessToken() (string, error) {
 	accessToken := ""
 	{
@@ -183,6 +211,68 @@ func (c *DingTalkClient) UploadMedia(content []byte, filename, mediaType, mimeTy
 	return media, nil
 }
 
+func (c *DingTalkClient) DownloadMessageFile(downloadCode, robotCode string) ([]byte, error) {
+	// OpenAPI doc: https://open.dingtalk.com/document/orgapp/download-the-file-content-of-the-robot-receiving-message
+	accessToken, err := c.GetAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	if len(accessToken) == 0 {
+		return nil, errors.New("empty access token")
+	}
+	if robotCode == "" {
+		robotCode = c.Credential.ClientID
+	}
+	data, err := json.Marshal(map[string]string{"downloadCode": downloadCode, "robotCode": robotCode})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", OpenAPIBaseURL+"/v1.0/robot/messageFiles/download", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-acs-dingtalk-access-token", accessToken)
+
+	client := &http.Client{
+		Timeout: time.Second * 60,
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := &MessageFileDownloadResult{}
+	if err = json.Unmarshal(bodyBytes, result); err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK || result.DownloadUrl == "" {
+		return nil, fmt.Errorf("get message file download url failed: %s %s", result.Code, result.Message)
+	}
+
+	// 下载地址为临时链接，直接获取文件内容
+	fileRes, err := client.Get(result.DownloadUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer fileRes.Body.Close()
+	if fileRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download message file failed: %s", fileRes.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(fileRes.Body, MaxMessageFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxMessageFileSize {
+		return nil, fmt.Errorf("message file is larger than %d bytes", MaxMessageFileSize)
+	}
+	return content, nil
+}
+
 func (c *DingTalkClient) getAccessTokenFromDingTalk() (*OAuthTokenResult, error) {
 	// OpenAPI doc: https://open.dingtalk.com/document/orgapp/obtain-orgapp-token
 	apiUrl := "https://oapi.dingtalk.com/gettoken"
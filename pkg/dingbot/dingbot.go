@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // 接收的消息体
@@ -28,6 +29,7 @@ type ReceiveMsg struct {
 	Text                      Text    `json:"text"`
 	RobotCode                 string  `json:"robotCode"`
 	Msgtype                   MsgType `json:"msgtype"`
+	Content                   Content `json:"content"`
 }
 
 // 消息类型
@@ -35,6 +37,10 @@ type MsgType string
 
 const TEXT MsgType = "text"
 const MARKDOWN MsgType = "markdown"
+const FILE MsgType = "file"
+const PICTURE MsgType = "picture"
+const RICHTEXT MsgType = "richText"
+const AUDIO MsgType = "audio"
 
 // Text 消息
 type TextMessage struct {
@@ -48,6 +54,68 @@ type Text struct {
 	Content string `json:"content"`
 }
 
+// Content 非文本消息的内容，文件、图片等消息需要通过 downloadCode 下载
+type Content struct {
+	DownloadCode        string         `json:"downloadCode"`
+	PictureDownloadCode string         `json:"pictureDownloadCode"`
+	FileName            string         `json:"fileName"`
+	FileID              string         `json:"fileId"`
+	RichText            []RichTextItem `json:"richText"`
+	// 语音消息的识别结果
+	Recognition string `json:"recognition"`
+}
+
+// RichTextItem 图文消息中的一段，文字段只有 text，图片段的 type 为 picture
+type RichTextItem struct {
+	Text                string `json:"text"`
+	Type                string `json:"type"`
+	DownloadCode        string `json:"downloadCode"`
+	PictureDownloadCode string `json:"pictureDownloadCode"`
+}
+
+// RichTextContent 图文消息中的文字部分
+func (c Content) RichTextContent() string {
+	var parts []string
+	for _, item := range c.RichText {
+		if item.Text != "" {
+			parts = append(parts, item.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// PictureCodes 图片消息以及图文消息中图片的 downloadCode
+func (r ReceiveMsg) PictureCodes() []string {
+	var codes []string
+	switch r.Msgtype {
+	case PICTURE:
+		if r.Content.DownloadCode != "" {
+			codes = append(codes, r.Content.DownloadCode)
+		}
+	case RICHTEXT:
+		for _, item := range r.Content.RichText {
+			if item.Type == "picture" && item.DownloadCode != "" {
+				codes = append(codes, item.DownloadCode)
+			}
+		}
+	}
+	return codes
+}
+
+// ParseContent 解析 Stream 模式回调中的消息内容
+func ParseContent(v interface{}) Content {
+	var c Content
+	if v == nil {
+		return c
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return c
+	}
+	_ = json.Unmarshal(data, &c)
+	return c
+}
+
 // MarkDown 消息
 type MarkDownMessage struct {
 	MsgType  MsgType   `json:"msgtype"`
@@ -0,0 +1,31 @@
+package dingbot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReceiveMsg_RichText(t *testing.T) {
+	body := `{"msgtype":"richText","content":{"richText":[{"text":"这个报错是什么原因"},{"pictureDownloadCode":"p1","downloadCode":"d1","type":"picture"},{"text":"怎么解决"}]}}`
+	var msg ReceiveMsg
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Content.RichTextContent(); got != "这个报错是什么原因\n怎么解决" {
+		t.Errorf("unexpected rich text content: %q", got)
+	}
+	if codes := msg.PictureCodes(); len(codes) != 1 || codes[0] != "d1" {
+		t.Errorf("unexpected picture codes: %#v", codes)
+	}
+}
+
+func TestParseContent_Picture(t *testing.T) {
+	// Stream 模式回调中的 content 为 map
+	msg := ReceiveMsg{Msgtype: PICTURE, Content: ParseContent(map[string]interface{}{"downloadCode": "d1", "pictureDownloadCode": "p1"})}
+	if codes := msg.PictureCodes(); len(codes) != 1 || codes[0] != "d1" {
+		t.Errorf("unexpected picture codes: %#v", codes)
+	}
+	if c := ParseContent(nil); c.DownloadCode != "" {
+		t.Errorf("nil content should be empty")
+	}
+}
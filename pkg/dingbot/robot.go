@@ -0,0 +1,185 @@
+package dingbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIBaseURL 钉钉新版 OpenAPI 地址，测试时替换
+var OpenAPIBaseURL = "https://api.dingtalk.com"
+
+// 机器人通过 OpenAPI 主动发送的消息类型
+// OpenAPI doc: https://open.dingtalk.com/document/orgapp/robot-message-types-and-data-format
+const (
+	RobotMsgKeyText       string = "sampleText"
+	RobotMsgKeyMarkdown   string = "sampleMarkdown"
+	RobotMsgKeyImage      string = "sampleImageMsg"
+	RobotMsgKeyAudio      string = "sampleAudio"
+	RobotMsgKeyActionCard string = "sampleActionCard"
+)
+
+// maxBatchUsers 单聊批量发送每次最多的用户数
+const maxBatchUsers = 20
+
+// RobotMessage 机器人主动发送的消息，通过 RobotText 等函数构造
+type RobotMessage struct {
+	MsgKey   string
+	MsgParam interface{}
+}
+
+// ActionButton 卡片消息的按钮
+type ActionButton struct {
+	Title string
+	URL   string
+}
+
+// RobotText 文本消息
+func RobotText(content string) RobotMessage {
+	return RobotMessage{MsgKey: RobotMsgKeyText, MsgParam: map[string]string{"content": content}}
+}
+
+// RobotMarkdown Markdown 消息，title 用于会话列表及通知的展示
+func RobotMarkdown(title, text string) RobotMessage {
+	return RobotMessage{MsgKey: RobotMsgKeyMarkdown, MsgParam: map[string]string{"title": title, "text": text}}
+}
+
+// RobotImage 图片消息，photoURL 可以是图片地址或上传媒体文件得到的 mediaId
+func RobotImage(photoURL string) RobotMessage {
+	return RobotMessage{MsgKey: RobotMsgKeyImage, MsgParam: map[string]string{"photoURL": photoURL}}
+}
+
+// RobotAudio 语音消息，duration 为毫秒
+func RobotAudio(mediaID string, duration int) RobotMessage {
+	return RobotMessage{MsgKey: RobotMsgKeyAudio, MsgParam: map[string]string{"mediaId": mediaID, "duration": strconv.Itoa(duration)}}
+}
+
+// RobotActionCard 卡片消息，一个按钮时为整体跳转，2 到 6 个按钮时为独立跳转，超过 6 个的按钮会被忽略
+func RobotActionCard(title, text string, buttons ...ActionButton) RobotMessage {
+	if len(buttons) > 6 {
+		buttons = buttons[:6]
+	}
+	param := map[string]string{"title": title, "text": text}
+	switch len(buttons) {
+	case 0:
+		return RobotMarkdown(title, text)
+	case 1:
+		param["singleTitle"] = buttons[0].Title
+		param["singleURL"] = buttons[0].URL
+		return RobotMessage{MsgKey: RobotMsgKeyActionCard, MsgParam: param}
+	}
+	for i, b := range buttons {
+		param[fmt.Sprintf("actionTitle%d", i+1)] = b.Title
+		param[fmt.Sprintf("actionURL%d", i+1)] = b.URL
+	}
+	return RobotMessage{MsgKey: fmt.Sprintf("%s%d", RobotMsgKeyActionCard, len(buttons)), MsgParam: param}
+}
+
+type RobotSendResult struct {
+	Code                      string   `json:"code"`
+	Message                   string   `json:"message"`
+	ProcessQueryKey           string   `json:"processQueryKey"`
+	InvalidStaffIdList        []string `json:"invalidStaffIdList"`
+	FlowControlledStaffIdList []string `json:"flowControlledStaffIdList"`
+}
+
+// SendRobotMessage 以机器人身份发送消息，群聊（conversationType 为 2）发送到 openConversationId 对应的群，单聊发送给 userIds
+func (c *DingTalkClient) SendRobotMessage(conversationType, openConversationId string, userIds []string, msg RobotMessage) error {
+	if conversationType == "2" {
+		return c.SendToGroup(openConversationId, msg)
+	}
+	return c.SendToUsers(userIds, msg)
+}
+
+// SendToGroup 以机器人身份向群发送消息，机器人需要已经在群里
+func (c *DingTalkClient) SendToGroup(openConversationId string, msg RobotMessage) error {
+	// OpenAPI doc: https://open.dingtalk.com/document/orgapp/the-robot-sends-a-group-message
+	if openConversationId == "" {
+		return errors.New("empty open conversation id")
+	}
+	_, err := c.sendRobotMessage("/v1.0/robot/groupMessages/send", map[string]interface{}{"openConversationId": openConversationId}, msg)
+	return err
+}
+
+// SendToUsers 以机器人身份给用户发送单聊消息，用户较多时分批发送
+func (c *DingTalkClient) SendToUsers(userIds []string, msg RobotMessage) error {
+	// OpenAPI doc: https://open.dingtalk.com/document/orgapp/chatbots-send-one-on-one-chat-messages-in-batches
+	var ids []string
+	for _, id := range userIds {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return errors.New("empty user ids")
+	}
+	var invalid []string
+	for i := 0; i < len(ids); i += maxBatchUsers {
+		end := i + maxBatchUsers
+		if end > len(ids) {
+			end = len(ids)
+		}
+		result, err := c.sendRobotMessage("/v1.0/robot/oToMessages/batchSend", map[string]interface{}{"userIds": ids[i:end]}, msg)
+		if err != nil {
+			return err
+		}
+		invalid = append(invalid, result.InvalidStaffIdList...)
+		invalid = append(invalid, result.FlowControlledStaffIdList...)
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("send robot message to some users failed: %s", strings.Join(invalid, ","))
+	}
+	return nil
+}
+
+func (c *DingTalkClient) sendRobotMessage(path string, body map[string]interface{}, msg RobotMessage) (*RobotSendResult, error) {
+	accessToken, err := c.GetAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	if len(accessToken) == 0 {
+		return nil, errors.New("empty access token")
+	}
+	param, err := json.Marshal(msg.MsgParam)
+	if err != nil {
+		return nil, err
+	}
+	body["robotCode"] = c.Credential.ClientID
+	body["msgKey"] = msg.MsgKey
+	body["msgParam"] = string(param)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", OpenAPIBaseURL+path, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-acs-dingtalk-access-token", accessToken)
+
+	client := &http.Client{
+		Timeout: time.Second * 60,
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := &RobotSendResult{}
+	_ = json.Unmarshal(bodyBytes, result)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("send robot message failed: %s %s", result.Code, result.Message)
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package dingbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+)
+
+type robotRequest struct {
+	Path  string
+	Token string
+	Body  map[string]interface{}
+}
+
+// newRobotTestClient 启动模拟的 OpenAPI 服务，返回已缓存 AccessToken 的客户端
+func newRobotTestClient(t *testing.T, handler func(req robotRequest) (int, string)) (*DingTalkClient, *[]robotRequest) {
+	var (
+		mu       sync.Mutex
+		requests []robotRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := robotRequest{Path: r.URL.Path, Token: r.Header.Get("x-acs-dingtalk-access-token")}
+		if err := json.NewDecoder(r.Body).Decode(&req.Body); err != nil {
+			t.Errorf("decode request body error: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		code, body := handler(req)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	old := OpenAPIBaseURL
+	OpenAPIBaseURL = srv.URL
+	t.Cleanup(func() { OpenAPIBaseURL = old })
+
+	client := NewDingTalkClient(config.Credential{ClientID: "robot-code", ClientSecret: "secret"})
+	client.AccessToken = "token-for-test"
+	client.expireAt = time.Now().Add(time.Hour).Unix()
+	return client, &requests
+}
+
+func TestSendToGroup(t *testing.T) {
+	client, requests := newRobotTestClient(t, func(req robotRequest) (int, string) {
+		return http.StatusOK, `{"processQueryKey":"key"}`
+	})
+	if err := client.SendRobotMessage("2", "cid-group", nil, RobotMarkdown("标题", "**内容**")); err != nil {
+		t.Fatalf("send to group error: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.Path != "/v1.0/robot/groupMessages/send" || req.Token != "token-for-test" {
+		t.Errorf("unexpected request: %s %s", req.Path, req.Token)
+	}
+	if req.Body["openConversationId"] != "cid-group" || req.Body["robotCode"] != "robot-code" || req.Body["msgKey"] != RobotMsgKeyMarkdown {
+		t.Errorf("unexpected body: %v", req.Body)
+	}
+	var param map[string]string
+	if err := json.Unmarshal([]byte(req.Body["msgParam"].(string)), &param); err != nil {
+		t.Fatalf("msgParam should be a json string: %v", err)
+	}
+	if param["title"] != "标题" || param["text"] != "**内容**" {
+		t.Errorf("unexpected msgParam: %v", param)
+	}
+}
+
+func TestSendToUsers_Batch(t *testing.T) {
+	client, requests := newRobotTestClient(t, func(req robotRequest) (int, string) {
+		return http.StatusOK, `{}`
+	})
+	var ids []string
+	for i := 0; i < 25; i++ {
+		ids = append(ids, strings.Repeat("u", i+1))
+	}
+	if err := client.SendRobotMessage("1", "", append(ids, ""), RobotText("hello")); err != nil {
+		t.Fatalf("send to users error: %v", err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(*requests))
+	}
+	for i, want := range []int{20, 5} {
+		req := (*requests)[i]
+		if req.Path != "/v1.0/robot/oToMessages/batchSend" {
+			t.Errorf("unexpected path: %s", req.Path)
+		}
+		if got := len(req.Body["userIds"].([]interface{})); got != want {
+			t.Errorf("batch %d: expected %d users, got %d", i, want, got)
+		}
+	}
+}
+
+func TestSendToUsers_Failed(t *testing.T) {
+	client, _ := newRobotTestClient(t, func(req robotRequest) (int, string) {
+		return http.StatusOK, `{"invalidStaffIdList":["bad-user"]}`
+	})
+	err := client.SendToUsers([]string{"good-user", "bad-user"}, RobotText("hello"))
+	if err == nil || !strings.Contains(err.Error(), "bad-user") {
+		t.Errorf("expected error with invalid user, got %v", err)
+	}
+	if err := client.SendToUsers(nil, RobotText("hello")); err == nil {
+		t.Error("expected error with empty user ids")
+	}
+
+	client, _ = newRobotTestClient(t, func(req robotRequest) (int, string) {
+		return http.StatusBadRequest, `{"code":"invalidParameter","message":"robot not in group"}`
+	})
+	err = client.SendToGroup("cid-group", RobotText("hello"))
+	if err == nil || !strings.Contains(err.Error(), "robot not in group") {
+		t.Errorf("expected api error, got %v", err)
+	}
+}
+
+func TestRobotActionCard(t *testing.T) {
+	msg := RobotActionCard("标题", "内容", ActionButton{Title: "查看", URL: "https://example.com"})
+	param := msg.MsgParam.(map[string]string)
+	if msg.MsgKey != RobotMsgKeyActionCard || param["singleTitle"] != "查看" || param["singleURL"] != "https://example.com" {
+		t.Errorf("unexpected single button card: %v %v", msg.MsgKey, param)
+	}
+
+	msg = RobotActionCard("标题", "内容", ActionButton{Title: "同意", URL: "a"}, ActionButton{Title: "拒绝", URL: "b"})
+	param = msg.MsgParam.(map[string]string)
+	if msg.MsgKey != "sampleActionCard2" || param["actionTitle2"] != "拒绝" || param["actionURL1"] != "a" {
+		t.Errorf("unexpected multi button card: %v %v", msg.MsgKey, param)
+	}
+
+	if msg := RobotActionCard("标题", "内容"); msg.MsgKey != RobotMsgKeyMarkdown {
+		t.Errorf("card without buttons should fall back to markdown, got %s", msg.MsgKey)
+	}
+}
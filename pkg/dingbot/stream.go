@@ -2,6 +2,7 @@ package dingbot
 
 import (
 	"fmt"
+	"sync"
 
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	dingtalkcard "github.com/alibabacloud-go/dingtalk/card_1_0"
@@ -101,6 +102,32 @@ func (s *StreamCardClient) CreateAndDeliverCard(accessToken string, req *CreateA
 	return err
 }
 
+// UpdateCardData 更新卡片数据，只更新 data 中的字段
+func (s *StreamCardClient) UpdateCardData(accessToken, outTrackID string, data map[string]string) error {
+	headers := &dingtalkcard.UpdateCardHeaders{
+		XAcsDingtalkAccessToken: tea.String(accessToken),
+	}
+
+	cardData := &dingtalkcard.UpdateCardRequestCardData{
+		CardParamMap: make(map[string]*string),
+	}
+	for k, v := range data {
+		cardData.CardParamMap[k] = tea.String(v)
+	}
+
+	updateReq := &dingtalkcard.UpdateCardRequest{
+		OutTrackId: tea.String(outTrackID),
+		CardData:   cardData,
+		CardUpdateOptions: &dingtalkcard.UpdateCardRequestCardUpdateOptions{
+			UpdateCardDataByKey: tea.Bool(true),
+		},
+		UserIdType: tea.Int32(1),
+	}
+
+	_, err := s.client.UpdateCardWithOptions(updateReq, headers, &util.RuntimeOptions{})
+	return err
+}
+
 // StreamingUpdateRequest 流式更新请求
 type StreamingUpdateRequest struct {
 	OutTrackID string
@@ -108,6 +135,7 @@ type StreamingUpdateRequest struct {
 	Content    string
 	IsFull     bool
 	IsFinalize bool
+	IsError    bool
 }
 
 // StreamingUpdate 流式更新卡片内容
@@ -123,32 +151,122 @@ func (s *StreamCardClient) StreamingUpdate(accessToken string, req *StreamingUpd
 		Content:    tea.String(req.Content),
 		IsFull:     tea.Bool(req.IsFull),
 		IsFinalize: tea.Bool(req.IsFinalize),
-		IsError:    tea.Bool(false),
+		IsError:    tea.Bool(req.IsError),
 	}
 
 	_, err := s.client.StreamingUpdateWithOptions(updateReq, headers, &util.RuntimeOptions{})
 	return err
 }
 
-// UpdateAIStreamCard 更新AI流式卡片 (简化版本,不依赖卡片模板)
-func (c *DingTalkClient) UpdateAIStreamCard(trackID, content string, isFinalize bool) error {
-	cardClient, err := NewStreamCardClient()
+var (
+	sharedCardClient     *StreamCardClient
+	sharedCardClientErr  error
+	sharedCardClientOnce sync.Once
+)
+
+// getStreamCardClient 所有卡片共用一个 SDK 客户端
+func getStreamCardClient() (*StreamCardClient, error) {
+	sharedCardClientOnce.Do(func() {
+		sharedCardClient, sharedCardClientErr = NewStreamCardClient()
+	})
+	return sharedCardClient, sharedCardClientErr
+}
+
+// streamingUpdate 使用共用的 SDK 客户端更新卡片，access token 由客户端缓存
+func (c *DingTalkClient) streamingUpdate(req *StreamingUpdateRequest) error {
+	cardClient, err := getStreamCardClient()
 	if err != nil {
 		return fmt.Errorf("failed to create stream card client: %w", err)
 	}
+	accessToken, err := c.GetAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	return cardClient.StreamingUpdate(accessToken, req)
+}
 
+// CreateAndDeliverCard 使用共用的 SDK 客户端创建并投放卡片，access token 由客户端缓存
+func (c *DingTalkClient) CreateAndDeliverCard(req *CreateAndDeliverCardRequest) error {
+	cardClient, err := getStreamCardClient()
+	if err != nil {
+		return fmt.Errorf("failed to create stream card client: %w", err)
+	}
 	accessToken, err := c.GetAccessToken()
 	if err != nil {
 		return fmt.Errorf("failed to get access token: %w", err)
 	}
+	return cardClient.CreateAndDeliverCard(accessToken, req)
+}
 
-	req := &StreamingUpdateRequest{
+// updateCardData 使用共用的 SDK 客户端更新卡片数据
+func (c *DingTalkClient) updateCardData(trackID string, data map[string]string) error {
+	cardClient, err := getStreamCardClient()
+	if err != nil {
+		return fmt.Errorf("failed to create stream card client: %w", err)
+	}
+	accessToken, err := c.GetAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	return cardClient.UpdateCardData(accessToken, trackID, data)
+}
+
+// NewCardUpdater 创建卡片的更新协程
+func (c *DingTalkClient) NewCardUpdater(trackID string) *CardUpdater {
+	return NewCardUpdater(trackID, c.streamingUpdate)
+}
+
+// AICardTemplateID 钉钉内置的 AI 卡片模板，不需要在开放平台搭建卡片模板。
+// 回答写入 msgContent 字段，flowStatus 字段表示生成状态
+const AICardTemplateID = "382e4302-551d-4880-bf29-a30acfab2e71.schema"
+
+const aiCardContentKey = "msgContent"
+
+// AI 卡片的生成状态
+const (
+	aiCardInputting = "2"
+	aiCardFinished  = "3"
+	aiCardFailed    = "5"
+)
+
+// AICardData 创建内置 AI 卡片时的初始数据
+func AICardData() map[string]string {
+	return map[string]string{
+		aiCardContentKey: "",
+		"flowStatus":     aiCardInputting,
+		"config":         `{"autoLayout":true}`,
+	}
+}
+
+// NewAICardUpdater 创建内置 AI 卡片的更新协程
+func (c *DingTalkClient) NewAICardUpdater(trackID string) *CardUpdater {
+	return NewCardUpdater(trackID, c.aiCardUpdate)
+}
+
+// aiCardUpdate 更新内置 AI 卡片的内容，最后一次更新后再把卡片标记为已完成或出错
+func (c *DingTalkClient) aiCardUpdate(req *StreamingUpdateRequest) error {
+	update := *req
+	update.Key = aiCardContentKey
+	if err := c.streamingUpdate(&update); err != nil || !req.IsFinalize {
+		return err
+	}
+	status := aiCardFinished
+	if req.IsError {
+		status = aiCardFailed
+	}
+	return c.updateCardData(req.OutTrackID, map[string]string{
+		aiCardContentKey: req.Content,
+		"flowStatus":     status,
+	})
+}
+
+// UpdateAIStreamCard 更新AI流式卡片 (简化版本,不依赖卡片模板)
+func (c *DingTalkClient) UpdateAIStreamCard(trackID, content string, isFinalize bool) error {
+	return c.streamingUpdate(&StreamingUpdateRequest{
 		OutTrackID: trackID,
 		Key:        "content",
 		Content:    content,
 		IsFull:     true,
 		IsFinalize: isFinalize,
-	}
-
-	return cardClient.StreamingUpdate(accessToken, req)
+	})
 }
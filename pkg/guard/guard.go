@@ -0,0 +1,245 @@
+package guard
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 内置检测器名称
+const (
+	DetectorAPIKey     = "api_key"
+	DetectorToken      = "token"
+	DetectorPrivateKey = "private_key"
+	DetectorIDCard     = "id_card"
+	DetectorPhone      = "phone"
+	DetectorInjection  = "injection"
+)
+
+// Finding 一类检测结果
+type Finding struct {
+	Detector string
+	Name     string
+	Count    int
+	// 是否已脱敏，提示词注入只做提醒，不做替换
+	Redacted bool
+}
+
+// detector 一个检测器由若干正则组成，正则中如果有分组，则只替换第一个分组
+type detector struct {
+	name     string
+	label    string
+	patterns []*regexp.Regexp
+	// 对命中内容进一步校验，返回 false 时忽略
+	validate func(s string) bool
+	// 只提醒，不替换
+	flagOnly bool
+}
+
+var detectors = []detector{
+	{
+		name:  DetectorPrivateKey,
+		label: "私钥",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+		},
+	},
+	{
+		name:  DetectorAPIKey,
+		label: "API密钥",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+			regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+			regexp.MustCompile(`\bLTAI[0-9A-Za-z]{12,20}\b`),
+			regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`),
+			regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+			regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+		},
+	},
+	{
+		name:  DetectorToken,
+		label: "令牌",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+			regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`),
+			regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api_?key|access_?key|secret_?key|client_?secret)["']?\s*[:=]\s*["']?([^\s"',;\[][^\s"',;]{5,})`),
+		},
+	},
+	{
+		name:  DetectorIDCard,
+		label: "身份证号",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+		},
+		validate: ValidIDCard,
+	},
+	{
+		name:  DetectorPhone,
+		label: "手机号",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?:\+?86[- ]?)?\d{11,}`),
+		},
+		validate: ValidPhone,
+	},
+	{
+		name:  DetectorInjection,
+		label: "提示词注入",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)ignore\s+(?:all\s+)?(?:the\s+)?(?:previous|above|prior)\s+(?:instructions|prompts|rules)`),
+			regexp.MustCompile(`(?i)(?:reveal|print|show)\s+(?:your\s+)?(?:system\s+prompt|initial\s+instructions)`),
+			regexp.MustCompile(`忽略(?:之前|以上|前面|上述)的?(?:所有|全部)?的?(?:指令|提示|规则|设定)`),
+			regexp.MustCompile(`(?:输出|告诉我|显示)(?:你的)?(?:系统提示词|系统指令|初始指令)`),
+		},
+		flagOnly: true,
+	},
+}
+
+// Names 全部内置检测器名称
+func Names() []string {
+	names := make([]string, 0, len(detectors))
+	for _, d := range detectors {
+		names = append(names, d.name)
+	}
+	return names
+}
+
+// Guard 敏感信息扫描器
+type Guard struct {
+	detectors []detector
+}
+
+// New 创建扫描器，names 为空时启用全部检测器
+func New(names []string) (*Guard, error) {
+	if len(names) == 0 {
+		return &Guard{detectors: detectors}, nil
+	}
+	g := &Guard{}
+	for _, name := range names {
+		found := false
+		for _, d := range detectors {
+			if d.name == strings.TrimSpace(name) {
+				g.detectors = append(g.detectors, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown secret guard detector: %s", name)
+		}
+	}
+	return g, nil
+}
+
+// Scan 扫描文本，返回脱敏后的文本及检测结果
+func (g *Guard) Scan(text string) (string, []Finding) {
+	if g == nil {
+		return text, nil
+	}
+	var findings []Finding
+	for _, d := range g.detectors {
+		count := 0
+		for _, re := range d.patterns {
+			text = replaceAll(re, text, func(s string) (string, bool) {
+				if d.validate != nil && !d.validate(s) {
+					return s, false
+				}
+				count++
+				if d.flagOnly {
+					return s, true
+				}
+				return fmt.Sprintf("[已脱敏:%s]", d.label), true
+			})
+		}
+		if count > 0 {
+			findings = append(findings, Finding{Detector: d.name, Name: d.label, Count: count, Redacted: !d.flagOnly})
+		}
+	}
+	return text, findings
+}
+
+// spans 返回文本中会被脱敏的内容所在的区间
+func (g *Guard) spans(text string) [][2]int {
+	if g == nil {
+		return nil
+	}
+	var spans [][2]int
+	for _, d := range g.detectors {
+		if d.flagOnly {
+			continue
+		}
+		for _, re := range d.patterns {
+			for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+				start, end := loc[0], loc[1]
+				if len(loc) >= 4 && loc[2] >= 0 {
+					start, end = loc[2], loc[3]
+				}
+				if d.validate != nil && !d.validate(text[start:end]) {
+					continue
+				}
+				spans = append(spans, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+	return spans
+}
+
+// replaceAll 替换所有命中，正则中有分组时只替换第一个分组的内容
+func replaceAll(re *regexp.Regexp, text string, repl func(s string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		s, ok := repl(text[start:end])
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(s)
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// ValidIDCard 校验18位身份证号的校验位
+func ValidIDCard(s string) bool {
+	if len(s) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	codes := "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		sum += int(s[i]-'0') * weights[i]
+	}
+	return strings.ToUpper(s[17:]) == string(codes[sum%11])
+}
+
+var phoneRe = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// ValidPhone 判断是否为大陆手机号，连续数字中截取的片段不算
+func ValidPhone(s string) bool {
+	s = strings.TrimPrefix(s, "+")
+	if len(s) > 11 && strings.HasPrefix(s, "86") {
+		s = strings.TrimLeft(s[2:], "- ")
+	}
+	return phoneRe.MatchString(s)
+}
+
+// Summary 将检测结果汇总为一句提示
+func Summary(findings []Finding) string {
+	var parts []string
+	for _, f := range findings {
+		parts = append(parts, fmt.Sprintf("%s×%d", f.Name, f.Count))
+	}
+	return strings.Join(parts, "、")
+}
@@ -0,0 +1,91 @@
+package guard
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// streamHeldFields 流式输出时末尾暂存的字段数，覆盖 "Bearer xxx"、"password = xxx" 这类中间带空白的敏感信息
+const streamHeldFields = 4
+
+// StreamFilter 对流式输出脱敏
+// 为了识别跨分片的敏感信息，末尾的几个字段以及还没有结束的私钥会先暂存，等后续内容到达或流结束后再输出
+type StreamFilter struct {
+	g   *Guard
+	raw []rune
+	// 已经脱敏输出的原文长度
+	emitted int
+}
+
+// NewStreamFilter 创建流式脱敏器，扫描器为空时原样输出
+func (g *Guard) NewStreamFilter() *StreamFilter {
+	return &StreamFilter{g: g}
+}
+
+// Write 追加一段内容，返回新增的可以安全展示的脱敏后的内容
+func (f *StreamFilter) Write(chunk string) string {
+	f.raw = append(f.raw, []rune(chunk)...)
+	if f.g == nil {
+		return f.emit(len(f.raw))
+	}
+	return f.emit(f.safeEnd())
+}
+
+// Flush 流结束，返回剩余内容脱敏后的结果
+func (f *StreamFilter) Flush() string {
+	return f.emit(len(f.raw))
+}
+
+// Raw 返回未脱敏的原始文本
+func (f *StreamFilter) Raw() string {
+	return string(f.raw)
+}
+
+// emit 对尚未输出的内容截取到 end 并脱敏，切分点之前和之后的内容不会组成同一个敏感信息，可以分开扫描
+func (f *StreamFilter) emit(end int) string {
+	if end <= f.emitted {
+		return ""
+	}
+	text, _ := f.g.Scan(string(f.raw[f.emitted:end]))
+	f.emitted = end
+	return text
+}
+
+// safeEnd 返回可以安全输出到的位置：倒数第 streamHeldFields 个字段的开头，
+// 且不晚于未结束的私钥的开头，也不会把一个已经识别出的敏感信息切成两段
+func (f *StreamFilter) safeEnd() int {
+	// 字段不足 streamHeldFields 个时从最早的字段开始暂存，没有字段时全部可以输出
+	end := len(f.raw)
+	fields := 0
+	for i := len(f.raw) - 1; i >= f.emitted && fields < streamHeldFields; i-- {
+		if isFieldSep(f.raw[i]) || (i > f.emitted && !isFieldSep(f.raw[i-1])) {
+			continue
+		}
+		fields++
+		end = i
+	}
+
+	pending := string(f.raw[f.emitted:])
+	cut := len(string(f.raw[f.emitted:end]))
+	if begin := strings.LastIndex(pending[:cut], "-----BEGIN "); begin >= 0 && begin > strings.LastIndex(pending[:cut], "-----END ") {
+		cut = begin
+	}
+	// 往前移动切分点后可能又切到另一个敏感信息，直到没有跨过切分点的敏感信息为止
+	spans := f.g.spans(pending)
+	for moved := true; moved; {
+		moved = false
+		for _, s := range spans {
+			if s[0] < cut && s[1] > cut {
+				cut = s[0]
+				moved = true
+			}
+		}
+	}
+	return f.emitted + utf8.RuneCountInString(pending[:cut])
+}
+
+// isFieldSep 敏感信息都由 ASCII 字符组成，空白和非 ASCII 字符都可以作为字段的分隔
+func isFieldSep(r rune) bool {
+	return unicode.IsSpace(r) || r > unicode.MaxASCII
+}
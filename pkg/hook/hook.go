@@ -0,0 +1,252 @@
+package hook
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+)
+
+var (
+	ErrNotFound     = errors.New("hook not found")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// DefaultPrompt 默认的告警总结提示词
+const DefaultPrompt = `你是一名经验丰富的运维值班工程师。下面是 {{.Source}} 推送的告警（状态：{{.Status}}），请用中文完成：
+1. 用一两句话概括发生了什么，涉及哪些服务或主机；
+2. 判断严重程度（紧急、重要、一般）并说明理由；
+3. 给出最多三条排查或处理建议。
+如果告警已经恢复，只需要简要说明恢复情况。使用 Markdown 输出，不超过 300 字。
+
+{{.Payload}}`
+
+// maxPayloadRunes 交给模型的告警内容上限，避免超长推送耗尽 token
+const maxPayloadRunes = 6000
+
+// dedupRetention 去重记录的最长保留时间，超过后不再统计重复次数
+const dedupRetention = 24 * time.Hour
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Summarizer 总结告警的模型接口
+type Summarizer interface {
+	Summarize(prompt string) (string, error)
+}
+
+// SummarizerFunc 将普通函数适配为 Summarizer
+type SummarizerFunc func(prompt string) (string, error)
+
+func (f SummarizerFunc) Summarize(prompt string) (string, error) {
+	return f(prompt)
+}
+
+// Sender 把消息发送到群
+type Sender interface {
+	Send(robotCode, group, title, text string) error
+}
+
+// SenderFunc 将普通函数适配为 Sender
+type SenderFunc func(robotCode, group, title, text string) error
+
+func (f SenderFunc) Send(robotCode, group, title, text string) error {
+	return f(robotCode, group, title, text)
+}
+
+// Post 一次待发送的告警
+type Post struct {
+	Hook    config.Hook
+	Payload Payload
+	// Repeated 上一次发送后，去重窗口内被合并的重复推送次数
+	Repeated int
+}
+
+type hookEntry struct {
+	hook   config.Hook
+	prompt *template.Template
+}
+
+type dedupEntry struct {
+	sentAt   time.Time
+	repeated int
+}
+
+// Service 管理配置的 Webhook，负责鉴权、去重、总结及发送
+type Service struct {
+	hooks  map[string]hookEntry
+	window time.Duration
+
+	mu         sync.Mutex
+	seen       map[string]*dedupEntry
+	summarizer Summarizer
+	sender     Sender
+	// now 当前时间，测试时替换
+	now func() time.Time
+}
+
+// New 根据配置创建 Service，名称重复、缺少群或令牌、模板有误时返回错误
+func New(conf config.Webhook) (*Service, error) {
+	s := &Service{
+		hooks:  map[string]hookEntry{},
+		window: time.Duration(conf.DedupMinutes) * time.Minute,
+		seen:   map[string]*dedupEntry{},
+		now:    time.Now,
+	}
+	for _, h := range conf.Hooks {
+		if !namePattern.MatchString(h.Name) {
+			return nil, fmt.Errorf("invalid hook name %q", h.Name)
+		}
+		if _, ok := s.hooks[h.Name]; ok {
+			return nil, fmt.Errorf("duplicate hook name %q", h.Name)
+		}
+		if h.Group == "" {
+			return nil, fmt.Errorf("hook %q: group is required", h.Name)
+		}
+		if h.Token == "" {
+			return nil, fmt.Errorf("hook %q: token is required", h.Name)
+		}
+		text := h.Prompt
+		if text == "" {
+			text = DefaultPrompt
+		}
+		prompt, err := template.New(h.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("hook %q: invalid prompt: %v", h.Name, err)
+		}
+		s.hooks[h.Name] = hookEntry{hook: h, prompt: prompt}
+	}
+	return s, nil
+}
+
+// SetSummarizer 设置总结告警的模型接口，未设置时直接发送告警内容
+func (s *Service) SetSummarizer(summarizer Summarizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summarizer = summarizer
+}
+
+// SetSender 设置发送消息的接口
+func (s *Service) SetSender(sender Sender) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sender = sender
+}
+
+// Handle 校验令牌并解析推送内容，去重窗口内的重复推送返回 nil
+func (s *Service) Handle(name, token string, body []byte) (*Post, error) {
+	entry, ok := s.hooks[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(entry.hook.Token), []byte(token)) != 1 {
+		return nil, ErrUnauthorized
+	}
+	payload, err := ParsePayload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for key, d := range s.seen {
+		if age := now.Sub(d.sentAt); age >= dedupRetention || (age >= s.window && d.repeated == 0) {
+			delete(s.seen, key)
+		}
+	}
+	key := name + "|" + payload.Key
+	post := &Post{Hook: entry.hook, Payload: payload}
+	if d, ok := s.seen[key]; ok {
+		if now.Sub(d.sentAt) < s.window {
+			d.repeated++
+			return nil, nil
+		}
+		post.Repeated = d.repeated
+	}
+	s.seen[key] = &dedupEntry{sentAt: now}
+	return post, nil
+}
+
+// Deliver 总结告警并发送到群，模型调用失败时发送原始告警
+func (s *Service) Deliver(post *Post) error {
+	s.mu.Lock()
+	summarizer, sender := s.summarizer, s.sender
+	s.mu.Unlock()
+	if sender == nil {
+		return errors.New("sender not set")
+	}
+
+	p := post.Payload
+	var summary string
+	if summarizer != nil {
+		prompt, err := s.Prompt(post)
+		if err == nil {
+			summary, err = summarizer.Summarize(prompt)
+		}
+		if err != nil {
+			summary = fmt.Sprintf("> 告警总结失败：%v\n\n%s", err, plainSummary(p))
+		}
+	} else {
+		summary = plainSummary(p)
+	}
+
+	icon := "🔥"
+	if p.Status == StatusResolved {
+		icon = "✅"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s %s\n\n%s\n\n---\n\n**来源:** %s", icon, p.Title, strings.TrimSpace(summary), p.Source)
+	if post.Repeated > 0 {
+		fmt.Fprintf(&b, "，上次发送后重复推送 %d 次", post.Repeated)
+	}
+	return sender.Send(post.Hook.RobotCode, post.Hook.Group, p.Title, b.String())
+}
+
+// Prompt 根据 Hook 的模板生成提示词
+func (s *Service) Prompt(post *Post) (string, error) {
+	entry, ok := s.hooks[post.Hook.Name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	var buf bytes.Buffer
+	err := entry.prompt.Execute(&buf, map[string]interface{}{
+		"Name":    post.Hook.Name,
+		"Source":  post.Payload.Source,
+		"Status":  post.Payload.Status,
+		"Title":   post.Payload.Title,
+		"Alerts":  post.Payload.Alerts,
+		"Payload": truncate(post.Payload.Raw, maxPayloadRunes),
+	})
+	return buf.String(), err
+}
+
+// plainSummary 没有模型总结时，列出每条告警的名称及描述
+func plainSummary(p Payload) string {
+	if len(p.Alerts) == 0 {
+		return "```\n" + truncate(p.Raw, 2000) + "\n```"
+	}
+	var b strings.Builder
+	for _, a := range p.Alerts {
+		desc := a.Annotations["summary"]
+		if d := a.Annotations["description"]; d != "" {
+			desc = d
+		}
+		fmt.Fprintf(&b, "- **%s** [%s] %s\n", a.Name(), a.Status, desc)
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "\n...(已截断)"
+}
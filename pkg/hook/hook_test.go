@@ -0,0 +1,212 @@
+package hook
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+)
+
+func readPayload(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type sentMessage struct {
+	robotCode, group, title, text string
+}
+
+// newTestService 使用假的模型和发送接口，prompts 记录交给模型的提示词
+func newTestService(t *testing.T, summary string, summaryErr error) (*Service, *[]string, *[]sentMessage) {
+	t.Helper()
+	s, err := New(config.Webhook{
+		DedupMinutes: 10,
+		Hooks: []config.Hook{
+			{Name: "alertmanager", Token: "secret", Group: "cid-ops", RobotCode: "robot"},
+			{Name: "grafana", Token: "grafana-secret", Group: "cid-db", Prompt: "总结 {{.Source}} 的告警 {{.Title}}:\n{{.Payload}}"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompts []string
+	var sent []sentMessage
+	s.SetSummarizer(SummarizerFunc(func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return summary, summaryErr
+	}))
+	s.SetSender(SenderFunc(func(robotCode, group, title, text string) error {
+		sent = append(sent, sentMessage{robotCode, group, title, text})
+		return nil
+	}))
+	return s, &prompts, &sent
+}
+
+func TestParsePayload(t *testing.T) {
+	tests := []struct {
+		file   string
+		source string
+		status string
+		title  string
+		alerts int
+	}{
+		{"alertmanager.json", SourceAlertmanager, StatusFiring, "[FIRING:2] HighCPUUsage", 2},
+		{"grafana.json", SourceGrafana, StatusResolved, "[RESOLVED] MySQL slow queries (Database mysql-01)", 1},
+		{"grafana_legacy.json", SourceGrafana, StatusFiring, "[Alerting] Disk usage alert", 0},
+	}
+	for _, tt := range tests {
+		p, err := ParsePayload(readPayload(t, tt.file))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if p.Source != tt.source || p.Status != tt.status || p.Title != tt.title || len(p.Alerts) != tt.alerts {
+			t.Errorf("%s: unexpected payload %q %q %q %d", tt.file, p.Source, p.Status, p.Title, len(p.Alerts))
+		}
+		if p.Key == "" {
+			t.Errorf("%s: empty key", tt.file)
+		}
+	}
+
+	p, err := ParsePayload([]byte(`{"title":"备份失败","host":"db-01"}`))
+	if err != nil || p.Source != SourceGeneric || p.Title != "备份失败" {
+		t.Errorf("unexpected generic payload: %+v %v", p, err)
+	}
+	if _, err := ParsePayload([]byte(`not json`)); err == nil {
+		t.Error("expected error with invalid json")
+	}
+}
+
+func TestParsePayload_Key(t *testing.T) {
+	body := string(readPayload(t, "alertmanager.json"))
+	p1, _ := ParsePayload([]byte(body))
+	// 外层字段变化时，只要告警相同 Key 就不变
+	p2, _ := ParsePayload([]byte(strings.Replace(body, `"truncatedAlerts": 0`, `"truncatedAlerts": 0, "extra": 1`, 1)))
+	if p1.Key != p2.Key {
+		t.Errorf("same alerts should have the same key")
+	}
+	p3, _ := ParsePayload([]byte(strings.ReplaceAll(body, `"firing"`, `"resolved"`)))
+	if p1.Key == p3.Key {
+		t.Errorf("resolved alerts should have a different key")
+	}
+}
+
+func TestHandle_Auth(t *testing.T) {
+	s, _, _ := newTestService(t, "", nil)
+	body := readPayload(t, "alertmanager.json")
+	if _, err := s.Handle("unknown", "", body); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Handle("alertmanager", "wrong", body); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if post, err := s.Handle("alertmanager", "secret", body); err != nil || post == nil {
+		t.Errorf("expected post, got %v %v", post, err)
+	}
+	if _, err := s.Handle("grafana", "", readPayload(t, "grafana.json")); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized without token, got %v", err)
+	}
+	if post, err := s.Handle("grafana", "grafana-secret", readPayload(t, "grafana.json")); err != nil || post == nil {
+		t.Errorf("expected post, got %v %v", post, err)
+	}
+	if _, err := s.Handle("grafana", "grafana-secret", []byte(`[]`)); err == nil {
+		t.Error("expected error with invalid payload")
+	}
+}
+
+func TestHandle_Dedup(t *testing.T) {
+	s, _, sent := newTestService(t, "CPU 使用率过高", nil)
+	now := time.Date(2024, 5, 20, 8, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	body := readPayload(t, "alertmanager.json")
+
+	post, _ := s.Handle("alertmanager", "secret", body)
+	if post == nil {
+		t.Fatal("first alert should be posted")
+	}
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		if post, _ := s.Handle("alertmanager", "secret", body); post != nil {
+			t.Fatal("duplicate alert within window should be grouped")
+		}
+	}
+	// 状态变化的告警不受去重影响
+	if post, _ := s.Handle("alertmanager", "secret", []byte(strings.ReplaceAll(string(body), `"firing"`, `"resolved"`))); post == nil {
+		t.Error("resolved alert should be posted")
+	}
+
+	now = now.Add(10 * time.Minute)
+	post, _ = s.Handle("alertmanager", "secret", body)
+	if post == nil || post.Repeated != 3 {
+		t.Fatalf("alert after window should be posted with repeated count, got %+v", post)
+	}
+	if err := s.Deliver(post); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 || !strings.Contains((*sent)[0].text, "重复推送 3 次") {
+		t.Errorf("unexpected message: %+v", *sent)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	s, prompts, sent := newTestService(t, "**两台节点 CPU 使用率超过 90%**，建议检查进程。", nil)
+	post, err := s.Handle("alertmanager", "secret", readPayload(t, "alertmanager.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deliver(post); err != nil {
+		t.Fatal(err)
+	}
+	if len(*prompts) != 1 || !strings.Contains((*prompts)[0], "运维值班工程师") || !strings.Contains((*prompts)[0], "10.0.1.13:9100") {
+		t.Errorf("default prompt should contain the payload, got %v", *prompts)
+	}
+	msg := (*sent)[0]
+	if msg.robotCode != "robot" || msg.group != "cid-ops" || msg.title != "[FIRING:2] HighCPUUsage" {
+		t.Errorf("unexpected target: %+v", msg)
+	}
+	if !strings.HasPrefix(msg.text, "### 🔥 [FIRING:2] HighCPUUsage") || !strings.Contains(msg.text, "CPU 使用率超过 90%") {
+		t.Errorf("unexpected text: %s", msg.text)
+	}
+
+	// 自定义模板
+	post, _ = s.Handle("grafana", "grafana-secret", readPayload(t, "grafana.json"))
+	_ = s.Deliver(post)
+	if !strings.HasPrefix((*prompts)[1], "总结 Grafana 的告警 [RESOLVED]") {
+		t.Errorf("unexpected custom prompt: %s", (*prompts)[1])
+	}
+	if !strings.HasPrefix((*sent)[1].text, "### ✅") {
+		t.Errorf("resolved alert should use resolved icon: %s", (*sent)[1].text)
+	}
+}
+
+func TestDeliver_SummaryFailed(t *testing.T) {
+	s, _, sent := newTestService(t, "", errors.New("rate limited"))
+	post, _ := s.Handle("alertmanager", "secret", readPayload(t, "alertmanager.json"))
+	if err := s.Deliver(post); err != nil {
+		t.Fatal(err)
+	}
+	text := (*sent)[0].text
+	if !strings.Contains(text, "rate limited") || !strings.Contains(text, "10.0.1.12:9100 CPU usage is above 90%") {
+		t.Errorf("failed summary should fall back to alert list: %s", text)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, hooks := range [][]config.Hook{
+		{{Name: "a/b", Group: "cid", Token: "t"}},
+		{{Name: "a", Group: "cid", Token: "t"}, {Name: "a", Group: "cid", Token: "t"}},
+		{{Name: "a", Token: "t"}},
+		{{Name: "a", Group: "cid"}},
+		{{Name: "a", Group: "cid", Token: "t", Prompt: "{{.Payload"}},
+	} {
+		if _, err := New(config.Webhook{Hooks: hooks}); err == nil {
+			t.Errorf("expected error with hooks %+v", hooks)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package hook
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 告警来源
+const (
+	SourceAlertmanager = "Alertmanager"
+	SourceGrafana      = "Grafana"
+	SourceGeneric      = "Webhook"
+)
+
+// 告警状态
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert 一条告警
+type Alert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    string            `json:"startsAt"`
+	Fingerprint string            `json:"fingerprint"`
+}
+
+// Name 告警名称
+func (a Alert) Name() string {
+	if name := a.Labels["alertname"]; name != "" {
+		return name
+	}
+	return a.Annotations["summary"]
+}
+
+// Payload 解析后的告警推送
+type Payload struct {
+	Source string
+	Status string
+	Title  string
+	Alerts []Alert
+	// Key 去重使用的标识，相同告警的推送得到相同的 Key
+	Key string
+	// Raw 格式化后的原始内容，交给模型总结
+	Raw string
+}
+
+// alertmanagerPayload Alertmanager 及 Grafana 统一告警的推送格式
+type alertmanagerPayload struct {
+	Status       string            `json:"status"`
+	Title        string            `json:"title"`
+	OrgID        *int64            `json:"orgId"`
+	CommonLabels map[string]string `json:"commonLabels"`
+	Alerts       []Alert           `json:"alerts"`
+}
+
+// grafanaLegacyPayload Grafana 旧版告警的推送格式
+type grafanaLegacyPayload struct {
+	Title    string `json:"title"`
+	RuleID   int64  `json:"ruleId"`
+	RuleName string `json:"ruleName"`
+	State    string `json:"state"`
+	Message  string `json:"message"`
+}
+
+// ParsePayload 解析告警推送，支持 Alertmanager、Grafana，其他 JSON 按通用告警处理
+func ParsePayload(body []byte) (Payload, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return Payload{}, fmt.Errorf("invalid json payload: %v", err)
+	}
+	if len(obj) == 0 {
+		return Payload{}, errors.New("empty payload")
+	}
+	raw, _ := json.MarshalIndent(obj, "", "  ")
+	p := Payload{Source: SourceGeneric, Raw: string(raw)}
+
+	switch {
+	case obj["alerts"] != nil:
+		var am alertmanagerPayload
+		if err := json.Unmarshal(body, &am); err != nil {
+			return Payload{}, fmt.Errorf("invalid alertmanager payload: %v", err)
+		}
+		p.Source = SourceAlertmanager
+		if am.OrgID != nil {
+			p.Source = SourceGrafana
+		}
+		p.Status = am.Status
+		p.Alerts = am.Alerts
+		p.Title = am.Title
+		if p.Title == "" {
+			p.Title = alertsTitle(am)
+		}
+		p.Key = alertsKey(am)
+	case obj["ruleName"] != nil || obj["evalMatches"] != nil:
+		var gl grafanaLegacyPayload
+		if err := json.Unmarshal(body, &gl); err != nil {
+			return Payload{}, fmt.Errorf("invalid grafana payload: %v", err)
+		}
+		p.Source = SourceGrafana
+		p.Status = StatusFiring
+		if gl.State == "ok" {
+			p.Status = StatusResolved
+		}
+		p.Title = gl.Title
+		if p.Title == "" {
+			p.Title = gl.RuleName
+		}
+		p.Key = fmt.Sprintf("grafana:%d:%s:%s", gl.RuleID, gl.RuleName, gl.State)
+	default:
+		for _, field := range []string{"title", "summary", "message", "text"} {
+			var s string
+			if json.Unmarshal(obj[field], &s) == nil && s != "" {
+				p.Title = s
+				break
+			}
+		}
+		// 通用告警没有指纹，使用按键排序后的内容计算
+		p.Key = fmt.Sprintf("sha256:%x", sha256.Sum256(raw))
+	}
+	if p.Title == "" {
+		p.Title = p.Source + " 告警"
+	}
+	return p, nil
+}
+
+// alertsTitle 与 Alertmanager 默认模板一致的标题，例如 [FIRING:2] HighCPU
+func alertsTitle(am alertmanagerPayload) string {
+	title := fmt.Sprintf("[%s:%d]", strings.ToUpper(am.Status), len(am.Alerts))
+	if name := am.CommonLabels["alertname"]; name != "" {
+		return title + " " + name
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, a := range am.Alerts {
+		if name := a.Name(); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.TrimSpace(title + " " + strings.Join(names, ", "))
+}
+
+// alertsKey 由状态及每条告警的指纹组成，同一组告警重复推送时不变，状态变化（恢复）时改变
+func alertsKey(am alertmanagerPayload) string {
+	var fps []string
+	for _, a := range am.Alerts {
+		fp := a.Fingerprint
+		if fp == "" {
+			fp = labelsKey(a.Labels)
+		}
+		fps = append(fps, a.Status+"/"+fp)
+	}
+	sort.Strings(fps)
+	return fmt.Sprintf("alerts:%s:%x", am.Status, sha256.Sum256([]byte(strings.Join(fps, "\n"))))
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package kb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Split 将文档切分为若干片段
+// 优先按段落（空行、Markdown 标题）切分，段落过长时再按句子和字数切分，相邻片段之间保留 overlap 个字符的重叠
+func Split(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = 500
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	var pieces []string
+	for _, p := range paragraphs(text) {
+		if utf8.RuneCountInString(p) <= size {
+			pieces = append(pieces, p)
+			continue
+		}
+		pieces = append(pieces, splitLong(p, size)...)
+	}
+
+	var chunks []string
+	cur := ""
+	for _, p := range pieces {
+		n := utf8.RuneCountInString(p)
+		if cur != "" && utf8.RuneCountInString(cur)+n+1 > size {
+			chunks = append(chunks, cur)
+			// 重叠的内容也算在片段长度内，放不下时缩短重叠
+			cur = tail(cur, min(overlap, size-n-1))
+		}
+		if cur == "" {
+			cur = p
+		} else {
+			cur += "\n" + p
+		}
+	}
+	if strings.TrimSpace(cur) != "" {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// paragraphs 按空行和 Markdown 标题切分段落
+func paragraphs(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var rst []string
+	var cur []string
+	flush := func() {
+		p := strings.TrimSpace(strings.Join(cur, "\n"))
+		if p != "" {
+			rst = append(rst, p)
+		}
+		cur = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			cur = append(cur, line)
+		default:
+			cur = append(cur, line)
+		}
+	}
+	flush()
+	return rst
+}
+
+// splitLong 将超长段落按句子切分，单句仍然过长时按字数硬切
+func splitLong(p string, size int) []string {
+	var rst []string
+	cur := []rune{}
+	for _, r := range p {
+		cur = append(cur, r)
+		if len(cur) >= size || (isSentenceEnd(r) && len(cur) >= size/2) {
+			rst = append(rst, strings.TrimSpace(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	if s := strings.TrimSpace(string(cur)); s != "" {
+		rst = append(rst, s)
+	}
+	return rst
+}
+
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '.', '!', '?', ';', '\n':
+		return true
+	}
+	return false
+}
+
+// tail 取字符串末尾 n 个字符
+func tail(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[len(runes)-n:])
+}
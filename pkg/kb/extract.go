@@ -0,0 +1,369 @@
+package kb
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedFile 不支持的文件类型
+var ErrUnsupportedFile = errors.New("unsupported file type, only text, markdown, docx and pdf are supported")
+
+// 解压后内容的总大小上限以及提取文本的字数上限，避免压缩炸弹耗尽内存，超出字数的内容直接丢弃
+const (
+	maxInflateBytes = 64 << 20
+	maxTextRunes    = 1 << 20
+)
+
+// Supported 判断文件类型是否可以提取文本
+func Supported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".docx", ".pdf":
+		return true
+	}
+	return plainText(name)
+}
+
+// plainText 可以直接读取的文本文件，包括日志、配置等
+func plainText(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".txt", ".log", ".csv", ".json", ".yaml", ".yml", ".conf", ".ini", ".xml":
+		return true
+	}
+	return false
+}
+
+// Extract 按文件类型提取文档中的文本
+func Extract(name string, data []byte) (string, error) {
+	var text string
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case plainText(name):
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("%s is not utf-8 encoded", name)
+		}
+		text = truncateRunes(string(data), maxTextRunes)
+	case ext == ".docx":
+		text, err = extractDocx(data)
+	case ext == ".pdf":
+		text, err = extractPDF(data)
+	default:
+		return "", ErrUnsupportedFile
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("no text found in %s", name)
+	}
+	return text, nil
+}
+
+// extractDocx 读取 word/document.xml 中的段落文本，标题段落转换为 Markdown 标题，便于按章节切分
+func extractDocx(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %v", err)
+	}
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			doc = f
+			break
+		}
+	}
+	if doc == nil {
+		return "", errors.New("invalid docx file: word/document.xml not found")
+	}
+	if doc.UncompressedSize64 > maxInflateBytes {
+		return "", fmt.Errorf("docx file is too large: %d bytes after decompression", doc.UncompressedSize64)
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var b, para strings.Builder
+	heading := false
+	inText := false
+	runes := 0
+	// 压缩包中记录的大小可能是伪造的，实际读取时同样限制大小
+	dec := xml.NewDecoder(io.LimitReader(rc, maxInflateBytes))
+	for runes < maxTextRunes {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid docx file: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteString("\t")
+			case "br", "cr":
+				para.WriteString("\n")
+			case "pStyle":
+				for _, attr := range t.Attr {
+					val := strings.ToLower(attr.Value)
+					if attr.Name.Local == "val" && (strings.HasPrefix(val, "heading") || strings.HasPrefix(val, "title")) {
+						heading = true
+					}
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if text := strings.TrimSpace(para.String()); text != "" {
+					if heading {
+						b.WriteString("# ")
+					}
+					b.WriteString(text)
+					b.WriteString("\n\n")
+					runes += utf8.RuneCountInString(text) + 2
+				}
+				para.Reset()
+				heading = false
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return truncateRunes(b.String(), maxTextRunes), nil
+}
+
+var pdfStreamRe = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+
+// extractPDF 尽力从 PDF 的内容流中提取文本
+// 只处理未压缩或 FlateDecode 压缩的内容流中的字符串，扫描件以及使用自定义字体编码的文档无法提取
+func extractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", errors.New("invalid pdf file")
+	}
+	var b strings.Builder
+	budget := int64(maxInflateBytes)
+	runes := 0
+	for _, m := range pdfStreamRe.FindAllSubmatch(data, -1) {
+		if budget <= 0 || runes >= maxTextRunes {
+			break
+		}
+		content := m[1]
+		if zr, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			// 所有内容流解压后的总大小不超过 maxInflateBytes
+			if inflated, err := io.ReadAll(io.LimitReader(zr, budget)); err == nil || len(inflated) > 0 {
+				content = inflated
+				budget -= int64(len(inflated))
+			}
+			zr.Close()
+		}
+		text := pdfContentText(content)
+		runes += utf8.RuneCountInString(text)
+		b.WriteString(text)
+	}
+	text := truncateRunes(b.String(), maxTextRunes)
+	if !readable(text) {
+		return "", errors.New("no readable text found in pdf, it may be a scanned document or use unsupported font encoding")
+	}
+	return text, nil
+}
+
+// pdfContentText 解析内容流中的文本操作符
+func pdfContentText(content []byte) string {
+	var b strings.Builder
+	var pending []string
+	inText := false
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteral(content[i:])
+			pending = append(pending, s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return b.String()
+			}
+			pending = append(pending, pdfHex(content[i+1:i+end]))
+			i += end + 1
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFOperatorChar(c):
+			start := i
+			for i < len(content) && isPDFOperatorChar(content[i]) {
+				i++
+			}
+			switch string(content[start:i]) {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				b.WriteString("\n")
+			case "Tj", "TJ":
+				if inText {
+					b.WriteString(strings.Join(pending, ""))
+				}
+			case "'", "\"":
+				if inText {
+					b.WriteString("\n" + strings.Join(pending, ""))
+				}
+			case "T*", "Td", "TD":
+				if inText {
+					b.WriteString("\n")
+				}
+			}
+			pending = pending[:0]
+		default:
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isPDFOperatorChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// pdfLiteral 解析 (...) 字符串，返回内容及消耗的字节数
+func pdfLiteral(data []byte) (string, int) {
+	var out []byte
+	depth := 0
+	i := 0
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					j := 0
+					for ; j < 3 && i+j < len(data) && data[i+j] >= '0' && data[i+j] <= '7'; j++ {
+						v = v*8 + int(data[i+j]-'0')
+					}
+					i += j - 1
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return pdfString(out), i
+}
+
+// pdfHex 解析 <...> 十六进制字符串
+func pdfHex(data []byte) string {
+	var out []byte
+	var hi byte
+	half := false
+	for _, c := range data {
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return pdfString(out)
+}
+
+// pdfString 带 BOM 的按 UTF-16BE 解码，否则按单字节编码处理
+func pdfString(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+		u := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			u = append(u, uint16(data[i])<<8|uint16(data[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, c := range data {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// readable 判断提取出的文本是否大部分为可读字符
+func readable(text string) bool {
+	total, good := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsPunct(r) {
+			good++
+		}
+	}
+	return total > 0 && good*10 >= total*8
+}
+
+// truncateRunes 截取前 n 个字符
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
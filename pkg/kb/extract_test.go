@@ -0,0 +1,71 @@
+package kb
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExtract_Docx(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>报销制度</w:t></w:r></w:p>
+<w:p><w:r><w:t>发票需在</w:t></w:r><w:r><w:t xml:space="preserve"> 30 天内</w:t></w:r><w:r><w:t>提交。</w:t></w:r></w:p>
+</w:body></w:document>`))
+	_ = zw.Close()
+
+	text, err := Extract("制度.docx", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# 报销制度\n\n发票需在 30 天内提交。\n\n"; text != want {
+		t.Errorf("docx text should be %q, but %q", want, text)
+	}
+}
+
+func TestExtract_DocxTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	// 压缩后只有几十 KB，解压后超过上限
+	_, _ = w.Write(bytes.Repeat([]byte(" "), maxInflateBytes+1))
+	_ = zw.Close()
+
+	if _, err := Extract("炸弹.docx", buf.Bytes()); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("docx over the decompression limit should fail, but %v", err)
+	}
+}
+
+func TestExtract_PDF(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj 0 -14 Td [(Wor) -20 (ld)] TJ ET"
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write([]byte("BT <FEFF62a59500> Tj ET"))
+	_ = zw.Close()
+	pdf := fmt.Sprintf("%%PDF-1.4\n1 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n2 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n%%%%EOF", len(content), content, z.Len(), z.String())
+
+	text, err := Extract("a.pdf", []byte(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Hello (PDF)", "World", "报销"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("pdf text should contain %q, but %q", want, text)
+		}
+	}
+}
+
+func TestExtract_Unsupported(t *testing.T) {
+	if _, err := Extract("a.xlsx", []byte("x")); err != ErrUnsupportedFile {
+		t.Errorf("xlsx should be unsupported, but %v", err)
+	}
+	if _, err := Extract("a.pdf", []byte("%PDF-1.4\n%%EOF")); err == nil {
+		t.Errorf("pdf without text should fail")
+	}
+}
@@ -0,0 +1,36 @@
+package kb
+
+// Index 只保存在内存中的单篇文档索引，用于会话附件等临时文档
+type Index struct {
+	Name   string
+	chunks []Chunk
+}
+
+// NewIndex 切分并向量化文档
+func NewIndex(embedder Embedder, name, text string, size, overlap int) (*Index, error) {
+	if embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	chunks, err := embedChunks(embedder, name, Split(text, size, overlap))
+	if err != nil {
+		return nil, err
+	}
+	return &Index{Name: name, chunks: chunks}, nil
+}
+
+// Chunks 文档片段数
+func (i *Index) Chunks() int {
+	return len(i.chunks)
+}
+
+// Search 检索与问题最相关的 k 个片段
+func (i *Index) Search(embedder Embedder, query string, k int, minScore float64) ([]Result, error) {
+	if embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	qv, err := embedQuery(embedder, query)
+	if err != nil {
+		return nil, err
+	}
+	return topK(searchChunks("", i.chunks, qv, minScore), k), nil
+}
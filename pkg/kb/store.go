@@ -0,0 +1,438 @@
+package kb
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCollection 默认集合名称
+const DefaultCollection = "default"
+
+// ErrNoEmbedder 未设置向量化接口
+var ErrNoEmbedder = errors.New("knowledge base embedder not set")
+
+// Embedder 文本向量化接口
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc 将普通函数适配为 Embedder
+type EmbedderFunc func(texts []string) ([][]float32, error)
+
+func (f EmbedderFunc) Embed(texts []string) ([][]float32, error) {
+	return f(texts)
+}
+
+// Chunk 文档片段及其向量
+type Chunk struct {
+	Doc    string
+	Text   string
+	Vector []float32
+}
+
+// Document 已入库的文档
+type Document struct {
+	Name      string
+	Hash      string
+	Chunks    int
+	UpdatedAt time.Time
+}
+
+// Result 检索结果
+type Result struct {
+	Collection string
+	Doc        string
+	Text       string
+	Score      float64
+}
+
+// collection 一个集合对应磁盘上的一个文件
+type collection struct {
+	Name   string
+	Docs   map[string]*Document
+	Chunks []Chunk
+}
+
+// Store 知识库，向量保存在内存中，按集合持久化到 dir 目录下
+type Store struct {
+	dir      string
+	size     int
+	overlap  int
+	embedder Embedder
+
+	mu          sync.RWMutex
+	collections map[string]*collection
+}
+
+// embedBatch 每次向量化的片段数量
+const embedBatch = 64
+
+// Open 打开知识库目录并加载已有集合
+func Open(dir string, size, overlap int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, size: size, overlap: overlap, collections: map[string]*collection{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		c, err := loadCollection(file)
+		if err != nil {
+			return nil, fmt.Errorf("load knowledge base %s: %v", file, err)
+		}
+		s.collections[c.Name] = c
+	}
+	return s, nil
+}
+
+// SetEmbedder 设置向量化接口
+func (s *Store) SetEmbedder(e Embedder) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedder = e
+}
+
+// ValidName 集合名称不能包含路径分隔符等特殊字符
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\:*?"<>| `)
+}
+
+// AddDocument 将文档切分、向量化后写入集合，同名文档会被替换，内容未变化时直接跳过
+// 返回文档的片段数
+func (s *Store) AddDocument(coll, name, text string) (int, error) {
+	if !ValidName(coll) {
+		return 0, fmt.Errorf("invalid collection name: %q", coll)
+	}
+	sum := sha256.Sum256([]byte(text))
+	hash := hex.EncodeToString(sum[:])
+
+	s.mu.RLock()
+	embedder := s.embedder
+	if c, ok := s.collections[coll]; ok {
+		if d, ok := c.Docs[name]; ok && d.Hash == hash {
+			s.mu.RUnlock()
+			return d.Chunks, nil
+		}
+	}
+	s.mu.RUnlock()
+	if embedder == nil {
+		return 0, ErrNoEmbedder
+	}
+
+	chunks, err := embedChunks(embedder, name, Split(text, s.size, s.overlap))
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[coll]
+	if !ok {
+		c = &collection{Name: coll, Docs: map[string]*Document{}}
+		s.collections[coll] = c
+	}
+	c.Chunks = append(removeDoc(c.Chunks, name), chunks...)
+	c.Docs[name] = &Document{Name: name, Hash: hash, Chunks: len(chunks), UpdatedAt: time.Now()}
+	return len(chunks), s.save(c)
+}
+
+// RemoveDocument 从集合中删除文档，文档不存在时返回 false
+func (s *Store) RemoveDocument(coll, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[coll]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := c.Docs[name]; !ok {
+		return false, nil
+	}
+	delete(c.Docs, name)
+	c.Chunks = removeDoc(c.Chunks, name)
+	if len(c.Docs) == 0 {
+		delete(s.collections, coll)
+		err := os.Remove(s.path(coll))
+		if err != nil && !os.IsNotExist(err) {
+			return true, err
+		}
+		return true, nil
+	}
+	return true, s.save(c)
+}
+
+// Collections 全部集合名称
+func (s *Store) Collections() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Documents 集合中的文档，按名称排序
+func (s *Store) Documents(coll string) []Document {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.collections[coll]
+	if !ok {
+		return nil
+	}
+	docs := make([]Document, 0, len(c.Docs))
+	for _, d := range c.Docs {
+		docs = append(docs, *d)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// Empty 知识库中是否没有任何文档
+func (s *Store) Empty() bool {
+	return len(s.Collections()) == 0
+}
+
+// Search 检索与问题最相关的 k 个片段，相似度低于 minScore 的片段会被忽略
+// colls 为空时检索全部集合
+func (s *Store) Search(query string, k int, minScore float64, colls ...string) ([]Result, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.RLock()
+	embedder := s.embedder
+	s.mu.RUnlock()
+	if embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	qv, err := embedQuery(embedder, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(colls) == 0 {
+		for name := range s.collections {
+			colls = append(colls, name)
+		}
+	}
+	var results []Result
+	for _, name := range colls {
+		if c, ok := s.collections[name]; ok {
+			results = append(results, searchChunks(name, c.Chunks, qv, minScore)...)
+		}
+	}
+	return topK(results, k), nil
+}
+
+// IngestDir 将目录下支持的文档导入集合，返回导入的文档数
+func (s *Store) IngestDir(coll, dir string) (int, error) {
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !Supported(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		text, err := Extract(path, data)
+		if err != nil {
+			return fmt.Errorf("ingest %s: %v", path, err)
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = filepath.Base(path)
+		}
+		if _, err := s.AddDocument(coll, filepath.ToSlash(name), text); err != nil {
+			return fmt.Errorf("ingest %s: %v", path, err)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// FormatReferences 将检索结果整理为提供给模型的参考资料，编号从 1 开始
+func FormatReferences(results []Result) string {
+	var b strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "[%d] 来源：%s\n%s", i+1, r.Doc, r.Text)
+	}
+	return b.String()
+}
+
+// Sources 检索结果对应的来源文档，按编号顺序去重
+func Sources(results []Result) []string {
+	var sources []string
+	seen := map[string]bool{}
+	for _, r := range results {
+		if !seen[r.Doc] {
+			seen[r.Doc] = true
+			sources = append(sources, r.Doc)
+		}
+	}
+	return sources
+}
+
+func (s *Store) path(coll string) string {
+	return filepath.Join(s.dir, coll+".gob")
+}
+
+// save 先写临时文件再替换，避免写入中断导致集合损坏
+func (s *Store) save(c *collection) error {
+	tmp := s.path(c.Name) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path(c.Name))
+}
+
+func loadCollection(file string) (*collection, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &collection{}
+	if err := gob.NewDecoder(f).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Docs == nil {
+		c.Docs = map[string]*Document{}
+	}
+	return c, nil
+}
+
+// embedChunks 分批向量化文档片段
+func embedChunks(embedder Embedder, name string, texts []string) ([]Chunk, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("document %s is empty", name)
+	}
+	chunks := make([]Chunk, 0, len(texts))
+	for i := 0; i < len(texts); i += embedBatch {
+		end := i + embedBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		vectors, err := embedder.Embed(texts[i:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != end-i {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), end-i)
+		}
+		for j, v := range vectors {
+			chunks = append(chunks, Chunk{Doc: name, Text: texts[i+j], Vector: normalize(v)})
+		}
+	}
+	return chunks, nil
+}
+
+func embedQuery(embedder Embedder, query string) ([]float32, error) {
+	vectors, err := embedder.Embed([]string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return normalize(vectors[0]), nil
+}
+
+func searchChunks(coll string, chunks []Chunk, qv []float32, minScore float64) []Result {
+	var results []Result
+	for _, chunk := range chunks {
+		score := dot(qv, chunk.Vector)
+		if score < minScore {
+			continue
+		}
+		results = append(results, Result{Collection: coll, Doc: chunk.Doc, Text: chunk.Text, Score: score})
+	}
+	return results
+}
+
+// topK 按相似度从高到低取前 k 个
+func topK(results []Result, k int) []Result {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+func removeDoc(chunks []Chunk, name string) []Chunk {
+	rst := chunks[:0]
+	for _, c := range chunks {
+		if c.Doc != name {
+			rst = append(rst, c)
+		}
+	}
+	return rst
+}
+
+// normalize 归一化向量，之后余弦相似度即为点积
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(sum))
+	rst := make([]float32, len(v))
+	for i, x := range v {
+		rst[i] = x / n
+	}
+	return rst
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
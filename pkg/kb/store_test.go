@@ -0,0 +1,152 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeEmbedder 按关键词出现次数生成向量，便于验证检索结果
+type fakeEmbedder struct {
+	calls int
+}
+
+var fakeWords = []string{"请假", "报销", "服务器", "密码"}
+
+func (f *fakeEmbedder) Embed(texts []string) ([][]float32, error) {
+	f.calls++
+	vectors := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, len(fakeWords)+1)
+		for j, w := range fakeWords {
+			v[j] = float32(strings.Count(t, w))
+		}
+		// 避免零向量
+		v[len(fakeWords)] = 0.1
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func TestSplit(t *testing.T) {
+	text := "# 标题\n\n第一段内容。\n\n第二段内容。\n\n" + strings.Repeat("很长的句子。", 30)
+	chunks := Split(text, 40, 5)
+	if len(chunks) < 3 {
+		t.Fatalf("text should be split into several chunks, but %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if n := len([]rune(c)); n > 40 {
+			t.Errorf("chunk too long: %d %q", n, c)
+		}
+	}
+	if !strings.HasPrefix(chunks[0], "# 标题") {
+		t.Errorf("first chunk should start with title, but %q", chunks[0])
+	}
+}
+
+func TestSplit_ChunkSizeWithOverlap(t *testing.T) {
+	var paragraphs []string
+	for i := 1; i <= 30; i++ {
+		paragraphs = append(paragraphs, strings.Repeat("字", i))
+	}
+	text := strings.Join(paragraphs, "\n\n")
+	for _, size := range []int{10, 31, 50} {
+		for _, overlap := range []int{0, 3, 9} {
+			for _, c := range Split(text, size, overlap) {
+				if n := len([]rune(c)); n > size {
+					t.Errorf("size %d overlap %d: chunk too long: %d %q", size, overlap, n, c)
+				}
+			}
+		}
+	}
+}
+
+func TestStore_SearchAndPersist(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	_ = os.MkdirAll(filepath.Join(docs, "hr"), 0755)
+	_ = os.WriteFile(filepath.Join(docs, "hr", "leave.md"), []byte("# 请假制度\n\n请假需要提前在系统中提交请假申请。"), 0644)
+	_ = os.WriteFile(filepath.Join(docs, "ops.txt"), []byte("服务器密码每季度轮换一次，服务器登录需要走堡垒机。"), 0644)
+	_ = os.WriteFile(filepath.Join(docs, "image.png"), []byte("not a document"), 0644)
+
+	e := &fakeEmbedder{}
+	s, err := Open(filepath.Join(dir, "kb"), 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Search("请假", 1, 0); err != ErrNoEmbedder {
+		t.Errorf("search without embedder should fail, but %v", err)
+	}
+	s.SetEmbedder(e)
+	count, err := s.IngestDir(DefaultCollection, docs)
+	if err != nil || count != 2 {
+		t.Fatalf("should ingest 2 docs, got %d, %v", count, err)
+	}
+
+	results, err := s.Search("怎么请假", 1, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Doc != "hr/leave.md" {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	if refs := FormatReferences(results); !strings.HasPrefix(refs, "[1] 来源：hr/leave.md\n") {
+		t.Errorf("unexpected references: %q", refs)
+	}
+	if results, _ := s.Search("报销", 4, 0.5); len(results) != 0 {
+		t.Errorf("unrelated chunks should be filtered, but %#v", results)
+	}
+
+	// 重新打开后数据仍在，内容未变化的文档不会重复向量化
+	s2, err := Open(filepath.Join(dir, "kb"), 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2 := &fakeEmbedder{}
+	s2.SetEmbedder(e2)
+	if _, err := s2.IngestDir(DefaultCollection, docs); err != nil {
+		t.Fatal(err)
+	}
+	if e2.calls != 0 {
+		t.Errorf("unchanged docs should not be embedded again, but %d calls", e2.calls)
+	}
+	results, _ = s2.Search("服务器", 1, 0.5)
+	if len(results) != 1 || results[0].Doc != "ops.txt" {
+		t.Errorf("unexpected results after reopen: %#v", results)
+	}
+
+	ok, err := s2.RemoveDocument(DefaultCollection, "ops.txt")
+	if !ok || err != nil {
+		t.Fatalf("remove should succeed, got %v, %v", ok, err)
+	}
+	if docs := s2.Documents(DefaultCollection); len(docs) != 1 || docs[0].Name != "hr/leave.md" {
+		t.Errorf("unexpected documents: %#v", docs)
+	}
+	if results, _ := s2.Search("服务器", 4, 0.5); len(results) != 0 {
+		t.Errorf("removed doc should not be found, but %#v", results)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{"default": true, "运维": true, "": false, "..": false, "a/b": false} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) should be %v", name, want)
+		}
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	text := "服务器登录需要走堡垒机。\n\n报销需要提供发票。\n\n请假需要提前申请。"
+	idx, err := NewIndex(&fakeEmbedder{}, "a.log", text, 12, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Chunks() != 3 {
+		t.Errorf("index should have 3 chunks, but %d", idx.Chunks())
+	}
+	results, err := idx.Search(&fakeEmbedder{}, "报销流程", 1, 0)
+	if err != nil || len(results) != 1 || results[0].Text != "报销需要提供发票。" {
+		t.Errorf("unexpected results: %#v, %v", results, err)
+	}
+}
@@ -1,23 +1,19 @@
 package llm
 
-import (
-	"context"
-
-	"github.com/eryajf/chatgpt-dingtalk/public"
-)
+import "context"
 
 // SingleQa 单聊
-func SingleQa(question, userId string) (string, error) {
-	client := NewClient(userId)
+func SingleQa(question, userId string, opts ...Option) (string, error) {
+	client := NewClient(userId).apply(opts)
 	defer client.Close()
 
 	return client.ChatWithContext(question)
 }
 
 // ContextQa 串聊
-func ContextQa(question, userId string) (*Client, string, error) {
-	client := NewClient(userId)
-	if public.UserService.GetUserSessionContext(userId) != "" {
+func ContextQa(question, userId string, opts ...Option) (*Client, string, error) {
+	client := NewClient(userId).apply(opts)
+	if sessionContext(userId) != "" {
 		_ = client.ChatContext.LoadConversation(userId)
 	}
 
@@ -25,6 +21,27 @@ func ContextQa(question, userId string) (*Client, string, error) {
 	return client, answer, err
 }
 
+// RetryQa 串聊中去掉最后一轮问答后重新提问，question 为空时重新回答原来的问题，返回实际提问的问题。
+// 成功后需要调用 SaveConversation 保存新的上下文
+func RetryQa(question, userId string, opts ...Option) (*Client, string, string, error) {
+	client := NewClient(userId).apply(opts)
+	if err := client.ChatContext.LoadConversation(userId); err != nil {
+		return client, "", "", ErrNoLastTurn
+	}
+	lastQuestion, images, ok := client.ChatContext.dropLastTurn()
+	if !ok {
+		return client, "", "", ErrNoLastTurn
+	}
+	if question == "" {
+		question = lastQuestion
+		if client.images == nil {
+			client.images = images
+		}
+	}
+	answer, err := client.ChatWithContext(question)
+	return client, question, answer, err
+}
+
 // ImageQa 生成图片
 func ImageQa(ctx context.Context, question, userId string) (string, error) {
 	client := NewClient(userId)
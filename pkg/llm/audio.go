@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// Transcribe 调用模型服务的语音转写接口，filename 用于告知接口音频格式
+func Transcribe(filename string, data []byte) (string, error) {
+	client := NewClient("")
+	defer client.Close()
+
+	return client.Transcribe(filename, data)
+}
+
+// Transcribe 语音转文字
+func (c *Client) Transcribe(filename string, data []byte) (string, error) {
+	resp, err := c.client.CreateTranscription(c.ctx, openai.AudioRequest{
+		Model:    public.Config.Voice.TranscribeModel,
+		FilePath: filename,
+		Reader:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// Speech 调用模型服务的语音合成接口，返回 mp3 音频及时长（毫秒）
+func Speech(text string) ([]byte, int, error) {
+	client := NewClient("")
+	defer client.Close()
+
+	return client.Speech(text)
+}
+
+// Speech 文字转语音，钉钉语音消息有大小限制，使用 mp3 格式
+func (c *Client) Speech(text string) ([]byte, int, error) {
+	resp, err := c.client.CreateSpeech(c.ctx, openai.CreateSpeechRequest{
+		Model:          openai.SpeechModel(public.Config.Voice.TTSModel),
+		Voice:          openai.SpeechVoice(public.Config.Voice.TTSVoice),
+		Input:          text,
+		ResponseFormat: openai.SpeechResponseFormatMp3,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Close()
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	duration, err := Mp3Duration(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, duration, nil
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1 Layer III
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2/2.5 Layer III
+	}
+	mp3SampleRates = map[byte][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// Mp3Duration 累加 mp3 各帧的采样数计算时长（毫秒），只支持 Layer III
+func Mp3Duration(data []byte) (int, error) {
+	i := 0
+	// 跳过 ID3v2 标签
+	if len(data) >= 10 && string(data[0:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		i = 10 + size
+		if data[5]&0x10 != 0 {
+			i += 10
+		}
+	}
+	seconds := 0.0
+	frames := 0
+	for i+4 <= len(data) {
+		b1, b2 := data[i+1], data[i+2]
+		version, layer := (b1>>3)&3, (b1>>1)&3
+		rates, ok := mp3SampleRates[version]
+		if data[i] != 0xff || b1&0xe0 != 0xe0 || layer != 1 || !ok || (b2>>2)&3 == 3 {
+			// 不是帧头时逐字节向后查找，跳过结尾的 ID3v1 标签等内容
+			i++
+			continue
+		}
+		mpeg1 := version == 3
+		table, coef, samples := 1, 72000, 576
+		if mpeg1 {
+			table, coef, samples = 0, 144000, 1152
+		}
+		bitrate := mp3Bitrates[table][b2>>4]
+		if bitrate == 0 {
+			i++
+			continue
+		}
+		rate := rates[(b2>>2)&3]
+		i += coef*bitrate/rate + int((b2>>1)&1)
+		seconds += float64(samples) / float64(rate)
+		frames++
+	}
+	if frames == 0 {
+		return 0, errors.New("no mp3 frame found")
+	}
+	return int(seconds * 1000), nil
+}
@@ -0,0 +1,30 @@
+package llm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// mp3Frames 生成 n 个 MPEG-1 Layer III、128kbps、44100Hz 的帧，每帧 417 字节
+func mp3Frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+func TestMp3Duration(t *testing.T) {
+	// 100 帧 * 1152 采样 / 44100Hz ≈ 2612ms
+	if d, err := Mp3Duration(mp3Frames(100)); err != nil || d != 2612 {
+		t.Errorf("duration should be 2612ms, but %d, %v", d, err)
+	}
+	// 带有 ID3v2 标签以及结尾的 ID3v1 标签
+	data := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}, make([]byte, 20)...)
+	data = append(data, mp3Frames(50)...)
+	data = append(data, append([]byte("TAG"), make([]byte, 125)...)...)
+	if d, err := Mp3Duration(data); err != nil || d != 1306 {
+		t.Errorf("duration should be 1306ms, but %d, %v", d, err)
+	}
+	if _, err := Mp3Duration([]byte("RIFF")); err == nil {
+		t.Errorf("invalid data should fail")
+	}
+}
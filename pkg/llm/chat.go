@@ -14,35 +14,40 @@ func (c *Client) ChatWithContext(question string) (string, error) {
 	}
 
 	// 构建消息列表
-	messages := c.buildMessages(question)
+	messages, vision := c.buildMessages(question)
 
-	model := public.Config.Model
 	userId := c.userId
 	if public.Config.AzureOn {
 		userId = ""
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model:       model,
+		Model:       c.requestModel(vision),
 		Messages:    messages,
 		MaxTokens:   c.maxAnswerLen,
-		Temperature: 0.6,
+		Temperature: c.temperature,
 		User:        userId,
 	}
 
-	resp, err := c.client.CreateChatCompletion(c.ctx, req)
-	if err != nil {
-		return "", err
+	// 模型请求调用工具时执行工具并把结果交回模型，直到模型给出回答
+	var answer string
+	for step := 0; ; step++ {
+		c.prepareTools(&req, step)
+		resp, err := c.client.CreateChatCompletion(c.ctx, req)
+		if err != nil {
+			return "", err
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || step >= maxToolSteps() {
+			answer = msg.Content
+			break
+		}
+		req.Messages = append(req.Messages, msg)
+		req.Messages = append(req.Messages, c.runTools(msg.ToolCalls)...)
 	}
 
-	answer := resp.Choices[0].Message.Content
-
 	// 保存对话上下文
-	c.ChatContext.old = append(c.ChatContext.old,
-		conversation{Role: c.ChatContext.humanRole, Prompt: question},
-		conversation{Role: c.ChatContext.aiRole, Prompt: answer},
-	)
-	c.ChatContext.seqTimes++
+	c.ChatContext.appendTurn(question, c.images, answer)
 
 	return answer, nil
 }
@@ -8,6 +8,7 @@ import (
 
 	openai "github.com/sashabaranov/go-openai"
 
+	"github.com/eryajf/chatgpt-dingtalk/pkg/tools"
 	"github.com/eryajf/chatgpt-dingtalk/public"
 )
 
@@ -21,6 +22,20 @@ type Client struct {
 	timeOut        time.Duration
 	doneChan       chan struct{}
 	cancel         func()
+	// 知识库参考资料
+	references string
+	// 本次提问附带的图片
+	images []string
+	// 允许模型调用的工具
+	tools    []tools.Tool
+	toolHook ToolHook
+	// 流式请求出错时的回调
+	onStreamError func(error)
+	// 确定模型后的回调
+	onModel func(string)
+	// 本次请求使用的模型，为空时使用配置中的模型
+	model       string
+	temperature float32
 
 	ChatContext *Context
 }
@@ -75,10 +90,35 @@ func NewClient(userId string) *Client {
 		timeOut:        public.Config.SessionTimeout,
 		doneChan:       timeOutChan,
 		cancel:         cancel,
+		temperature:    DefaultTemperature,
 		ChatContext:    NewContext(),
 	}
 }
 
+// DefaultTemperature 对话请求默认的 temperature
+const DefaultTemperature float32 = 0.6
+
+// chatModel 返回本次请求使用的模型，带有图片时使用识图模型
+func (c *Client) chatModel(vision bool) string {
+	switch {
+	case c.model != "":
+		return c.model
+	case vision:
+		return public.Config.VisionModel
+	default:
+		return public.Config.Model
+	}
+}
+
+// requestModel 返回本次请求使用的模型，并通知 OnModel 回调
+func (c *Client) requestModel(vision bool) string {
+	model := c.chatModel(vision)
+	if c.onModel != nil {
+		c.onModel(model)
+	}
+	return model
+}
+
 func (c *Client) Close() {
 	c.cancel()
 }
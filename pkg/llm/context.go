@@ -38,12 +38,74 @@ type ContextOption func(*Context)
 type conversation struct {
 	Role   *role
 	Prompt string
+	// 提问附带的图片，保存的是本地文件路径
+	Images []string
 }
 
 type role struct {
 	Name string
 }
 
+// ConversationStore 对话上下文的持久化存储：缓存中没有上下文时从存储中恢复，保存和清空上下文时同步到存储
+type ConversationStore interface {
+	Load(userid string) string
+	Save(userid, content string)
+	Clear(userid string)
+}
+
+// Store 对话上下文的持久化存储，为空时上下文只保存在缓存中
+var Store ConversationStore
+
+// sessionContext 读取用户的对话上下文，缓存中没有时从存储中恢复
+func sessionContext(userid string) string {
+	content := public.UserService.GetUserSessionContext(userid)
+	if content == "" && Store != nil {
+		if content = Store.Load(userid); content != "" {
+			public.UserService.SetUserSessionContext(userid, content)
+		}
+	}
+	return content
+}
+
+// ClearConversation 清空用户的对话上下文
+func ClearConversation(userid string) {
+	public.UserService.ClearUserSessionContext(userid)
+	if Store != nil {
+		Store.Clear(userid)
+	}
+}
+
+// HistoryText 把保存的对话上下文整理成文本，超过 maxRunes 时截断，用于生成话题标题
+func HistoryText(content string, maxRunes int) string {
+	var old []conversation
+	if err := gob.NewDecoder(strings.NewReader(content)).Decode(&old); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, v := range old {
+		name := DefaultAiRole
+		if v.Role != nil {
+			name = v.Role.Name
+		}
+		b.WriteString(name + ": " + v.Prompt + "\n")
+	}
+	text := []rune(b.String())
+	if len(text) > maxRunes {
+		text = text[:maxRunes]
+	}
+	return string(text)
+}
+
+// appendTurn 把一轮问答追加到对话上下文，回答中的敏感信息先脱敏，避免再发给模型或保存到话题中
+func (c *Context) appendTurn(question string, images []string, answer string) {
+	answer, _ = public.SecretGuard.Scan(answer)
+	c.old = append(c.old,
+		conversation{Role: c.humanRole, Prompt: question, Images: images},
+		conversation{Role: c.aiRole, Prompt: answer},
+	)
+	c.seqTimes++
+}
+
 func NewContext(options ...ContextOption) *Context {
 	ctx := &Context{
 		aiRole:           &role{Name: DefaultAiRole},
@@ -70,7 +132,7 @@ func (c *Context) PollConversation() {
 }
 
 func (c *Context) ResetConversation(userid string) {
-	public.UserService.ClearUserSessionContext(userid)
+	ClearConversation(userid)
 }
 
 func (c *Context) SaveConversation(userid string) error {
@@ -81,11 +143,14 @@ func (c *Context) SaveConversation(userid string) error {
 		return err
 	}
 	public.UserService.SetUserSessionContext(userid, buffer.String())
+	if Store != nil {
+		Store.Save(userid, buffer.String())
+	}
 	return nil
 }
 
 func (c *Context) LoadConversation(userid string) error {
-	dec := gob.NewDecoder(strings.NewReader(public.UserService.GetUserSessionContext(userid)))
+	dec := gob.NewDecoder(strings.NewReader(sessionContext(userid)))
 	err := dec.Decode(&c.old)
 	if err != nil {
 		return err
@@ -137,3 +202,50 @@ func WithMaintainSeqTimes(maintain bool) ContextOption {
 		c.maintainSeqTimes = maintain
 	}
 }
+
+// dropLastTurn 去掉最后一轮问答，返回这轮的问题和图片，最后两条不是一问一答时返回 false
+func (c *Context) dropLastTurn() (string, []string, bool) {
+	n := len(c.old)
+	if n < 2 {
+		return "", nil, false
+	}
+	human, ai := c.old[n-2], c.old[n-1]
+	if human.Role == nil || ai.Role == nil || human.Role.Name != c.humanRole.Name || ai.Role.Name != c.aiRole.Name {
+		return "", nil, false
+	}
+	c.old = c.old[:n-2]
+	if c.seqTimes > 0 {
+		c.seqTimes--
+	}
+	return human.Prompt, human.Images, true
+}
+
+// AppendHistory 把一轮问答追加到用户的对话上下文末尾，之前的上下文会保留，之后的串聊会基于这轮问答继续
+func AppendHistory(userid, question, answer string) error {
+	c := NewContext()
+	if sessionContext(userid) != "" {
+		if err := c.LoadConversation(userid); err != nil {
+			return err
+		}
+	}
+	c.appendTurn(question, nil, answer)
+	return c.SaveConversation(userid)
+}
+
+// ReplaceLastAnswer 替换用户对话上下文中最后一条回答，上下文为空或最后一条不是回答时不做处理
+func ReplaceLastAnswer(userid, answer string) error {
+	if sessionContext(userid) == "" {
+		return nil
+	}
+	c := NewContext()
+	if err := c.LoadConversation(userid); err != nil {
+		return err
+	}
+	// 从缓存解码出来的角色不再是同一个指针，按名字比较
+	last := len(c.old) - 1
+	if last < 0 || c.old[last].Role == nil || c.old[last].Role.Name != c.aiRole.Name {
+		return nil
+	}
+	c.old[last].Prompt = answer
+	return c.SaveConversation(userid)
+}
@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/cache"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// roundTrip 模拟上下文保存到缓存后再读取
+func roundTrip(t *testing.T, c *Context) *Context {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c.old); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewContext()
+	if err := gob.NewDecoder(&buf).Decode(&loaded.old); err != nil {
+		t.Fatal(err)
+	}
+	loaded.seqTimes = len(loaded.old) / 2
+	return loaded
+}
+
+func TestBuildMessages_Roles(t *testing.T) {
+	c := NewContext()
+	c.old = []conversation{
+		{Role: c.humanRole, Prompt: "q1"},
+		{Role: c.aiRole, Prompt: "a1"},
+	}
+	client := &Client{ChatContext: roundTrip(t, c)}
+	messages, _ := client.buildMessages("q2")
+	want := []string{"user", "assistant", "user"}
+	if len(messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(want))
+	}
+	for i, m := range messages {
+		if m.Role != want[i] {
+			t.Errorf("message %d role = %s, want %s", i, m.Role, want[i])
+		}
+	}
+}
+
+func TestDropLastTurn(t *testing.T) {
+	c := NewContext()
+	c.old = []conversation{
+		{Role: c.humanRole, Prompt: "q1"},
+		{Role: c.aiRole, Prompt: "a1"},
+		{Role: c.humanRole, Prompt: "q2", Images: []string{"a.png"}},
+		{Role: c.aiRole, Prompt: "a2"},
+	}
+	loaded := roundTrip(t, c)
+	q, images, ok := loaded.dropLastTurn()
+	if !ok || q != "q2" || len(images) != 1 || len(loaded.old) != 2 || loaded.seqTimes != 1 {
+		t.Fatalf("unexpected result %q %v %v, old %d", q, images, ok, len(loaded.old))
+	}
+	if q, _, ok = loaded.dropLastTurn(); !ok || q != "q1" || len(loaded.old) != 0 {
+		t.Fatalf("unexpected result %q %v", q, ok)
+	}
+	if _, _, ok = loaded.dropLastTurn(); ok {
+		t.Error("expected no turn to drop")
+	}
+}
+
+func TestHistoryText(t *testing.T) {
+	c := NewContext()
+	c.old = []conversation{
+		{Role: c.humanRole, Prompt: "周报怎么写"},
+		{Role: c.aiRole, Prompt: "按本周进展来写"},
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c.old); err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultHumanRole + ": 周报怎么写\n" + DefaultAiRole + ": 按本周进展来写\n"
+	if got := HistoryText(buf.String(), 100); got != want {
+		t.Errorf("HistoryText() = %q, want %q", got, want)
+	}
+	if got := HistoryText(buf.String(), 5); len([]rune(got)) != 5 {
+		t.Errorf("HistoryText() should be truncated to 5 runes, got %q", got)
+	}
+	if got := HistoryText("broken", 100); got != "" {
+		t.Errorf("HistoryText() of broken content = %q, want empty", got)
+	}
+}
+
+// fakeSessions 只实现对话上下文的读写，上下文保存在内存中
+type fakeSessions struct {
+	cache.UserServiceInterface
+	m map[string]string
+}
+
+func (f fakeSessions) GetUserSessionContext(userId string) string { return f.m[userId] }
+
+func (f fakeSessions) SetUserSessionContext(userId, content string) { f.m[userId] = content }
+
+func TestAppendHistory_KeepsContext(t *testing.T) {
+	users, store := public.UserService, Store
+	public.UserService, Store = fakeSessions{m: map[string]string{}}, nil
+	t.Cleanup(func() { public.UserService, Store = users, store })
+
+	c := NewContext()
+	c.appendTurn("q1", nil, "a1")
+	if err := c.SaveConversation("u"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendHistory("u", "q2", "a2"); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewContext()
+	if err := loaded.LoadConversation("u"); err != nil {
+		t.Fatal(err)
+	}
+	var prompts []string
+	for _, v := range loaded.old {
+		prompts = append(prompts, v.Prompt)
+	}
+	if len(prompts) != 4 || prompts[0] != "q1" || prompts[3] != "a2" {
+		t.Errorf("expected the card turn appended to the existing context, got %q", prompts)
+	}
+
+	if err := AppendHistory("new", "q", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.LoadConversation("new"); err != nil || len(loaded.old) != 2 {
+		t.Errorf("expected a single turn for a user without context, got %d (%v)", len(loaded.old), err)
+	}
+}
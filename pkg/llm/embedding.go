@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// Embed 调用模型服务的向量化接口
+func Embed(texts []string) ([][]float32, error) {
+	client := NewClient("")
+	defer client.Close()
+
+	return client.Embed(texts)
+}
+
+// Embed 文本向量化，返回的向量与输入一一对应
+func (c *Client) Embed(texts []string) ([][]float32, error) {
+	resp, err := c.client.CreateEmbeddings(c.ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(public.Config.KnowledgeBase.EmbeddingModel),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding result count mismatch: want %d, got %d", len(texts), len(resp.Data))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding result index out of range: %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -7,4 +7,5 @@ var (
 	ErrOverMaxAnswerLength   = errors.New("maximum answer length exceeded")
 	ErrOverMaxTextLength     = errors.New("maximum text length exceeded")
 	ErrOverMaxSequenceTimes  = errors.New("maximum number of sequence exceeded")
+	ErrNoLastTurn            = errors.New("no previous turn in context")
 )
@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"encoding/json"
+	"sort"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Moderate 调用模型服务的内容审核接口，返回命中的分类
+func Moderate(text string) ([]string, error) {
+	client := NewClient("")
+	defer client.Close()
+
+	return client.Moderate(text)
+}
+
+// Moderate 内容审核
+func (c *Client) Moderate(text string) ([]string, error) {
+	resp, err := c.client.Moderations(c.ctx, openai.ModerationRequest{
+		Input: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var categories []string
+	for _, rst := range resp.Results {
+		if !rst.Flagged {
+			continue
+		}
+		// 分类字段较多且会随接口升级增加，借助 json tag 统一取出命中的分类名称
+		var flags map[string]bool
+		data, err := json.Marshal(rst.Categories)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &flags); err != nil {
+			return nil, err
+		}
+		for name, flagged := range flags {
+			if flagged {
+				categories = append(categories, name)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"math"
+)
+
+// Option 单次请求的可选参数
+type Option func(*Client)
+
+// WithReferences 注入知识库检索到的参考资料，仅在本次请求中生效，不会写入对话上下文
+func WithReferences(references string) Option {
+	return func(c *Client) {
+		c.references = references
+	}
+}
+
+// WithImages 本次提问附带的图片，传入本地文件路径，图片路径会随对话上下文一起保存
+func WithImages(paths ...string) Option {
+	return func(c *Client) {
+		c.images = paths
+	}
+}
+
+// WithContext 本次请求随 ctx 一起取消，用于停止正在生成的回答
+func WithContext(ctx context.Context) Option {
+	return func(c *Client) {
+		inner, cancel := context.WithCancel(c.ctx)
+		stop := context.AfterFunc(ctx, cancel)
+		prev := c.cancel
+		c.ctx = inner
+		c.cancel = func() {
+			stop()
+			cancel()
+			prev()
+		}
+	}
+}
+
+// WithModel 本次请求使用指定的模型
+func WithModel(model string) Option {
+	return func(c *Client) {
+		c.model = model
+	}
+}
+
+// zeroTemperature 请求中为 0 的 temperature 会被省略而使用服务端的默认值，按 go-openai 的建议用最小的非零值代替 0
+const zeroTemperature float32 = math.SmallestNonzeroFloat32
+
+// WithTemperature 本次请求使用指定的 temperature
+func WithTemperature(temperature float32) Option {
+	if temperature == 0 {
+		temperature = zeroTemperature
+	}
+	return func(c *Client) {
+		c.temperature = temperature
+	}
+}
+
+// OnStreamError 流式请求出错时回调，出错前已经输出的内容仍会写入流中
+func OnStreamError(fn func(error)) Option {
+	return func(c *Client) {
+		c.onStreamError = fn
+	}
+}
+
+// OnModel 确定本次请求使用的模型后回调，用于记录回答是由哪个模型生成的
+func OnModel(fn func(model string)) Option {
+	return func(c *Client) {
+		c.onModel = fn
+	}
+}
+
+// streamError 通知流式请求出错
+func (c *Client) streamError(err error) {
+	if c.onStreamError != nil {
+		c.onStreamError(err)
+	}
+}
+
+// ReferencePrompt 参考资料的系统提示
+const ReferencePrompt = "以下是从知识库或用户上传的文件中检索到的参考资料，每段资料以 [编号] 开头并注明来源。请优先依据参考资料回答问题，在引用资料的地方用 [编号] 标注出处，并在回答末尾列出引用的来源；如果参考资料与问题无关或不足以回答，请如实说明。\n\n"
+
+func (c *Client) apply(opts []Option) *Client {
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHistory 在本次请求的对话上下文末尾追加一轮问答，用于基于某个回答继续提问
+func WithHistory(question, answer string) Option {
+	return func(c *Client) {
+		c.ChatContext.old = append(c.ChatContext.old,
+			conversation{Role: c.ChatContext.humanRole, Prompt: question},
+			conversation{Role: c.ChatContext.aiRole, Prompt: answer},
+		)
+		c.ChatContext.seqTimes++
+	}
+}
@@ -0,0 +1,17 @@
+package llm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWithTemperature_Zero(t *testing.T) {
+	c := (&Client{}).apply([]Option{WithTemperature(0)})
+	if c.temperature != math.SmallestNonzeroFloat32 {
+		t.Errorf("expected the smallest non-zero temperature so it is sent in the request, got %v", c.temperature)
+	}
+	c = (&Client{}).apply([]Option{WithTemperature(0.2)})
+	if c.temperature != 0.2 {
+		t.Errorf("expected temperature 0.2, got %v", c.temperature)
+	}
+}
@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"context"
 	"errors"
 	"io"
 
@@ -17,19 +18,18 @@ func (c *Client) ChatWithContextStream(question string) (<-chan string, error) {
 	}
 
 	// 构建消息列表
-	messages := c.buildMessages(question)
+	messages, vision := c.buildMessages(question)
 
-	model := public.Config.Model
 	userId := c.userId
 	if public.Config.AzureOn {
 		userId = ""
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model:       model,
+		Model:       c.requestModel(vision),
 		Messages:    messages,
 		MaxTokens:   c.maxAnswerLen,
-		Temperature: 0.6,
+		Temperature: c.temperature,
 		User:        userId,
 		Stream:      true,
 	}
@@ -39,74 +39,134 @@ func (c *Client) ChatWithContextStream(question string) (<-chan string, error) {
 	go func() {
 		defer close(contentCh)
 
-		stream, err := c.client.CreateChatCompletionStream(c.ctx, req)
-		if err != nil {
-			contentCh <- err.Error()
-			return
-		}
-		defer stream.Close()
-
 		fullAnswer := ""
-		for {
-			response, err := stream.Recv()
-			if errors.Is(err, io.EOF) {
-				break
-			}
+		for step := 0; ; step++ {
+			c.prepareTools(&req, step)
+			content, calls, err := c.streamOnce(req, contentCh)
+			fullAnswer += content
 			if err != nil {
+				c.streamError(err)
+				if errors.Is(c.ctx.Err(), context.Canceled) {
+					// 主动停止时不输出错误信息，已经输出的内容仍然保存到对话上下文
+					if fullAnswer != "" {
+						c.ChatContext.appendTurn(question, c.images, fullAnswer)
+					}
+					return
+				}
 				if fullAnswer == "" {
 					contentCh <- err.Error()
 				}
 				return
 			}
-
-			if len(response.Choices) > 0 {
-				delta := response.Choices[0].Delta.Content
-				if delta != "" {
-					fullAnswer += delta
-					contentCh <- delta
-				}
+			if len(calls) == 0 || step >= maxToolSteps() {
+				break
 			}
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   content,
+				ToolCalls: calls,
+			})
+			req.Messages = append(req.Messages, c.runTools(calls)...)
 		}
 
 		// 保存对话上下文
-		c.ChatContext.old = append(c.ChatContext.old,
-			conversation{Role: c.ChatContext.humanRole, Prompt: question},
-			conversation{Role: c.ChatContext.aiRole, Prompt: fullAnswer},
-		)
-		c.ChatContext.seqTimes++
+		c.ChatContext.appendTurn(question, c.images, fullAnswer)
 	}()
 
 	return contentCh, nil
 }
 
-// buildMessages 构建消息列表
-func (c *Client) buildMessages(question string) []openai.ChatCompletionMessage {
+// streamOnce 发起一次流式请求，内容实时写入 contentCh，返回本轮的内容和模型请求调用的工具
+func (c *Client) streamOnce(req openai.ChatCompletionRequest, contentCh chan<- string) (string, []openai.ToolCall, error) {
+	stream, err := c.client.CreateChatCompletionStream(c.ctx, req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer stream.Close()
+
+	content := ""
+	var calls []openai.ToolCall
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return content, nil, err
+		}
+
+		if len(response.Choices) > 0 {
+			delta := response.Choices[0].Delta
+			if delta.Content != "" {
+				content += delta.Content
+				contentCh <- delta.Content
+			}
+			for _, tc := range delta.ToolCalls {
+				calls = mergeToolCall(calls, tc)
+			}
+		}
+	}
+	return content, calls, nil
+}
+
+// buildMessages 构建消息列表，消息中带有图片时返回 true
+func (c *Client) buildMessages(question string) ([]openai.ChatCompletionMessage, bool) {
 	var messages []openai.ChatCompletionMessage
 
+	// 添加知识库参考资料
+	if c.references != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    "system",
+			Content: ReferencePrompt + c.references,
+		})
+	}
+
+	// 历史对话中的图片只保留最近的几张，避免请求过大
+	budget := maxImages - len(c.images)
+	keep := make([]int, len(c.ChatContext.old))
+	for i := len(c.ChatContext.old) - 1; i >= 0 && budget > 0; i-- {
+		n := len(c.ChatContext.old[i].Images)
+		if n > budget {
+			n = budget
+		}
+		keep[i] = n
+		budget -= n
+	}
+
+	vision := false
 	// 添加历史对话
-	for _, v := range c.ChatContext.old {
+	for i, v := range c.ChatContext.old {
 		role := "assistant"
-		if v.Role == c.ChatContext.humanRole {
+		// 从缓存解码出来的角色不再是同一个指针，按名字比较
+		if v.Role != nil && v.Role.Name == c.ChatContext.humanRole.Name {
 			role = "user"
 		}
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: v.Prompt,
-		})
+		msg := openai.ChatCompletionMessage{Role: role}
+		if parts := imageParts(v.Prompt, v.Images[:keep[i]]); parts != nil {
+			msg.MultiContent = parts
+			vision = true
+		} else {
+			msg.Content = v.Prompt
+		}
+		messages = append(messages, msg)
 	}
 
 	// 添加当前问题
-	messages = append(messages, openai.ChatCompletionMessage{
-		Role:    "user",
-		Content: question,
-	})
+	msg := openai.ChatCompletionMessage{Role: "user"}
+	if parts := imageParts(question, c.images); parts != nil {
+		msg.MultiContent = parts
+		vision = true
+	} else {
+		msg.Content = question
+	}
+	messages = append(messages, msg)
 
-	return messages
+	return messages, vision
 }
 
 // SingleQaStream 单聊流式版本
-func SingleQaStream(question, userId string) (<-chan string, func(), error) {
-	client := NewClient(userId)
+func SingleQaStream(question, userId string, opts ...Option) (<-chan string, func(), error) {
+	client := NewClient(userId).apply(opts)
 
 	contentCh := make(chan string, 10)
 	done := make(chan struct{})
@@ -117,6 +177,7 @@ func SingleQaStream(question, userId string) (<-chan string, func(), error) {
 
 		stream, err := client.ChatWithContextStream(question)
 		if err != nil {
+			client.streamError(err)
 			contentCh <- err.Error()
 			client.Close()
 			return
@@ -137,9 +198,9 @@ func SingleQaStream(question, userId string) (<-chan string, func(), error) {
 }
 
 // ContextQaStream 串聊流式版本
-func ContextQaStream(question, userId string) (*Client, <-chan string, error) {
-	client := NewClient(userId)
-	if public.UserService.GetUserSessionContext(userId) != "" {
+func ContextQaStream(question, userId string, opts ...Option) (*Client, <-chan string, error) {
+	client := NewClient(userId).apply(opts)
+	if sessionContext(userId) != "" {
 		_ = client.ChatContext.LoadConversation(userId)
 	}
 
@@ -151,3 +212,30 @@ func ContextQaStream(question, userId string) (*Client, <-chan string, error) {
 
 	return client, stream, nil
 }
+
+// RetryQaStream 串聊流式版本的 RetryQa，返回实际提问的问题。
+// 生成结束后需要调用 SaveConversation 保存新的上下文
+func RetryQaStream(question, userId string, opts ...Option) (*Client, string, <-chan string, error) {
+	client := NewClient(userId).apply(opts)
+	if err := client.ChatContext.LoadConversation(userId); err != nil {
+		client.Close()
+		return nil, "", nil, ErrNoLastTurn
+	}
+	lastQuestion, images, ok := client.ChatContext.dropLastTurn()
+	if !ok {
+		client.Close()
+		return nil, "", nil, ErrNoLastTurn
+	}
+	if question == "" {
+		question = lastQuestion
+		if client.images == nil {
+			client.images = images
+		}
+	}
+	stream, err := client.ChatWithContextStream(question)
+	if err != nil {
+		client.Close()
+		return nil, "", nil, err
+	}
+	return client, question, stream, nil
+}
@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/tools"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+const (
+	// toolTimeout 单次工具调用的超时时间
+	toolTimeout = 30 * time.Second
+	// maxToolResultRunes 工具结果的最大长度，避免撑爆上下文
+	maxToolResultRunes = 4000
+)
+
+// ToolCall 一次工具调用的记录
+type ToolCall struct {
+	Name      string
+	Arguments string
+	Result    string
+	Err       error
+}
+
+// ToolHook 工具调用完成后的回调，用于记录调用日志
+type ToolHook func(call ToolCall)
+
+// WithTools 本次请求允许模型调用的工具，hook 可以为 nil
+func WithTools(list []tools.Tool, hook ToolHook) Option {
+	return func(c *Client) {
+		c.tools = list
+		c.toolHook = hook
+	}
+}
+
+// maxToolSteps 一次提问最多进行的工具调用轮数，超过后要求模型直接回答
+func maxToolSteps() int {
+	if public.Config.Tools.MaxSteps > 0 {
+		return public.Config.Tools.MaxSteps
+	}
+	return 5
+}
+
+// prepareTools 设置请求中的工具列表，达到最大轮数后禁止继续调用
+func (c *Client) prepareTools(req *openai.ChatCompletionRequest, step int) {
+	if len(c.tools) == 0 {
+		return
+	}
+	req.Tools = make([]openai.Tool, 0, len(c.tools))
+	for _, t := range c.tools {
+		req.Tools = append(req.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	if step >= maxToolSteps() {
+		req.ToolChoice = "none"
+	}
+}
+
+// runTools 依次执行模型请求的工具，返回需要追加到对话中的工具结果消息
+func (c *Client) runTools(calls []openai.ToolCall) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(calls))
+	for _, call := range calls {
+		record := ToolCall{Name: call.Function.Name, Arguments: call.Function.Arguments}
+		record.Result, record.Err = c.callTool(call.Function.Name, call.Function.Arguments)
+		content := record.Result
+		if record.Err != nil {
+			content = "error: " + record.Err.Error()
+		}
+		if c.toolHook != nil {
+			c.toolHook(record)
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    truncateRunes(content, maxToolResultRunes),
+			Name:       call.Function.Name,
+			ToolCallID: call.ID,
+		})
+	}
+	return messages
+}
+
+// callTool 只允许调用本次请求中提供的工具
+func (c *Client) callTool(name, arguments string) (result string, err error) {
+	var tool *tools.Tool
+	for i := range c.tools {
+		if c.tools[i].Name == name {
+			tool = &c.tools[i]
+			break
+		}
+	}
+	if tool == nil {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if !json.Valid([]byte(arguments)) {
+		return "", fmt.Errorf("invalid arguments: %s", arguments)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tool %s panic: %v", name, r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(c.ctx, toolTimeout)
+	defer cancel()
+	return tool.Handler(ctx, json.RawMessage(arguments))
+}
+
+// mergeToolCall 合并流式响应中分段返回的工具调用
+func mergeToolCall(calls []openai.ToolCall, delta openai.ToolCall) []openai.ToolCall {
+	idx := -1
+	if delta.Index != nil {
+		for i := range calls {
+			if calls[i].Index != nil && *calls[i].Index == *delta.Index {
+				idx = i
+				break
+			}
+		}
+	} else if delta.ID == "" && len(calls) > 0 {
+		idx = len(calls) - 1
+	}
+	if idx < 0 {
+		if delta.Type == "" {
+			delta.Type = openai.ToolTypeFunction
+		}
+		return append(calls, delta)
+	}
+	if delta.ID != "" {
+		calls[idx].ID = delta.ID
+	}
+	if delta.Function.Name != "" {
+		calls[idx].Function.Name = delta.Function.Name
+	}
+	calls[idx].Function.Arguments += delta.Function.Arguments
+	return calls
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/tools"
+)
+
+func TestMergeToolCall(t *testing.T) {
+	i0, i1 := 0, 1
+	var calls []openai.ToolCall
+	for _, d := range []openai.ToolCall{
+		{Index: &i0, ID: "call_a", Function: openai.FunctionCall{Name: "domain_cert"}},
+		{Index: &i0, Function: openai.FunctionCall{Arguments: `{"domain":`}},
+		{Index: &i1, ID: "call_b", Function: openai.FunctionCall{Name: "domain_whois", Arguments: `{}`}},
+		{Index: &i0, Function: openai.FunctionCall{Arguments: `"example.com"}`}},
+	} {
+		calls = mergeToolCall(calls, d)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(calls))
+	}
+	if calls[0].ID != "call_a" || calls[0].Function.Arguments != `{"domain":"example.com"}` {
+		t.Errorf("first call = %+v", calls[0])
+	}
+	if calls[1].ID != "call_b" || calls[1].Function.Name != "domain_whois" || calls[1].Type != openai.ToolTypeFunction {
+		t.Errorf("second call = %+v", calls[1])
+	}
+}
+
+func TestRunTools(t *testing.T) {
+	var logged []ToolCall
+	c := &Client{ctx: context.Background()}
+	WithTools([]tools.Tool{{
+		Name: "echo",
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			if string(args) == "{}" {
+				return "", errors.New("empty")
+			}
+			return string(args), nil
+		},
+	}}, func(call ToolCall) { logged = append(logged, call) })(c)
+
+	msgs := c.runTools([]openai.ToolCall{
+		{ID: "1", Function: openai.FunctionCall{Name: "echo", Arguments: `{"a":1}`}},
+		{ID: "2", Function: openai.FunctionCall{Name: "echo"}},
+		{ID: "3", Function: openai.FunctionCall{Name: "rm", Arguments: `{}`}},
+	})
+	want := []string{`{"a":1}`, "error: empty", "error: unknown tool: rm"}
+	if len(msgs) != len(want) || len(logged) != len(want) {
+		t.Fatalf("got %d messages and %d logs, want %d", len(msgs), len(logged), len(want))
+	}
+	for i, m := range msgs {
+		if m.Content != want[i] || m.Role != openai.ChatMessageRoleTool || m.ToolCallID == "" {
+			t.Errorf("message %d = %+v, want content %q", i, m, want[i])
+		}
+	}
+}
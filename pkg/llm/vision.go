@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxImages 单次请求中最多携带的图片数量，包括历史对话中的图片
+const maxImages = 4
+
+// imageParts 将文字和图片组装为多模态消息，没有可用图片时返回 nil
+// 图片已被清理时忽略，不影响文字部分
+func imageParts(text string, paths []string) []openai.ChatMessagePart {
+	var parts []openai.ChatMessagePart
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data),
+				Detail: openai.ImageURLDetailAuto,
+			},
+		})
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return append([]openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}, parts...)
+}
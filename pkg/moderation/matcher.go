@@ -0,0 +1,107 @@
+package moderation
+
+// Matcher 基于 Aho-Corasick 自动机的多模式匹配器
+type Matcher struct {
+	nodes  []node
+	words  [][]rune
+	maxLen int
+}
+
+type node struct {
+	next map[rune]int
+	fail int
+	// 以当前节点结尾的模式串下标
+	out []int
+}
+
+// Match 一次命中，Start/End 为规范化文本中的下标，End 不包含
+type Match struct {
+	Start   int
+	End     int
+	Pattern int
+}
+
+// NewMatcher 构建匹配器，传入的模式串应当已经规范化
+func NewMatcher(words [][]rune) *Matcher {
+	m := &Matcher{
+		nodes: []node{{next: map[rune]int{}}},
+		words: words,
+	}
+	for i, w := range words {
+		if len(w) == 0 {
+			continue
+		}
+		if len(w) > m.maxLen {
+			m.maxLen = len(w)
+		}
+		cur := 0
+		for _, r := range w {
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				m.nodes = append(m.nodes, node{next: map[rune]int{}})
+				nxt = len(m.nodes) - 1
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		m.nodes[cur].out = append(m.nodes[cur].out, i)
+	}
+	m.build()
+	return m
+}
+
+// build 通过广度优先遍历构建失败指针
+func (m *Matcher) build() {
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		m.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			f := m.nodes[cur].fail
+			for {
+				if nxt, ok := m.nodes[f].next[r]; ok && nxt != child {
+					m.nodes[child].fail = nxt
+					break
+				}
+				if f == 0 {
+					m.nodes[child].fail = 0
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// FindAll 返回文本中所有命中的位置，允许重叠
+func (m *Matcher) FindAll(text []rune) []Match {
+	var matches []Match
+	cur := 0
+	for i, r := range text {
+		for {
+			if nxt, ok := m.nodes[cur].next[r]; ok {
+				cur = nxt
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		for _, p := range m.nodes[cur].out {
+			matches = append(matches, Match{Start: i + 1 - len(m.words[p]), End: i + 1, Pattern: p})
+		}
+	}
+	return matches
+}
+
+// MaxLen 最长模式串的长度
+func (m *Matcher) MaxLen() int {
+	return m.maxLen
+}
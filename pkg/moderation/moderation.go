@@ -0,0 +1,271 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+)
+
+// Action 命中敏感内容后的处理动作
+type Action string
+
+const (
+	// ActionBlock 拦截：提问直接拒绝，回答中打码
+	ActionBlock Action = "block"
+	// ActionMask 打码后继续
+	ActionMask Action = "mask"
+	// ActionWarn 继续处理，但提醒用户
+	ActionWarn Action = "warn"
+	// ActionNotify 继续处理，同时通知管理员
+	ActionNotify Action = "notify"
+)
+
+// LegacyCategory 兼容 sensitive_words 配置的分类名称
+const LegacyCategory = "sensitive"
+
+// MaskRune 打码时使用的字符
+const MaskRune = '🚫'
+
+// Hit 一次命中
+// 本地词库命中时 Start/End 为原始文本中的字符下标（End 不包含）；审核接口命中时两者均为 -1
+type Hit struct {
+	Word     string
+	Category string
+	Action   Action
+	Start    int
+	End      int
+}
+
+// Result 审核结果
+type Result struct {
+	Hits []Hit
+}
+
+// Has 判断结果中是否包含指定动作
+func (r Result) Has(action Action) bool {
+	for _, h := range r.Hits {
+		if h.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Categories 命中的分类名称，去重
+func (r Result) Categories() []string {
+	var cs []string
+	seen := map[string]bool{}
+	for _, h := range r.Hits {
+		if !seen[h.Category] {
+			seen[h.Category] = true
+			cs = append(cs, h.Category)
+		}
+	}
+	return cs
+}
+
+// Remote 外部内容审核接口，返回命中的分类
+type Remote interface {
+	Moderate(text string) ([]string, error)
+}
+
+// RemoteFunc 将普通函数适配为 Remote
+type RemoteFunc func(text string) ([]string, error)
+
+func (f RemoteFunc) Moderate(text string) ([]string, error) {
+	return f(text)
+}
+
+// Entry 词条
+type Entry struct {
+	Word     string
+	Category string
+	Action   Action
+}
+
+// Moderator 内容审核器
+type Moderator struct {
+	matcher *Matcher
+	entries []Entry
+
+	mutex        sync.RWMutex
+	remote       Remote
+	remoteAction Action
+}
+
+// New 根据配置创建审核器，sensitive_words 会作为 block 分类加入
+func New(conf *config.Configuration) (*Moderator, error) {
+	categories := conf.Moderation.Categories
+	if len(conf.SensitiveWords) > 0 {
+		categories = append([]config.ModerationCategory{{
+			Name:   LegacyCategory,
+			Action: string(ActionBlock),
+			Words:  conf.SensitiveWords,
+		}}, categories...)
+	}
+	var entries []Entry
+	for _, c := range categories {
+		action, err := ParseAction(c.Action)
+		if err != nil {
+			return nil, fmt.Errorf("moderation category %s: %w", c.Name, err)
+		}
+		words := c.Words
+		for _, f := range c.WordFiles {
+			fileWords, err := LoadWords(f)
+			if err != nil {
+				return nil, fmt.Errorf("moderation category %s: %w", c.Name, err)
+			}
+			words = append(words, fileWords...)
+		}
+		for _, w := range words {
+			entries = append(entries, Entry{Word: w, Category: c.Name, Action: action})
+		}
+	}
+	m := NewModerator(entries...)
+	m.remoteAction, _ = ParseAction(conf.Moderation.ApiAction)
+	return m, nil
+}
+
+// NewModerator 通过词条直接创建审核器
+func NewModerator(entries ...Entry) *Moderator {
+	m := &Moderator{remoteAction: ActionBlock}
+	patterns := make([][]rune, 0, len(entries))
+	for _, e := range entries {
+		w := NormalizeString(e.Word)
+		if len(w) == 0 {
+			continue
+		}
+		m.entries = append(m.entries, e)
+		patterns = append(patterns, w)
+	}
+	m.matcher = NewMatcher(patterns)
+	return m
+}
+
+// ParseAction 解析处理动作，留空时为 block
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(strings.TrimSpace(s))); a {
+	case "":
+		return ActionBlock, nil
+	case ActionBlock, ActionMask, ActionWarn, ActionNotify:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown action: %s", s)
+	}
+}
+
+// LoadWords 从文件加载词库，每行一个词，忽略空行和 # 开头的注释
+func LoadWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// SetRemote 设置外部审核接口
+func (m *Moderator) SetRemote(r Remote) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.remote = r
+}
+
+// Empty 没有任何词库，且没有配置外部审核接口
+func (m *Moderator) Empty() bool {
+	if m == nil {
+		return true
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.entries) == 0 && m.remote == nil
+}
+
+// MaxWordLen 最长敏感词的长度（规范化后）
+func (m *Moderator) MaxWordLen() int {
+	if m == nil {
+		return 0
+	}
+	return m.matcher.MaxLen()
+}
+
+// CheckLocal 只使用本地词库进行审核
+func (m *Moderator) CheckLocal(text string) Result {
+	var rst Result
+	if m == nil || len(m.entries) == 0 {
+		return rst
+	}
+	norm, pos := Normalize([]rune(text))
+	for _, match := range m.matcher.FindAll(norm) {
+		e := m.entries[match.Pattern]
+		rst.Hits = append(rst.Hits, Hit{
+			Word:     e.Word,
+			Category: e.Category,
+			Action:   e.Action,
+			Start:    pos[match.Start],
+			End:      pos[match.End-1] + 1,
+		})
+	}
+	return rst
+}
+
+// Check 使用本地词库以及外部审核接口进行审核，外部接口出错时只返回本地结果和错误
+func (m *Moderator) Check(text string) (Result, error) {
+	rst := m.CheckLocal(text)
+	if m == nil {
+		return rst, nil
+	}
+	m.mutex.RLock()
+	remote, action := m.remote, m.remoteAction
+	m.mutex.RUnlock()
+	if remote == nil || strings.TrimSpace(text) == "" {
+		return rst, nil
+	}
+	categories, err := remote.Moderate(text)
+	if err != nil {
+		return rst, err
+	}
+	for _, c := range categories {
+		rst.Hits = append(rst.Hits, Hit{Category: c, Action: action, Start: -1, End: -1})
+	}
+	return rst, nil
+}
+
+// Mask 将结果中需要打码（block、mask）的本地命中替换为 🚫，空白字符保留
+func Mask(text string, rst Result) string {
+	runes := []rune(text)
+	changed := false
+	for _, h := range rst.Hits {
+		if h.Start < 0 || (h.Action != ActionBlock && h.Action != ActionMask) {
+			continue
+		}
+		for i := h.Start; i < h.End && i < len(runes); i++ {
+			if !isIgnorable(runes[i]) {
+				runes[i] = MaskRune
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return text
+	}
+	return string(runes)
+}
+
+// Mask 使用本地词库对文本打码
+func (m *Moderator) Mask(text string) string {
+	return Mask(text, m.CheckLocal(text))
+}
@@ -0,0 +1,119 @@
+package moderation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+)
+
+func TestMatcher_FindAll_Overlapping(t *testing.T) {
+	m := NewMatcher([][]rune{[]rune("he"), []rune("she"), []rune("his"), []rune("hers")})
+	matches := m.FindAll([]rune("ushers"))
+	if len(matches) != 3 {
+		t.Errorf("matches should be 3, but %d: %#v", len(matches), matches)
+		return
+	}
+	if m.MaxLen() != 4 {
+		t.Errorf("max len should be 4, but %d", m.MaxLen())
+	}
+}
+
+func TestModerator_Mask_AllWords(t *testing.T) {
+	m := NewModerator(
+		Entry{Word: "苹果", Category: "fruit", Action: ActionMask},
+		Entry{Word: "香蕉", Category: "fruit", Action: ActionBlock},
+	)
+	got := m.Mask("我喜欢苹果和香蕉，也喜欢苹果")
+	want := "我喜欢🚫🚫和🚫🚫，也喜欢🚫🚫"
+	if got != want {
+		t.Errorf("mask should be %q, but %q", want, got)
+	}
+}
+
+func TestModerator_CheckLocal_Normalize(t *testing.T) {
+	m := NewModerator(Entry{Word: "Bad Word", Category: "test", Action: ActionMask})
+	cases := map[string]string{
+		"this is a badword":         "this is a 🚫🚫🚫🚫🚫🚫🚫",
+		"this is a ＢＡＤ ＷＯＲＤ":        "this is a 🚫🚫🚫 🚫🚫🚫🚫",
+		"this is a b a d\u200bword": "this is a 🚫 🚫 🚫\u200b🚫🚫🚫🚫",
+		"nothing here":              "nothing here",
+	}
+	for text, want := range cases {
+		if got := m.Mask(text); got != want {
+			t.Errorf("mask %q should be %q, but %q", text, want, got)
+		}
+	}
+}
+
+func TestModerator_Check_Actions(t *testing.T) {
+	m := NewModerator(
+		Entry{Word: "warn", Category: "w", Action: ActionWarn},
+		Entry{Word: "notify", Category: "n", Action: ActionNotify},
+	)
+	rst := m.CheckLocal("please warn and notify")
+	if !rst.Has(ActionWarn) || !rst.Has(ActionNotify) || rst.Has(ActionBlock) {
+		t.Errorf("unexpected actions: %#v", rst.Hits)
+	}
+	// warn 和 notify 不打码
+	if got := Mask("please warn and notify", rst); got != "please warn and notify" {
+		t.Errorf("text should not be masked, but %q", got)
+	}
+}
+
+func TestModerator_Check_Remote(t *testing.T) {
+	m := NewModerator()
+	if !m.Empty() {
+		t.Errorf("moderator should be empty")
+	}
+	m.SetRemote(RemoteFunc(func(text string) ([]string, error) {
+		return []string{"violence"}, nil
+	}))
+	rst, err := m.Check("something")
+	if err != nil {
+		t.Errorf("check failed, err=%v", err)
+		return
+	}
+	if len(rst.Hits) != 1 || rst.Hits[0].Category != "violence" || rst.Hits[0].Start != -1 {
+		t.Errorf("unexpected hits: %#v", rst.Hits)
+	}
+
+	m.SetRemote(RemoteFunc(func(text string) ([]string, error) {
+		return nil, errors.New("api down")
+	}))
+	if _, err := m.Check("something"); err == nil {
+		t.Errorf("check should return remote error")
+	}
+}
+
+func TestNew_WithLegacyWordsAndFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# comment\n\n广告\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(&config.Configuration{
+		SensitiveWords: []string{"敏感"},
+		Moderation: config.Moderation{
+			Categories: []config.ModerationCategory{{Name: "ad", Action: "mask", WordFiles: []string{path}}},
+		},
+	})
+	if err != nil {
+		t.Errorf("new moderator failed, err=%v", err)
+		return
+	}
+	rst := m.CheckLocal("敏感的广告")
+	if len(rst.Hits) != 2 || rst.Hits[0].Category != LegacyCategory || rst.Hits[1].Category != "ad" {
+		t.Errorf("unexpected hits: %#v", rst.Hits)
+	}
+
+	_, err = New(&config.Configuration{
+		Moderation: config.Moderation{
+			Categories: []config.ModerationCategory{{Name: "bad", Action: "drop"}},
+		},
+	})
+	if err == nil {
+		t.Errorf("unknown action should fail")
+	}
+}
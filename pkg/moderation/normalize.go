@@ -0,0 +1,47 @@
+package moderation
+
+import (
+	"unicode"
+)
+
+// Normalize 将文本规范化后用于匹配：全角转半角、统一小写、去掉空白和零宽字符
+// 返回规范化后的文本，以及每个字符在原始文本中的下标
+func Normalize(runes []rune) ([]rune, []int) {
+	norm := make([]rune, 0, len(runes))
+	pos := make([]int, 0, len(runes))
+	for i, r := range runes {
+		r, ok := normalizeRune(r)
+		if !ok {
+			continue
+		}
+		norm = append(norm, r)
+		pos = append(pos, i)
+	}
+	return norm, pos
+}
+
+// NormalizeString 规范化字符串，用于处理词库
+func NormalizeString(s string) []rune {
+	norm, _ := Normalize([]rune(s))
+	return norm
+}
+
+func normalizeRune(r rune) (rune, bool) {
+	switch {
+	case isIgnorable(r):
+		return 0, false
+	case r >= 0xFF01 && r <= 0xFF5E:
+		// 全角ASCII字符
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r), true
+}
+
+// isIgnorable 空白、零宽字符在匹配时忽略，避免通过插入空格绕过检测
+func isIgnorable(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,43 @@
+package moderation
+
+// StreamFilter 对流式输出打码
+// 为了识别跨分片的敏感词，末尾不足一个最长敏感词长度的内容会先暂存，等后续内容到达或流结束后再输出
+type StreamFilter struct {
+	m   *Moderator
+	raw []rune
+}
+
+// NewStreamFilter 创建流式打码器，审核器为空时原样输出
+func (m *Moderator) NewStreamFilter() *StreamFilter {
+	return &StreamFilter{m: m}
+}
+
+// Write 追加一段内容，返回当前可以安全展示的打码后的完整文本
+func (f *StreamFilter) Write(chunk string) string {
+	f.raw = append(f.raw, []rune(chunk)...)
+	held := f.m.MaxWordLen() - 1
+	if held <= 0 {
+		return f.masked(len(f.raw))
+	}
+	norm, pos := Normalize(f.raw)
+	if len(norm) <= held {
+		return ""
+	}
+	// 尚未完整出现的敏感词只可能从最后 held 个有效字符开始，之前的内容不会再变化
+	return f.masked(pos[len(norm)-held])
+}
+
+// Flush 流结束，返回打码后的全部文本
+func (f *StreamFilter) Flush() string {
+	return f.masked(len(f.raw))
+}
+
+// Raw 返回未打码的原始文本
+func (f *StreamFilter) Raw() string {
+	return string(f.raw)
+}
+
+// masked 对全部内容打码后截取前 n 个字符，打码不改变字符数量
+func (f *StreamFilter) masked(n int) string {
+	return string([]rune(f.m.Mask(string(f.raw)))[:n])
+}
@@ -0,0 +1,58 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamFilter_WordAcrossChunks(t *testing.T) {
+	m := NewModerator(Entry{Word: "敏感词", Category: "test", Action: ActionMask})
+	f := m.NewStreamFilter()
+	chunks := []string{"这里有一个敏", "感", "词，还有一个敏感", "词"}
+	var outputs []string
+	for _, c := range chunks {
+		out := f.Write(c)
+		if strings.Contains(out, "敏") || strings.Contains(out, "感") {
+			t.Errorf("partial sensitive word should not be shown, but %q", out)
+		}
+		outputs = append(outputs, out)
+	}
+	// 已经展示的内容只会增长，不会被改写
+	for i := 1; i < len(outputs); i++ {
+		if !strings.HasPrefix(outputs[i], outputs[i-1]) {
+			t.Errorf("output %q should start with %q", outputs[i], outputs[i-1])
+		}
+	}
+	want := "这里有一个🚫🚫🚫，还有一个🚫🚫🚫"
+	if got := f.Flush(); got != want {
+		t.Errorf("flush should be %q, but %q", want, got)
+	}
+	if got := f.Raw(); got != "这里有一个敏感词，还有一个敏感词" {
+		t.Errorf("raw text should be kept, but %q", got)
+	}
+}
+
+func TestStreamFilter_SpacedWordAcrossChunks(t *testing.T) {
+	m := NewModerator(Entry{Word: "secret", Category: "test", Action: ActionBlock})
+	f := m.NewStreamFilter()
+	for _, c := range []string{"the S", "E C", "R", "ET is out"} {
+		if out := f.Write(c); strings.ContainsAny(out, "SECRT") {
+			t.Errorf("partial sensitive word should not be shown, but %q", out)
+		}
+	}
+	want := "the 🚫🚫 🚫🚫🚫🚫 is out"
+	if got := f.Flush(); got != want {
+		t.Errorf("flush should be %q, but %q", want, got)
+	}
+}
+
+func TestStreamFilter_EmptyModerator(t *testing.T) {
+	var m *Moderator
+	f := m.NewStreamFilter()
+	if got := f.Write("hello "); got != "hello " {
+		t.Errorf("text should pass through, but %q", got)
+	}
+	if got := f.Write("world"); got != "hello world" {
+		t.Errorf("text should pass through, but %q", got)
+	}
+}
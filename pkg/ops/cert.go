@@ -0,0 +1,278 @@
+package ops
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// 支持的 STARTTLS 协议
+const (
+	StartTLSSMTP = "smtp"
+	StartTLSIMAP = "imap"
+)
+
+// certRoots 校验证书链使用的根证书，为 nil 时使用系统根证书，测试时替换
+var certRoots *x509.CertPool
+
+// CertInfo 证书链中的一张证书
+type CertInfo struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SANs               []string  `json:"sans,omitempty"`
+	KeyType            string    `json:"key_type"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SerialNumber       string    `json:"serial_number"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	IsCA               bool      `json:"is_ca"`
+}
+
+// CertReport 证书检查结果
+type CertReport struct {
+	Addr        string `json:"addr"`
+	ServerName  string `json:"server_name"`
+	StartTLS    string `json:"starttls,omitempty"`
+	TLSVersion  string `json:"tls_version"`
+	CipherSuite string `json:"cipher_suite"`
+	// Chain 服务端返回的证书链，第一张为站点证书
+	Chain []CertInfo `json:"chain"`
+	// Verified 证书链及域名校验是否通过
+	Verified    bool   `json:"verified"`
+	VerifyError string `json:"verify_error,omitempty"`
+	// DaysLeft 站点证书剩余有效天数，已过期时为负数
+	DaysLeft int `json:"days_left"`
+	// OCSPStapled 服务端是否提供了 OCSP Stapling 响应
+	OCSPStapled    bool      `json:"ocsp_stapled"`
+	OCSPStatus     string    `json:"ocsp_status,omitempty"`
+	OCSPNextUpdate time.Time `json:"ocsp_next_update,omitempty"`
+}
+
+// Leaf 站点证书
+func (r CertReport) Leaf() CertInfo {
+	if len(r.Chain) == 0 {
+		return CertInfo{}
+	}
+	return r.Chain[0]
+}
+
+// InspectCert 检查证书，target 格式为 host[:port]，可以带 smtp:// 或 imap:// 前缀使用 STARTTLS
+// 未指定端口时默认 443，端口为 25、587、143 时自动使用对应的 STARTTLS，serverName 为空时使用 host 作为 SNI
+func InspectCert(ctx context.Context, target, serverName string) (CertReport, error) {
+	addr, host, starttls, err := parseCertTarget(target)
+	if err != nil {
+		return CertReport{Addr: target}, err
+	}
+	if serverName == "" {
+		serverName = host
+	}
+	rst := CertReport{Addr: addr, ServerName: serverName, StartTLS: starttls}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	conn, err := targetDialer().DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return rst, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	switch starttls {
+	case StartTLSSMTP:
+		err = startTLSSMTP(conn)
+	case StartTLSIMAP:
+		err = startTLSIMAP(conn)
+	}
+	if err != nil {
+		return rst, fmt.Errorf("starttls: %v", err)
+	}
+
+	// 先完成握手拿到证书链，再单独校验，证书有问题时同样可以返回详细信息
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return rst, err
+	}
+	cs := tlsConn.ConnectionState()
+	if len(cs.PeerCertificates) == 0 {
+		return rst, fmt.Errorf("no certificate returned by %s", addr)
+	}
+	rst.TLSVersion = tls.VersionName(cs.Version)
+	rst.CipherSuite = tls.CipherSuiteName(cs.CipherSuite)
+	for _, cert := range cs.PeerCertificates {
+		rst.Chain = append(rst.Chain, certInfo(cert))
+	}
+	leaf := cs.PeerCertificates[0]
+	rst.DaysLeft = int(time.Until(leaf.NotAfter).Hours() / 24)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{DNSName: serverName, Roots: certRoots, Intermediates: intermediates})
+	if err != nil {
+		rst.VerifyError = err.Error()
+	} else {
+		rst.Verified = true
+	}
+
+	if len(cs.OCSPResponse) > 0 {
+		rst.OCSPStapled = true
+		var issuer *x509.Certificate
+		if len(chains) > 0 && len(chains[0]) > 1 {
+			issuer = chains[0][1]
+		} else if len(cs.PeerCertificates) > 1 {
+			issuer = cs.PeerCertificates[1]
+		}
+		resp, err := ocsp.ParseResponseForCert(cs.OCSPResponse, leaf, issuer)
+		if err != nil {
+			rst.OCSPStatus = "invalid: " + err.Error()
+		} else {
+			rst.OCSPStatus = ocspStatus(resp.Status)
+			rst.OCSPNextUpdate = resp.NextUpdate
+		}
+	}
+	return rst, nil
+}
+
+// parseCertTarget 解析检查目标，返回连接地址、主机名和 STARTTLS 协议
+func parseCertTarget(target string) (addr, host, starttls string, err error) {
+	target = strings.TrimSpace(target)
+	scheme := ""
+	if idx := strings.Index(target, "://"); idx >= 0 {
+		scheme, target = strings.ToLower(target[:idx]), target[idx+3:]
+	}
+	target = strings.SplitN(target, "/", 2)[0]
+	if target == "" {
+		return "", "", "", fmt.Errorf("host is required")
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = strings.Trim(target, "[]"), ""
+	}
+	switch scheme {
+	case "", "https", "tls":
+	case StartTLSSMTP, StartTLSIMAP:
+		starttls = scheme
+	default:
+		return "", "", "", fmt.Errorf("unsupported scheme %s, supported: https, smtp, imap", scheme)
+	}
+	if port == "" {
+		switch starttls {
+		case StartTLSSMTP:
+			port = "25"
+		case StartTLSIMAP:
+			port = "143"
+		default:
+			port = "443"
+		}
+	}
+	if scheme == "" {
+		switch port {
+		case "25", "587":
+			starttls = StartTLSSMTP
+		case "143":
+			starttls = StartTLSIMAP
+		}
+	}
+	return net.JoinHostPort(host, port), host, starttls, nil
+}
+
+// startTLSSMTP 完成 SMTP 的 EHLO 及 STARTTLS 交互
+func startTLSSMTP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("EHLO chatgpt-dingtalk"); err != nil {
+		return err
+	}
+	if _, msg, err := tp.ReadResponse(250); err != nil {
+		return err
+	} else if !strings.Contains(strings.ToUpper(msg), "STARTTLS") {
+		return fmt.Errorf("server does not support STARTTLS")
+	}
+	if err := tp.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err := tp.ReadResponse(220)
+	return err
+}
+
+// startTLSIMAP 完成 IMAP 的 STARTTLS 交互
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(greeting))
+	}
+	if _, err := conn.Write([]byte("a001 STARTTLS\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("unexpected response: %s", strings.TrimSpace(line))
+			}
+			return nil
+		}
+	}
+}
+
+func certInfo(cert *x509.Certificate) CertInfo {
+	info := CertInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		KeyType:            keyType(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SerialNumber:       fmt.Sprintf("%X", cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		IsCA:               cert.IsCA,
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	return info
+}
+
+func keyType(pub interface{}) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return "unknown"
+}
+
+func ocspStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
@@ -0,0 +1,120 @@
+package ops
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+)
+
+func TestParseCertTarget(t *testing.T) {
+	cases := []struct {
+		target, addr, host, starttls string
+	}{
+		{"example.com", "example.com:443", "example.com", ""},
+		{"https://example.com/path", "example.com:443", "example.com", ""},
+		{"example.com:8443", "example.com:8443", "example.com", ""},
+		{"mail.example.com:587", "mail.example.com:587", "mail.example.com", StartTLSSMTP},
+		{"imap://mail.example.com", "mail.example.com:143", "mail.example.com", StartTLSIMAP},
+		{"[2001:db8::1]:993", "[2001:db8::1]:993", "2001:db8::1", ""},
+	}
+	for _, c := range cases {
+		addr, host, starttls, err := parseCertTarget(c.target)
+		if err != nil || addr != c.addr || host != c.host || starttls != c.starttls {
+			t.Errorf("parseCertTarget(%q) = %q, %q, %q, %v", c.target, addr, host, starttls, err)
+		}
+	}
+	if _, _, _, err := parseCertTarget("ftp://example.com"); err == nil {
+		t.Errorf("unsupported scheme should be rejected")
+	}
+}
+
+func TestInspectCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	if _, err := InspectCert(context.Background(), addr, ""); err == nil {
+		t.Errorf("loopback should be denied by default")
+	}
+	allowLoopback(t)
+
+	// 测试证书不在系统根证书中，校验失败但仍然返回证书信息
+	rst, err := InspectCert(context.Background(), addr, "example.com")
+	if err != nil {
+		t.Fatalf("InspectCert error: %v", err)
+	}
+	if rst.Verified || rst.VerifyError == "" {
+		t.Errorf("self-signed certificate should fail verification: %+v", rst)
+	}
+	if len(rst.Chain) == 0 || rst.TLSVersion == "" || rst.CipherSuite == "" || rst.DaysLeft <= 0 {
+		t.Errorf("unexpected report: %+v", rst)
+	}
+	if leaf := rst.Leaf(); leaf.KeyType == "" || len(leaf.SANs) == 0 {
+		t.Errorf("unexpected leaf: %+v", leaf)
+	}
+
+	certRoots = x509.NewCertPool()
+	certRoots.AddCert(srv.Certificate())
+	defer func() { certRoots = nil }()
+	rst, err = InspectCert(context.Background(), addr, "example.com")
+	if err != nil {
+		t.Fatalf("InspectCert error: %v", err)
+	}
+	if !rst.Verified {
+		t.Errorf("certificate should be verified with test root: %s", rst.VerifyError)
+	}
+	rst, err = InspectCert(context.Background(), addr, "other.org")
+	if err != nil || rst.Verified {
+		t.Errorf("certificate should not be valid for other.org: %+v, %v", rst, err)
+	}
+}
+
+func TestInspectCert_StartTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tp := textproto.NewConn(conn)
+				_ = tp.PrintfLine("220 mail.example.com ESMTP")
+				if _, err := tp.ReadLine(); err != nil {
+					return
+				}
+				_ = tp.PrintfLine("250-mail.example.com")
+				_ = tp.PrintfLine("250 STARTTLS")
+				if _, err := tp.ReadLine(); err != nil {
+					return
+				}
+				_ = tp.PrintfLine("220 ready")
+				_ = tls.Server(conn, srv.TLS).Handshake()
+			}(conn)
+		}
+	}()
+	allowLoopback(t)
+	certRoots = x509.NewCertPool()
+	certRoots.AddCert(srv.Certificate())
+	defer func() { certRoots = nil }()
+
+	rst, err := InspectCert(context.Background(), "smtp://"+ln.Addr().String(), "example.com")
+	if err != nil {
+		t.Fatalf("InspectCert error: %v", err)
+	}
+	if rst.StartTLS != StartTLSSMTP || !rst.Verified {
+		t.Errorf("unexpected report: %+v", rst)
+	}
+}
@@ -0,0 +1,94 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DNSTypes 支持查询的记录类型
+var DNSTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "PTR"}
+
+// DNSResult DNS 查询结果
+type DNSResult struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Server  string        `json:"server"`
+	Records []string      `json:"records"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// LookupDNS 查询域名的 DNS 记录，qtype 为空时查询 A 记录
+// server 为空时使用系统解析器，否则向指定的 DNS 服务器查询，端口默认为 53
+func LookupDNS(ctx context.Context, name, qtype, server string) (DNSResult, error) {
+	qtype = strings.ToUpper(strings.TrimSpace(qtype))
+	if qtype == "" {
+		qtype = "A"
+	}
+	name = strings.TrimSpace(name)
+	rst := DNSResult{Name: name, Type: qtype, Server: "system"}
+	if name == "" {
+		return rst, fmt.Errorf("name is required")
+	}
+
+	resolver := net.DefaultResolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		rst.Server = server
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return targetDialer().DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	var err error
+	switch qtype {
+	case "A", "AAAA":
+		network := "ip4"
+		if qtype == "AAAA" {
+			network = "ip6"
+		}
+		var ips []net.IP
+		ips, err = resolver.LookupIP(ctx, network, name)
+		for _, ip := range ips {
+			rst.Records = append(rst.Records, ip.String())
+		}
+	case "CNAME":
+		var cname string
+		cname, err = resolver.LookupCNAME(ctx, name)
+		if cname != "" {
+			rst.Records = append(rst.Records, cname)
+		}
+	case "MX":
+		var mxs []*net.MX
+		mxs, err = resolver.LookupMX(ctx, name)
+		for _, mx := range mxs {
+			rst.Records = append(rst.Records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "NS":
+		var nss []*net.NS
+		nss, err = resolver.LookupNS(ctx, name)
+		for _, ns := range nss {
+			rst.Records = append(rst.Records, ns.Host)
+		}
+		sort.Strings(rst.Records)
+	case "TXT":
+		rst.Records, err = resolver.LookupTXT(ctx, name)
+	case "PTR":
+		rst.Records, err = resolver.LookupAddr(ctx, name)
+	default:
+		return rst, fmt.Errorf("unsupported record type %s, supported: %s", qtype, strings.Join(DNSTypes, ", "))
+	}
+	rst.Latency = time.Since(start)
+	return rst, err
+}
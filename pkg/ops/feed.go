@@ -0,0 +1,163 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFeedSize 订阅源内容的大小上限
+const maxFeedSize = 5 << 20
+
+// maxFeedSummaryRunes 每篇文章摘要的长度上限
+const maxFeedSummaryRunes = 200
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// FeedItem 订阅源中的一篇文章
+type FeedItem struct {
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Published string `json:"published,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+}
+
+// FeedResult 订阅源内容
+type FeedResult struct {
+	URL   string     `json:"url"`
+	Title string     `json:"title"`
+	Items []FeedItem `json:"items"`
+}
+
+// feedXML 同时兼容 RSS 2.0 和 Atom 的结构
+type feedXML struct {
+	XMLName xml.Name
+	// RSS
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			PubDate     string `xml:"pubDate"`
+			Description string `xml:"description"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	// Atom
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+	} `xml:"entry"`
+}
+
+// FetchFeed 获取 RSS 或 Atom 订阅源的最新文章，limit 小于等于 0 时返回 10 篇
+func FetchFeed(ctx context.Context, rawURL string, limit int) (FeedResult, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	rst := FeedResult{URL: rawURL}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return rst, fmt.Errorf("invalid url %q, only http and https are supported", rawURL)
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	transport := &http.Transport{
+		Proxy:             nil,
+		DialContext:       targetDialer().DialContext,
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return rst, err
+	}
+	req.Header.Set("User-Agent", "chatgpt-dingtalk-feed")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return rst, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rst, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return rst, err
+	}
+	return parseFeed(rst, data, limit)
+}
+
+func parseFeed(rst FeedResult, data []byte, limit int) (FeedResult, error) {
+	var feed feedXML
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// 只解析结构，不关心声明的编码
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	dec.Strict = false
+	if err := dec.Decode(&feed); err != nil {
+		return rst, fmt.Errorf("invalid feed: %v", err)
+	}
+	switch strings.ToLower(feed.XMLName.Local) {
+	case "rss":
+		rst.Title = strings.TrimSpace(feed.Channel.Title)
+		for _, it := range feed.Channel.Items {
+			rst.Items = append(rst.Items, FeedItem{
+				Title:     strings.TrimSpace(it.Title),
+				Link:      strings.TrimSpace(it.Link),
+				Published: strings.TrimSpace(it.PubDate),
+				Summary:   feedSummary(it.Description),
+			})
+		}
+	case "feed":
+		rst.Title = strings.TrimSpace(feed.Title)
+		for _, e := range feed.Entries {
+			item := FeedItem{Title: strings.TrimSpace(e.Title), Published: e.Published, Summary: feedSummary(e.Summary)}
+			if item.Published == "" {
+				item.Published = e.Updated
+			}
+			if item.Summary == "" {
+				item.Summary = feedSummary(e.Content)
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = l.Href
+					break
+				}
+			}
+			rst.Items = append(rst.Items, item)
+		}
+	default:
+		return rst, fmt.Errorf("unsupported feed format <%s>", feed.XMLName.Local)
+	}
+	if len(rst.Items) > limit {
+		rst.Items = rst.Items[:limit]
+	}
+	return rst, nil
+}
+
+// feedSummary 去掉 HTML 标签并截断
+func feedSummary(s string) string {
+	s = html.UnescapeString(htmlTagPattern.ReplaceAllString(s, " "))
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) > maxFeedSummaryRunes {
+		s = string([]rune(s)[:maxFeedSummaryRunes]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package ops
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRedirects HTTP 探测最多跟随的重定向次数
+const maxRedirects = 10
+
+// HTTPHop 重定向链中的一跳
+type HTTPHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+}
+
+// TLSInfo HTTPS 连接信息
+type TLSInfo struct {
+	Version  string    `json:"version"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	DNSNames []string  `json:"dns_names"`
+	NotAfter time.Time `json:"not_after"`
+	// VerifyError 证书校验失败的原因，为空表示证书有效
+	VerifyError string `json:"verify_error,omitempty"`
+}
+
+// HTTPResult HTTP 探测结果
+type HTTPResult struct {
+	URL        string        `json:"url"`
+	StatusCode int           `json:"status_code"`
+	Status     string        `json:"status"`
+	Server     string        `json:"server,omitempty"`
+	Latency    time.Duration `json:"latency_ns"`
+	Redirects  []HTTPHop     `json:"redirects,omitempty"`
+	TLS        *TLSInfo      `json:"tls,omitempty"`
+}
+
+// ProbeHTTP 请求地址并返回状态码、耗时、重定向链以及 TLS 信息，未写协议时默认使用 https
+// 证书校验失败时仍然返回结果，失败原因记录在 TLS.VerifyError 中
+func ProbeHTTP(ctx context.Context, rawURL string) (HTTPResult, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return HTTPResult{URL: rawURL}, fmt.Errorf("invalid url %q, only http and https are supported", rawURL)
+	}
+	rst, err := probeHTTP(ctx, u.String(), false)
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		rst, err = probeHTTP(ctx, u.String(), true)
+		if rst.TLS != nil {
+			rst.TLS.VerifyError = verifyErr.Err.Error()
+		}
+	}
+	return rst, err
+}
+
+func probeHTTP(ctx context.Context, rawURL string, insecure bool) (HTTPResult, error) {
+	rst := HTTPResult{URL: rawURL}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	transport := &http.Transport{
+		// 不使用代理，保证网段限制对真实目标生效
+		Proxy:               nil,
+		DialContext:         targetDialer().DialContext,
+		TLSHandshakeTimeout: DefaultTimeout,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: insecure},
+		DisableKeepAlives:   true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			rst.Redirects = append(rst.Redirects, HTTPHop{URL: via[len(via)-1].URL.String(), StatusCode: req.Response.StatusCode})
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return rst, err
+	}
+	req.Header.Set("User-Agent", "chatgpt-dingtalk-probe")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return rst, err
+	}
+	defer resp.Body.Close()
+	rst.Latency = time.Since(start)
+	rst.URL = resp.Request.URL.String()
+	rst.StatusCode = resp.StatusCode
+	rst.Status = resp.Status
+	rst.Server = resp.Header.Get("Server")
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		rst.TLS = &TLSInfo{
+			Version:  tls.VersionName(resp.TLS.Version),
+			Subject:  cert.Subject.CommonName,
+			Issuer:   cert.Issuer.String(),
+			DNSNames: cert.DNSNames,
+			NotAfter: cert.NotAfter,
+		}
+	}
+	return rst, nil
+}
@@ -0,0 +1,153 @@
+package ops
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ASN 自治系统信息
+type ASN struct {
+	Number  uint32 `json:"number"`
+	Country string `json:"country"`
+	Name    string `json:"name"`
+}
+
+// IPInfo IP 地址信息
+type IPInfo struct {
+	IP    string   `json:"ip"`
+	Hosts []string `json:"hosts"`
+	ASN   *ASN     `json:"asn,omitempty"`
+}
+
+// asnRange 一段连续地址对应的 ASN，地址统一使用 16 字节表示便于比较
+type asnRange struct {
+	start, end net.IP
+	asn        ASN
+}
+
+// ASNDB 本地 ASN 数据库
+type ASNDB struct {
+	ranges []asnRange
+}
+
+var (
+	asnMu sync.RWMutex
+	asnDB *ASNDB
+)
+
+// LoadASNDB 加载 iptoasn.com 格式的 ASN 数据库（ip2asn-combined.tsv，支持 .gz 压缩）
+// 每行格式为：起始地址 结束地址 AS号 国家代码 AS名称，以 Tab 分隔
+func LoadASNDB(path string) (*ASNDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return ParseASNDB(r)
+}
+
+// ParseASNDB 解析 ASN 数据库内容，AS 号为 0（未路由）的地址段会被忽略
+func ParseASNDB(r io.Reader) (*ASNDB, error) {
+	db := &ASNDB{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 5)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid asn db line %d", line)
+		}
+		start, end := net.ParseIP(fields[0]).To16(), net.ParseIP(fields[1]).To16()
+		num, err := strconv.ParseUint(fields[2], 10, 32)
+		if start == nil || end == nil || err != nil {
+			return nil, fmt.Errorf("invalid asn db line %d", line)
+		}
+		if num == 0 {
+			continue
+		}
+		db.ranges = append(db.ranges, asnRange{start: start, end: end, asn: ASN{Number: uint32(num), Country: fields[3], Name: fields[4]}})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0 })
+	return db, nil
+}
+
+// Lookup 查询地址所属的 ASN，找不到时返回 nil
+func (db *ASNDB) Lookup(ip net.IP) *ASN {
+	if db == nil || ip == nil {
+		return nil
+	}
+	ip = ip.To16()
+	// 第一个起始地址大于 ip 的地址段的前一段
+	i := sort.Search(len(db.ranges), func(i int) bool { return bytes.Compare(db.ranges[i].start, ip) > 0 }) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].end) > 0 {
+		return nil
+	}
+	asn := db.ranges[i].asn
+	return &asn
+}
+
+// SetASNDB 设置 LookupIPInfo 使用的 ASN 数据库
+func SetASNDB(db *ASNDB) {
+	asnMu.Lock()
+	defer asnMu.Unlock()
+	asnDB = db
+}
+
+// LookupIPInfo 查询 IP 的反向解析结果，以及本地数据库中的 ASN 信息
+func LookupIPInfo(ctx context.Context, addr string) (IPInfo, error) {
+	addr = strings.Trim(strings.TrimSpace(addr), "[]")
+	rst := IPInfo{IP: addr}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return rst, fmt.Errorf("invalid ip address %q", addr)
+	}
+	if err := CheckTarget(ip); err != nil {
+		return rst, err
+	}
+	rst.IP = ip.String()
+
+	asnMu.RLock()
+	rst.ASN = asnDB.Lookup(ip)
+	asnMu.RUnlock()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	hosts, err := net.DefaultResolver.LookupAddr(ctx, rst.IP)
+	if err != nil {
+		// 没有反向解析记录不算错误
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return rst, err
+		}
+	}
+	rst.Hosts = hosts
+	return rst, nil
+}
@@ -0,0 +1,162 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultTimeout 运维工具单次探测的超时时间
+const DefaultTimeout = 10 * time.Second
+
+// ErrTargetDenied 目标地址不在允许探测的范围内
+var ErrTargetDenied = errors.New("target address is not allowed")
+
+// DefaultDenyNetworks 未配置拒绝列表时默认禁止探测的网段：内网、回环、链路本地、组播等
+var DefaultDenyNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// TargetPolicy 探测目标的网段限制
+// 命中 allow 的地址总是允许，用于放行指定的内网地址；其余命中 deny 的地址拒绝
+type TargetPolicy struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewTargetPolicy 解析网段配置，deny 为空时使用 DefaultDenyNetworks
+// 网段可以写成 CIDR 或单个 IP
+func NewTargetPolicy(allow, deny []string) (*TargetPolicy, error) {
+	if len(deny) == 0 {
+		deny = DefaultDenyNetworks
+	}
+	p := &TargetPolicy{}
+	var err error
+	if p.allow, err = parseNetworks(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parseNetworks(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Allowed 判断地址是否允许探测
+func (p *TargetPolicy) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range p.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	for _, n := range p.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var rst []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network: %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %q", s)
+		}
+		rst = append(rst, n)
+	}
+	return rst, nil
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   *TargetPolicy
+)
+
+// SetTargetPolicy 设置探测目标的网段限制
+func SetTargetPolicy(p *TargetPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	policy = p
+}
+
+func currentPolicy() *TargetPolicy {
+	policyMu.RLock()
+	p := policy
+	policyMu.RUnlock()
+	if p == nil {
+		p, _ = NewTargetPolicy(nil, nil)
+	}
+	return p
+}
+
+// CheckTarget 检查地址是否允许探测
+func CheckTarget(ip net.IP) error {
+	if !currentPolicy().Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrTargetDenied, ip)
+	}
+	return nil
+}
+
+// targetDialer 在真正建立连接前检查目标地址，域名解析结果和重定向后的地址同样受限制
+func targetDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: DefaultTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return CheckTarget(net.ParseIP(host))
+		},
+	}
+}
+
+// withTimeout 没有设置截止时间的 ctx 加上默认超时
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultTimeout)
+}
@@ -0,0 +1,234 @@
+package ops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// allowLoopback 测试期间放行回环地址
+func allowLoopback(t *testing.T) {
+	p, err := NewTargetPolicy([]string{"127.0.0.1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTargetPolicy(p)
+	t.Cleanup(func() { SetTargetPolicy(nil) })
+}
+
+func TestTargetPolicy(t *testing.T) {
+	p, err := NewTargetPolicy([]string{"10.1.2.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"8.8.8.8":            true,
+		"10.0.0.1":           false,
+		"10.1.2.3":           true,
+		"127.0.0.1":          false,
+		"169.254.169.254":    false,
+		"::1":                false,
+		"::ffff:192.168.1.1": false,
+		"2001:4860::8888":    true,
+	}
+	for addr, want := range cases {
+		if got := p.Allowed(net.ParseIP(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if _, err := NewTargetPolicy([]string{"not-a-network"}, nil); err == nil {
+		t.Errorf("invalid network should be rejected")
+	}
+}
+
+func TestCheckTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if _, err := CheckTCP(context.Background(), ln.Addr().String()); !errors.Is(err, ErrTargetDenied) {
+		t.Errorf("loopback should be denied by default, got %v", err)
+	}
+	allowLoopback(t)
+	rst, err := CheckTCP(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatalf("CheckTCP error: %v", err)
+	}
+	if rst.RemoteAddr != ln.Addr().String() {
+		t.Errorf("remote addr = %s, want %s", rst.RemoteAddr, ln.Addr())
+	}
+	if _, err := CheckTCP(context.Background(), "127.0.0.1"); err == nil {
+		t.Errorf("address without port should be rejected")
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if _, err := ProbeHTTP(context.Background(), srv.URL+"/old"); !errors.Is(err, ErrTargetDenied) {
+		t.Errorf("loopback should be denied by default, got %v", err)
+	}
+	allowLoopback(t)
+	rst, err := ProbeHTTP(context.Background(), srv.URL+"/old")
+	if err != nil {
+		t.Fatalf("ProbeHTTP error: %v", err)
+	}
+	if rst.StatusCode != http.StatusTeapot || rst.Server != "test" || !strings.HasSuffix(rst.URL, "/new") {
+		t.Errorf("unexpected result: %+v", rst)
+	}
+	if len(rst.Redirects) != 1 || rst.Redirects[0].StatusCode != http.StatusMovedPermanently {
+		t.Errorf("redirects = %+v, want one 301", rst.Redirects)
+	}
+
+	tlsSrv := httptest.NewTLSServer(mux)
+	defer tlsSrv.Close()
+	rst, err = ProbeHTTP(context.Background(), tlsSrv.URL+"/new")
+	if err != nil {
+		t.Fatalf("ProbeHTTP tls error: %v", err)
+	}
+	if rst.TLS == nil || rst.TLS.VerifyError == "" {
+		t.Errorf("self-signed certificate should be reported, got %+v", rst.TLS)
+	}
+}
+
+// serveDNS 一个只会回答 A 记录的 DNS 服务器，所有查询都返回 192.0.2.1
+func serveDNS(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := buf[:n]
+			// 跳过问题中的域名，再加上类型和类别
+			end := 12
+			for end < len(q) && q[end] != 0 {
+				end += int(q[end]) + 1
+			}
+			end += 5
+			if end > len(q) {
+				continue
+			}
+			resp := append([]byte{}, q[:2]...)
+			resp = append(resp, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0)
+			resp = append(resp, q[12:end]...)
+			resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1)
+			if binary.BigEndian.Uint16(q[end-4:end-2]) != 1 {
+				// 非 A 记录返回空应答
+				resp[7] = 0
+				resp = resp[:len(resp)-16]
+			}
+			_, _ = pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestLookupDNS(t *testing.T) {
+	server := serveDNS(t)
+	if _, err := LookupDNS(context.Background(), "example.com", "A", server); err == nil {
+		t.Errorf("loopback resolver should be denied by default")
+	}
+	allowLoopback(t)
+	rst, err := LookupDNS(context.Background(), "example.com", "", server)
+	if err != nil {
+		t.Fatalf("LookupDNS error: %v", err)
+	}
+	if rst.Type != "A" || len(rst.Records) != 1 || rst.Records[0] != "192.0.2.1" {
+		t.Errorf("unexpected result: %+v", rst)
+	}
+	if _, err := LookupDNS(context.Background(), "example.com", "SOA", server); err == nil {
+		t.Errorf("unsupported type should be rejected")
+	}
+}
+
+func TestASNDB(t *testing.T) {
+	data := "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"8.8.8.0\t8.8.8.255\t15169\tUS\tGOOGLE\n" +
+		"2001:4860::\t2001:4860:ffff:ffff:ffff:ffff:ffff:ffff\t15169\tUS\tGOOGLE\n"
+	db, err := ParseASNDB(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]uint32{
+		"1.0.0.1":         13335,
+		"1.0.2.1":         0,
+		"8.8.8.8":         15169,
+		"8.8.9.1":         0,
+		"2001:4860::8888": 15169,
+	}
+	for addr, want := range cases {
+		var got uint32
+		if asn := db.Lookup(net.ParseIP(addr)); asn != nil {
+			got = asn.Number
+		}
+		if got != want {
+			t.Errorf("Lookup(%s) = %d, want %d", addr, got, want)
+		}
+	}
+}
+
+func TestFetchFeed(t *testing.T) {
+	allowLoopback(t)
+	feeds := map[string]string{
+		"/rss": `<?xml version="1.0" encoding="GB2312"?>
+<rss version="2.0"><channel><title>云计算周刊</title>
+<item><title>第一篇</title><link>https://example.com/1</link><pubDate>Mon, 20 May 2024 08:00:00 +0800</pubDate><description><![CDATA[<p>Kubernetes 1.30 &amp; 新特性</p>]]></description></item>
+<item><title>第二篇</title><link>https://example.com/2</link></item>
+</channel></rss>`,
+		"/atom": `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Ops Blog</title>
+<entry><title>Hello</title><link rel="self" href="https://example.com/self"/><link href="https://example.com/hello"/><updated>2024-05-20T00:00:00Z</updated><content type="html">&lt;b&gt;world&lt;/b&gt;</content></entry>
+</feed>`,
+		"/html": `<html><body>not a feed</body></html>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(feeds[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	rst, err := FetchFeed(context.Background(), srv.URL+"/rss", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rst.Title != "云计算周刊" || len(rst.Items) != 1 || rst.Items[0].Link != "https://example.com/1" || rst.Items[0].Summary != "Kubernetes 1.30 & 新特性" {
+		t.Errorf("unexpected rss result: %+v", rst)
+	}
+	rst, err = FetchFeed(context.Background(), srv.URL+"/atom", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rst.Title != "Ops Blog" || len(rst.Items) != 1 || rst.Items[0].Link != "https://example.com/hello" || rst.Items[0].Summary != "world" || rst.Items[0].Published == "" {
+		t.Errorf("unexpected atom result: %+v", rst)
+	}
+	if _, err := FetchFeed(context.Background(), srv.URL+"/html", 0); err == nil {
+		t.Error("expected error with html page")
+	}
+	SetTargetPolicy(nil)
+	if _, err := FetchFeed(context.Background(), srv.URL+"/rss", 0); !errors.Is(err, ErrTargetDenied) {
+		t.Errorf("expected ErrTargetDenied, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TCPResult 端口检测结果
+type TCPResult struct {
+	Addr       string        `json:"addr"`
+	RemoteAddr string        `json:"remote_addr"`
+	Latency    time.Duration `json:"latency_ns"`
+}
+
+// CheckTCP 检测 host:port 是否可以建立 TCP 连接
+func CheckTCP(ctx context.Context, addr string) (TCPResult, error) {
+	rst := TCPResult{Addr: addr}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return rst, fmt.Errorf("invalid address %q, expected host:port", addr)
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := targetDialer().DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return rst, err
+	}
+	defer conn.Close()
+	rst.Latency = time.Since(start)
+	rst.RemoteAddr = conn.RemoteAddr().String()
+	return rst, nil
+}
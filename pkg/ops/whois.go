@@ -0,0 +1,440 @@
+package ops
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 域名信息
+type DomainMsg struct {
+	Domain      string   `json:"domain"`
+	CreateDate  string   `json:"create_date"`
+	ExpiryDate  string   `json:"expiry_date"`
+	UpdatedDate string   `json:"updated_date"`
+	Registrar   string   `json:"registrar"`
+	Status      []string `json:"status"`
+	NameServers []string `json:"name_servers"`
+	// Source 查询方式，rdap 或 whois
+	Source string `json:"source"`
+	// Server 实际查询的 RDAP 地址或 WHOIS 服务器
+	Server string `json:"server"`
+}
+
+const (
+	// maxWhoisResponse WHOIS 响应的最大长度
+	maxWhoisResponse = 1 << 20
+	// whoisReferralTTL IANA 引荐结果及 RDAP 引导文件的缓存时间
+	whoisReferralTTL = 24 * time.Hour
+)
+
+var (
+	// rdapBootstrapURL IANA 发布的 RDAP 服务引导文件
+	rdapBootstrapURL = "https://data.iana.org/rdap/dns.json"
+	// ianaWhoisServer 查询顶级域名对应的 WHOIS 服务器
+	ianaWhoisServer = "whois.iana.org"
+	// whoisDial 建立 WHOIS 连接，与其他探测一样受网段限制，测试时替换
+	whoisDial = func(ctx context.Context, addr string) (net.Conn, error) {
+		return targetDialer().DialContext(ctx, "tcp", addr)
+	}
+)
+
+// whoisServers 常用顶级域名的 WHOIS 服务器，其余通过 IANA 引荐查询
+var whoisServers = map[string]string{
+	"com":  "whois.verisign-grs.com",
+	"net":  "whois.verisign-grs.com",
+	"org":  "whois.pir.org",
+	"cn":   "whois.cnnic.cn",
+	"io":   "whois.nic.io",
+	"me":   "whois.nic.me",
+	"info": "whois.nic.info",
+	"biz":  "whois.nic.biz",
+	"top":  "whois.nic.top",
+	"xyz":  "whois.nic.xyz",
+	"co":   "whois.nic.co",
+	"cc":   "ccwhois.verisign-grs.com",
+	"tv":   "tvwhois.verisign-grs.com",
+	"dev":  "whois.nic.google",
+	"app":  "whois.nic.google",
+	"uk":   "whois.nic.uk",
+	"de":   "whois.denic.de",
+	"jp":   "whois.jprs.jp",
+	"hk":   "whois.hkirc.hk",
+	"tw":   "whois.twnic.net.tw",
+}
+
+// referralCache 缓存 IANA 引荐结果及 RDAP 引导文件
+var referralCache = struct {
+	sync.Mutex
+	whois      map[string]string
+	rdap       map[string]string
+	rdapExpire time.Time
+}{whois: map[string]string{}}
+
+// GetDomainMsg 获取域名信息
+func GetDomainMsg(domain string) (DomainMsg, error) {
+	return LookupDomain(context.Background(), domain)
+}
+
+// LookupDomain 查询域名注册信息，优先使用 RDAP，顶级域名不支持 RDAP 或查询失败时回退到 WHOIS
+func LookupDomain(ctx context.Context, domain string) (DomainMsg, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	dm := DomainMsg{Domain: domain}
+	if domain == "" || !strings.Contains(domain, ".") {
+		return dm, fmt.Errorf("invalid domain %q", domain)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*DefaultTimeout)
+	defer cancel()
+
+	rdapErr := errors.New("rdap not available")
+	if base := rdapServer(ctx, tld(domain)); base != "" {
+		if dm, rdapErr = lookupRDAP(ctx, base, domain); rdapErr == nil {
+			return dm, nil
+		}
+	}
+	dm, err := lookupWhois(ctx, domain)
+	if err != nil {
+		return dm, fmt.Errorf("%v; whois: %v", rdapErr, err)
+	}
+	return dm, nil
+}
+
+func tld(domain string) string {
+	return domain[strings.LastIndex(domain, ".")+1:]
+}
+
+// rdapServer 根据引导文件查找顶级域名的 RDAP 服务地址，找不到时返回空
+func rdapServer(ctx context.Context, tld string) string {
+	referralCache.Lock()
+	defer referralCache.Unlock()
+	if time.Now().After(referralCache.rdapExpire) {
+		services, err := loadRDAPBootstrap(ctx)
+		if err != nil {
+			// 获取失败时沿用旧的结果，10 分钟后再重试，期间没有结果的直接使用 WHOIS
+			referralCache.rdapExpire = time.Now().Add(10 * time.Minute)
+		} else {
+			referralCache.rdap = services
+			referralCache.rdapExpire = time.Now().Add(whoisReferralTTL)
+		}
+	}
+	return referralCache.rdap[tld]
+}
+
+func loadRDAPBootstrap(ctx context.Context) (map[string]string, error) {
+	var bootstrap struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := getJSON(ctx, rdapBootstrapURL, &bootstrap); err != nil {
+		return nil, err
+	}
+	services := map[string]string{}
+	for _, svc := range bootstrap.Services {
+		if len(svc) < 2 || len(svc[1]) == 0 {
+			continue
+		}
+		// 优先使用 https 地址
+		base := svc[1][0]
+		for _, u := range svc[1] {
+			if strings.HasPrefix(u, "https://") {
+				base = u
+				break
+			}
+		}
+		for _, t := range svc[0] {
+			services[strings.ToLower(t)] = base
+		}
+	}
+	return services, nil
+}
+
+// rdapDomain RDAP 域名查询响应中用到的字段
+type rdapDomain struct {
+	LDHName string   `json:"ldhName"`
+	Status  []string `json:"status"`
+	Events  []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	NameServers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+	Entities []struct {
+		Roles      []string        `json:"roles"`
+		VCardArray json.RawMessage `json:"vcardArray"`
+	} `json:"entities"`
+}
+
+func lookupRDAP(ctx context.Context, base, domain string) (DomainMsg, error) {
+	dm := DomainMsg{Domain: domain, Source: "rdap"}
+	dm.Server = strings.TrimSuffix(base, "/") + "/domain/" + domain
+	var rst rdapDomain
+	if err := getJSON(ctx, dm.Server, &rst); err != nil {
+		return dm, err
+	}
+	for _, e := range rst.Events {
+		switch e.Action {
+		case "registration":
+			dm.CreateDate = e.Date
+		case "expiration":
+			dm.ExpiryDate = e.Date
+		case "last changed":
+			dm.UpdatedDate = e.Date
+		}
+	}
+	dm.Status = rst.Status
+	for _, ns := range rst.NameServers {
+		dm.NameServers = append(dm.NameServers, strings.ToLower(ns.LDHName))
+	}
+	for _, e := range rst.Entities {
+		for _, role := range e.Roles {
+			if role == "registrar" {
+				dm.Registrar = vcardName(e.VCardArray)
+			}
+		}
+	}
+	return dm, nil
+}
+
+// vcardName 读取 jCard 中的 fn 字段，格式为 ["vcard", [["fn", {}, "text", "名称"], ...]]
+func vcardName(raw json.RawMessage) string {
+	var card []json.RawMessage
+	if json.Unmarshal(raw, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	var props [][]interface{}
+	if json.Unmarshal(card[1], &props) != nil {
+		return ""
+	}
+	for _, p := range props {
+		if len(p) >= 4 && p[0] == "fn" {
+			if name, ok := p[3].(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+	// RDAP 地址来自引导文件，重定向的地址也可能指向内网，统一检查目标地址
+	transport := &http.Transport{
+		Proxy:             nil,
+		DialContext:       targetDialer().DialContext,
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: DefaultTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxWhoisResponse)).Decode(v)
+}
+
+// lookupWhois 通过 WHOIS 查询域名，注册局只返回简要信息时继续查询注册商的 WHOIS 服务器
+func lookupWhois(ctx context.Context, domain string) (DomainMsg, error) {
+	dm := DomainMsg{Domain: domain, Source: "whois"}
+	server, err := whoisServer(ctx, tld(domain))
+	if err != nil {
+		return dm, err
+	}
+	dm.Server = server
+	resp, err := queryWhois(ctx, server, domain)
+	if err != nil {
+		return dm, err
+	}
+	fields := parseWhois(resp)
+	if refer := first(fields["registrar whois server"]); refer != "" && !strings.EqualFold(refer, server) {
+		if detail, err := queryWhois(ctx, refer, domain); err == nil {
+			for k, v := range parseWhois(detail) {
+				if len(fields[k]) == 0 {
+					fields[k] = v
+				}
+			}
+		}
+	}
+	fillDomainMsg(&dm, fields)
+	if dm.ExpiryDate == "" && dm.CreateDate == "" && dm.Registrar == "" {
+		if strings.Contains(strings.ToLower(resp), "no match") || strings.Contains(strings.ToLower(resp), "not found") {
+			return dm, fmt.Errorf("domain %s is not registered", domain)
+		}
+		return dm, fmt.Errorf("no registration data found for %s from %s", domain, server)
+	}
+	return dm, nil
+}
+
+// whoisServer 查找顶级域名的 WHOIS 服务器，不在内置表中时向 IANA 查询
+func whoisServer(ctx context.Context, tld string) (string, error) {
+	if server, ok := whoisServers[tld]; ok {
+		return server, nil
+	}
+	referralCache.Lock()
+	server, ok := referralCache.whois[tld]
+	referralCache.Unlock()
+	if ok {
+		return server, nil
+	}
+	resp, err := queryWhois(ctx, ianaWhoisServer, tld)
+	if err != nil {
+		return "", err
+	}
+	server = first(parseWhois(resp)["refer"])
+	if server == "" {
+		server = first(parseWhois(resp)["whois"])
+	}
+	if server == "" {
+		return "", fmt.Errorf("no whois server found for .%s", tld)
+	}
+	referralCache.Lock()
+	referralCache.whois[tld] = server
+	referralCache.Unlock()
+	return server, nil
+}
+
+// queryWhois 发送查询并读取完整响应，注册商的服务器来自 WHOIS 响应，其中的端口会被忽略，总是使用 43 端口
+func queryWhois(ctx context.Context, server, query string) (string, error) {
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		server = host
+	}
+	server = net.JoinHostPort(server, "43")
+	conn, err := whoisDial(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(DefaultTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write([]byte(query + "\r\n")); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, maxWhoisResponse))
+	if err != nil && len(data) == 0 {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseWhois 将 WHOIS 响应解析为 字段名(小写) -> 值列表，忽略注释和说明文字
+func parseWhois(resp string) map[string][]string {
+	fields := map[string][]string{}
+	sc := bufio.NewScanner(strings.NewReader(resp))
+	sc.Buffer(make([]byte, 64*1024), maxWhoisResponse)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ">>>") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:idx]))
+		val := strings.TrimSpace(line[idx+1:])
+		if val == "" || len(key) > 50 {
+			continue
+		}
+		fields[key] = append(fields[key], val)
+	}
+	return fields
+}
+
+// whois 字段的常见写法，不同注册局的字段名和顺序各不相同
+var (
+	whoisCreateKeys    = []string{"creation date", "created", "registration time", "registered on", "created on", "domain record activated"}
+	whoisExpiryKeys    = []string{"registry expiry date", "registrar registration expiration date", "expiry date", "expiration date", "expiration time", "paid-till", "expires", "expires on", "expire date"}
+	whoisUpdatedKeys   = []string{"updated date", "last modified", "last updated", "changed", "modified"}
+	whoisRegistrarKeys = []string{"registrar", "sponsoring registrar", "registrar name"}
+	whoisStatusKeys    = []string{"domain status", "status", "state"}
+	whoisNSKeys        = []string{"name server", "nserver", "name servers", "nameserver"}
+)
+
+func fillDomainMsg(dm *DomainMsg, fields map[string][]string) {
+	lookup := func(keys []string) []string {
+		for _, k := range keys {
+			if v := fields[k]; len(v) > 0 {
+				return v
+			}
+		}
+		return nil
+	}
+	dm.CreateDate = first(lookup(whoisCreateKeys))
+	dm.ExpiryDate = first(lookup(whoisExpiryKeys))
+	dm.UpdatedDate = first(lookup(whoisUpdatedKeys))
+	dm.Registrar = first(lookup(whoisRegistrarKeys))
+	seen := map[string]bool{}
+	for _, s := range lookup(whoisStatusKeys) {
+		// 去掉状态后面附带的说明链接
+		s = strings.Fields(s)[0]
+		if !seen[s] {
+			seen[s] = true
+			dm.Status = append(dm.Status, s)
+		}
+	}
+	seenNS := map[string]bool{}
+	for _, ns := range lookup(whoisNSKeys) {
+		ns = strings.ToLower(strings.Fields(ns)[0])
+		if !seenNS[ns] {
+			seenNS[ns] = true
+			dm.NameServers = append(dm.NameServers, ns)
+		}
+	}
+}
+
+func first(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// whoisTimeLayouts WHOIS 及 RDAP 中常见的时间格式
+var whoisTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02",
+	"2006.01.02",
+	"2006/01/02",
+	"02-Jan-2006",
+	"02.01.2006",
+	"January 02 2006",
+}
+
+// ParseWhoisTime 解析域名信息中的时间
+func ParseWhoisTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range whoisTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	// 部分注册局在时间后面附带时区等说明，只取日期部分再试一次
+	if fields := strings.Fields(s); len(fields) > 1 {
+		if t, err := time.Parse("2006-01-02", fields[0]); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time format: %q", s)
+}
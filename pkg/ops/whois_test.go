@@ -0,0 +1,197 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const verisignResp = `   Domain Name: EXAMPLE.COM
+   Registry Domain ID: 2336799_DOMAIN_COM-VRSN
+   Registrar WHOIS Server: whois.example-registrar.com
+   Updated Date: 2024-08-14T07:01:34Z
+   Creation Date: 1995-08-14T04:00:00Z
+   Registry Expiry Date: 2025-08-13T04:00:00Z
+   Registrar: RESERVED-Internet Assigned Numbers Authority
+   Domain Status: clientDeleteProhibited https://icann.org/epp#clientDeleteProhibited
+   Domain Status: clientTransferProhibited https://icann.org/epp#clientTransferProhibited
+   Name Server: A.IANA-SERVERS.NET
+   Name Server: B.IANA-SERVERS.NET
+>>> Last update of whois database: 2024-09-01T00:00:00Z <<<
+`
+
+const cnnicResp = `Domain Name: example.cn
+ROID: 20030312s10001s00033735-cn
+Domain Status: ok
+Registrant: 示例公司
+Sponsoring Registrar: 阿里云计算有限公司（万网）
+Name Server: ns1.example.cn
+Name Server: ns2.example.cn
+Registration Time: 2003-03-12 19:36:50
+Expiration Time: 2030-03-12 19:36:50
+`
+
+func TestParseWhois(t *testing.T) {
+	dm := DomainMsg{}
+	fillDomainMsg(&dm, parseWhois(verisignResp))
+	if dm.CreateDate != "1995-08-14T04:00:00Z" || dm.ExpiryDate != "2025-08-13T04:00:00Z" || dm.UpdatedDate != "2024-08-14T07:01:34Z" {
+		t.Errorf("unexpected dates: %+v", dm)
+	}
+	if dm.Registrar != "RESERVED-Internet Assigned Numbers Authority" {
+		t.Errorf("registrar = %q", dm.Registrar)
+	}
+	if strings.Join(dm.Status, ",") != "clientDeleteProhibited,clientTransferProhibited" {
+		t.Errorf("status = %v", dm.Status)
+	}
+	if strings.Join(dm.NameServers, ",") != "a.iana-servers.net,b.iana-servers.net" {
+		t.Errorf("name servers = %v", dm.NameServers)
+	}
+
+	dm = DomainMsg{}
+	fillDomainMsg(&dm, parseWhois(cnnicResp))
+	if dm.CreateDate != "2003-03-12 19:36:50" || dm.ExpiryDate != "2030-03-12 19:36:50" || dm.Registrar != "阿里云计算有限公司（万网）" {
+		t.Errorf("unexpected cnnic result: %+v", dm)
+	}
+}
+
+// serveWhois 本地 WHOIS 服务器，responses 为 查询内容 -> 响应
+func serveWhois(t *testing.T, responses map[string]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				n, _ := conn.Read(buf)
+				query := strings.TrimSpace(string(buf[:n]))
+				resp, ok := responses[query]
+				if !ok {
+					resp = "No match for \"" + query + "\".\n"
+				}
+				// 分多次写入，验证能够读取完整响应
+				for _, line := range strings.SplitAfter(resp, "\n") {
+					_, _ = conn.Write([]byte(line))
+				}
+			}(conn)
+		}
+	}()
+	oldDial, oldBootstrap := whoisDial, rdapBootstrapURL
+	whoisDial = func(ctx context.Context, addr string) (net.Conn, error) {
+		return net.Dial("tcp", ln.Addr().String())
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		whoisDial, rdapBootstrapURL = oldDial, oldBootstrap
+		referralCache.Lock()
+		referralCache.whois = map[string]string{}
+		referralCache.rdap = nil
+		referralCache.rdapExpire = referralCache.rdapExpire.AddDate(-1, 0, 0)
+		referralCache.Unlock()
+	})
+}
+
+func TestLookupDomain_Whois(t *testing.T) {
+	serveWhois(t, map[string]string{
+		"example.com": verisignResp,
+		"example.zz":  cnnicResp,
+		"zz":          "domain:       ZZ\nrefer:        whois.nic.zz\n",
+	})
+	// RDAP 引导文件不可用时回退到 WHOIS
+	rdapBootstrapURL = "http://127.0.0.1:1/dns.json"
+
+	dm, err := LookupDomain(context.Background(), "Example.com.")
+	if err != nil {
+		t.Fatalf("LookupDomain error: %v", err)
+	}
+	if dm.Source != "whois" || dm.ExpiryDate != "2025-08-13T04:00:00Z" || len(dm.NameServers) != 2 {
+		t.Errorf("unexpected result: %+v", dm)
+	}
+
+	// 不在内置表中的顶级域名通过 IANA 引荐查找服务器
+	dm, err = LookupDomain(context.Background(), "example.zz")
+	if err != nil {
+		t.Fatalf("LookupDomain error: %v", err)
+	}
+	if dm.Server != "whois.nic.zz" || dm.Registrar != "阿里云计算有限公司（万网）" {
+		t.Errorf("unexpected result: %+v", dm)
+	}
+
+	if _, err := LookupDomain(context.Background(), "missing.com"); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("unregistered domain error = %v", err)
+	}
+	if _, err := LookupDomain(context.Background(), "localhost"); err == nil {
+		t.Errorf("invalid domain should be rejected")
+	}
+}
+
+func TestLookupDomain_RDAP(t *testing.T) {
+	serveWhois(t, nil)
+	allowLoopback(t)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/dns.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"services":[[["test"],["%s/rdap/"]]]}`, srv.URL)
+	})
+	mux.HandleFunc("/rdap/domain/example.test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rdap+json")
+		fmt.Fprint(w, `{
+			"ldhName": "EXAMPLE.TEST",
+			"status": ["client transfer prohibited"],
+			"events": [
+				{"eventAction": "registration", "eventDate": "2001-01-01T00:00:00Z"},
+				{"eventAction": "expiration", "eventDate": "2031-01-01T00:00:00Z"},
+				{"eventAction": "last changed", "eventDate": "2024-01-01T00:00:00Z"}
+			],
+			"nameservers": [{"ldhName": "NS1.EXAMPLE.TEST"}],
+			"entities": [{"roles": ["registrar"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Registrar"]]]}]
+		}`)
+	})
+	rdapBootstrapURL = srv.URL + "/dns.json"
+
+	dm, err := LookupDomain(context.Background(), "example.test")
+	if err != nil {
+		t.Fatalf("LookupDomain error: %v", err)
+	}
+	if dm.Source != "rdap" || dm.Registrar != "Example Registrar" || dm.ExpiryDate != "2031-01-01T00:00:00Z" ||
+		dm.CreateDate != "2001-01-01T00:00:00Z" || len(dm.NameServers) != 1 || dm.NameServers[0] != "ns1.example.test" {
+		t.Errorf("unexpected result: %+v", dm)
+	}
+}
+
+func TestLookupDomain_TargetDenied(t *testing.T) {
+	// 注册商的 WHOIS 服务器和 RDAP 地址都来自远端响应，不能用来访问内网
+	if _, err := queryWhois(context.Background(), "127.0.0.1:6379", "example.com"); !errors.Is(err, ErrTargetDenied) {
+		t.Errorf("expected ErrTargetDenied for whois, got %v", err)
+	}
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	var v interface{}
+	if err := getJSON(context.Background(), srv.URL, &v); !errors.Is(err, ErrTargetDenied) {
+		t.Errorf("expected ErrTargetDenied for rdap, got %v", err)
+	}
+}
+
+func TestParseWhoisTime(t *testing.T) {
+	for _, s := range []string{"2025-08-13T04:00:00Z", "2025-08-13T04:00:00.0Z", "2025-08-13 04:00:00", "2025-08-13", "13-Aug-2025", "2025-08-13 (YYYY-MM-DD)"} {
+		got, err := ParseWhoisTime(s)
+		if err != nil || got.Format("2006-01-02") != "2025-08-13" {
+			t.Errorf("ParseWhoisTime(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseWhoisTime("soon"); err == nil {
+		t.Errorf("invalid time should be rejected")
+	}
+}
@@ -0,0 +1,116 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/cache"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 会话附件在此处理，附件只在当前会话中有效，随会话过期或重置而清除
+
+const (
+	// 单个会话最多保留的附件数
+	maxAttachments = 5
+	// 附件最多保留的字数，超出部分丢弃
+	maxAttachmentRunes = 200000
+	// 不超过该字数的附件提问时直接附上全文，否则检索相关片段
+	inlineAttachmentRunes = 3000
+)
+
+// AttachFile 提取文件内容作为当前会话的附件，并切换到串聊模式
+func AttachFile(ctx context.Context, rmsg *dingbot.ReceiveMsg) error {
+	reply := func(msg string) error {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	name := rmsg.Content.FileName
+	text, err := extractMessageFile(ctx, rmsg)
+	if err != nil {
+		return reply(err.Error())
+	}
+	note := ""
+	runes := []rune(text)
+	if len(runes) > maxAttachmentRunes {
+		text = string(runes[:maxAttachmentRunes])
+		note = fmt.Sprintf("\n\n> 文件内容较长，只保留了前 %d 字", maxAttachmentRunes)
+	}
+
+	att := cache.Attachment{Name: name, Text: text, AddedAt: time.Now()}
+	if len([]rune(text)) > inlineAttachmentRunes {
+		conf := public.Config.KnowledgeBase
+		att.Index, err = kb.NewIndex(kb.EmbedderFunc(llm.Embed), name, text, conf.ChunkSize, conf.ChunkOverlap)
+		if err != nil {
+			logger.Warning(fmt.Errorf("index attachment %s error: %v", name, err))
+			return reply(fmt.Sprintf("[Wrong] 处理文件失败了\n\n> 错误信息:%v", err))
+		}
+	}
+
+	userId := rmsg.GetSenderIdentifier()
+	attachments := []cache.Attachment{}
+	for _, a := range public.UserService.GetUserAttachments(userId) {
+		if a.Name != name {
+			attachments = append(attachments, a)
+		}
+	}
+	attachments = append(attachments, att)
+	if len(attachments) > maxAttachments {
+		attachments = attachments[len(attachments)-maxAttachments:]
+	}
+	// 先切换模式再保存附件，两者使用同样的过期时间
+	public.UserService.SetUserMode(userId, "串聊")
+	public.UserService.SetUserAttachments(userId, attachments)
+	logger.Info(fmt.Sprintf("📎 %s上传了附件 %s，共 %d 字", rmsg.SenderNick, name, len([]rune(text))))
+	return reply(fmt.Sprintf("**📎 已收到 %s，现在进入串聊模式，可以开始针对文件提问**%s\n\n> 附件将在 %s 后或发送 **重置** 时清除，发送 **#附件** 可查看当前附件", name, note, FormatTimeDuation(public.Config.SessionTimeout)))
+}
+
+// ListAttachments 列出当前会话中的附件
+func ListAttachments(rmsg *dingbot.ReceiveMsg) error {
+	attachments := public.UserService.GetUserAttachments(rmsg.GetSenderIdentifier())
+	msg := "**当前会话中没有附件**\n\n> 私聊发送文件给机器人即可针对文件提问"
+	if len(attachments) > 0 {
+		var b strings.Builder
+		b.WriteString("**📎 当前会话中的附件**\n\n")
+		for _, a := range attachments {
+			fmt.Fprintf(&b, "- %s（%d 字，%s 上传）\n", a.Name, len([]rune(a.Text)), a.AddedAt.Format("15:04:05"))
+		}
+		msg = b.String()
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return err
+}
+
+// attachmentResults 串聊时从会话附件中取出与问题相关的内容，较短的附件直接使用全文
+func attachmentResults(rmsg *dingbot.ReceiveMsg) []kb.Result {
+	attachments := public.UserService.GetUserAttachments(rmsg.GetSenderIdentifier())
+	if len(attachments) == 0 || !public.FirstCheck(rmsg) {
+		return nil
+	}
+	var results []kb.Result
+	for _, a := range attachments {
+		if a.Index == nil {
+			results = append(results, kb.Result{Doc: a.Name, Text: a.Text, Score: 1})
+			continue
+		}
+		rst, err := a.Index.Search(kb.EmbedderFunc(llm.Embed), rmsg.Text.Content, public.Config.KnowledgeBase.TopK, 0)
+		if err != nil {
+			logger.Warning(fmt.Errorf("search attachment %s error: %v", a.Name, err))
+			continue
+		}
+		results = append(results, rst...)
+	}
+	return results
+}
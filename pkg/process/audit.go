@@ -0,0 +1,94 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 审计日志中记录的动作
+const (
+	AuditActionChat       = "chat"
+	AuditActionBalance    = "balance"
+	AuditActionHistory    = "history"
+	AuditActionAudit      = "audit"
+	AuditActionModeration = "moderation"
+	AuditActionGuard      = "guard"
+	AuditActionKnowledge  = "knowledge"
+	AuditActionMonitor    = "monitor"
+	AuditActionSchedule   = "schedule"
+	AuditActionRecord     = "record"
+)
+
+// AddAudit 记录一条审计日志，写入失败只打印日志，不影响正常流程
+func AddAudit(rmsg *dingbot.ReceiveMsg, action, target, decision, reason string) {
+	aObj := db.Audit{
+		Actor:    rmsg.SenderNick,
+		ActorID:  rmsg.SenderStaffId,
+		Action:   action,
+		Target:   target,
+		Decision: decision,
+		Reason:   reason,
+		Source:   rmsg.GetChatTitle(),
+	}
+	_, err := aObj.Add()
+	if err != nil {
+		logger.Error("往MySQL新增审计数据失败,错误信息：", err)
+	}
+}
+
+// SelectAudit 查询审计日志
+// 指令格式: #审计 [用户名或userid] [条数]
+func SelectAudit(rmsg *dingbot.ReceiveMsg) error {
+	if !public.JudgeAdminUsers(rmsg.SenderStaffId) {
+		AddAudit(rmsg, AuditActionAudit, "", db.AuditDeny, "非管理员")
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，您没有查询审计日志的权限，只有程序管理员可以查询！**")
+		if err != nil {
+			logger.Error(fmt.Errorf("send message error: %v", err))
+			return err
+		}
+		return nil
+	}
+	req := db.AuditListReq{Limit: 20}
+	for _, arg := range strings.Fields(strings.TrimPrefix(rmsg.Text.Content, "#审计")) {
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			req.Limit = n
+		} else {
+			req.Actor = arg
+		}
+	}
+	AddAudit(rmsg, AuditActionAudit, req.Actor, db.AuditAllow, "")
+
+	var audit db.Audit
+	audits, err := audit.List(req)
+	if err != nil {
+		return err
+	}
+	if len(audits) == 0 {
+		_, err = rmsg.ReplyToDingtalk(string(dingbot.TEXT), "没有查询到审计日志")
+		if err != nil {
+			logger.Error(fmt.Errorf("send message error: %v", err))
+			return err
+		}
+		return nil
+	}
+	var rst string
+	for _, a := range audits {
+		decision := "✅"
+		if a.Decision == db.AuditDeny {
+			decision = "⛔"
+		}
+		rst += fmt.Sprintf("- %s %s **%s**(%s) `%s` %s %s\n", public.GetReadTime(a.CreatedAt), decision, a.Actor, a.Source, a.Action, a.Target, a.Reason)
+	}
+	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("### 📝 最近 %d 条审计日志\n\n%s", len(audits), rst))
+	if err != nil {
+		logger.Error(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package process
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eryajf/chatgpt-dingtalk/config"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// setAdmins 替换为只配置了管理员的配置
+func setAdmins(t *testing.T, admins ...string) {
+	t.Helper()
+	prev := public.Config
+	public.Config = &config.Configuration{AppSecrets: []string{"secret"}, AdminUsers: admins}
+	t.Cleanup(func() { public.Config = prev })
+}
+
+// lastAudit 最近一条审计记录
+func lastAudit(t *testing.T) db.Audit {
+	t.Helper()
+	var a db.Audit
+	if err := db.DB.Order("id DESC").First(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestSelectAudit_DeniesNonAdmin(t *testing.T) {
+	rmsg, replies := newReplyServer(t)
+	openTestDB(t)
+	setAdmins(t, "admin")
+	rmsg.Text.Content = "#审计"
+
+	if err := SelectAudit(rmsg); err != nil {
+		t.Fatal(err)
+	}
+	got := replies()
+	if len(got) != 1 || !strings.Contains(got[0], "没有查询审计日志的权限") {
+		t.Errorf("expected a permission denied reply, got %q", got)
+	}
+	if a := lastAudit(t); a.Action != AuditActionAudit || a.Decision != db.AuditDeny || a.ActorID != rmsg.SenderStaffId {
+		t.Errorf("expected the denied query to be audited, got %+v", a)
+	}
+}
+
+func TestSelectAudit_AdminFilters(t *testing.T) {
+	rmsg, replies := newReplyServer(t)
+	openTestDB(t)
+	setAdmins(t, rmsg.SenderStaffId)
+	for _, a := range []db.Audit{
+		{Actor: "张三", ActorID: "u1", Action: AuditActionChat, Decision: db.AuditDeny, Reason: "用户未被认证"},
+		{Actor: "张三", ActorID: "u1", Action: AuditActionHistory, Decision: db.AuditAllow},
+		{Actor: "李四", ActorID: "u2", Action: AuditActionChat, Decision: db.AuditAllow},
+	} {
+		if _, err := a.Add(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rmsg.Text.Content = "#审计 张三 1"
+
+	if err := SelectAudit(rmsg); err != nil {
+		t.Fatal(err)
+	}
+	got := replies()
+	if len(got) != 1 {
+		t.Fatalf("expected a single reply, got %q", got)
+	}
+	if !strings.Contains(got[0], "最近 1 条审计日志") || !strings.Contains(got[0], "`history`") || strings.Contains(got[0], "李四") {
+		t.Errorf("expected only the newest record of 张三, got %q", got[0])
+	}
+	if a := lastAudit(t); a.Action != AuditActionAudit || a.Decision != db.AuditAllow || a.Target != "张三" {
+		t.Errorf("expected the query to be audited, got %+v", a)
+	}
+}
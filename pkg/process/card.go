@@ -0,0 +1,280 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-dingtalk/dingtalk-stream-sdk-go/card"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 卡片按钮回传参数 action 的取值
+const (
+	CardActionRegenerate = "regenerate"
+	CardActionContinue   = "continue"
+	CardActionContext    = "context"
+	CardActionLike       = "like"
+	CardActionDislike    = "dislike"
+	CardActionStop       = "stop"
+)
+
+// continuePrompt 点击继续时发给模型的提问
+const continuePrompt = "请紧接着你上一条回答的结尾继续输出，不要重复已经输出的内容。"
+
+// answerCards 缓存回答卡片的状态，按卡片追踪ID索引
+var answerCards = cache.New(24*time.Hour, time.Hour)
+
+// answerCard 一张回答卡片的状态
+type answerCard struct {
+	sync.Mutex
+	mode   string
+	rmsg   dingbot.ReceiveMsg
+	answer string
+	qid    uint
+	aid    uint
+	// busy 正在重新生成或继续生成
+	busy bool
+}
+
+// rememberAnswerCard 记录回答卡片，供按钮回调使用
+func rememberAnswerCard(trackID, mode string, rmsg *dingbot.ReceiveMsg, answer string, qid, aid uint) {
+	answerCards.SetDefault(trackID, &answerCard{mode: mode, rmsg: *rmsg, answer: answer, qid: qid, aid: aid})
+}
+
+func getAnswerCard(trackID string) *answerCard {
+	if v, ok := answerCards.Get(trackID); ok {
+		return v.(*answerCard)
+	}
+	return nil
+}
+
+// OnCardCallback 处理回答卡片上的按钮回调
+func OnCardCallback(ctx context.Context, req *card.CardRequest) (*card.CardResponse, error) {
+	action := req.GetActionString("action")
+	logger.Info(fmt.Sprintf("🎴 卡片回调 action=%s trackID=%s userId=%s", action, req.OutTrackId, req.UserId))
+
+	var tip string
+	switch action {
+	case CardActionLike:
+		tip = rateCardAnswer(req.OutTrackId, req.UserId, db.FeedbackGood)
+	case CardActionDislike:
+		tip = rateCardAnswer(req.OutTrackId, req.UserId, db.FeedbackBad)
+	case CardActionStop:
+		tip = stopAnswerByTrack(req.OutTrackId, req.UserId)
+	case CardActionRegenerate, CardActionContinue, CardActionContext:
+		tip = handleCardAction(req.OutTrackId, req.UserId, action)
+	default:
+		return &card.CardResponse{}, nil
+	}
+	return &card.CardResponse{
+		CardUpdateOptions: &card.CardUpdateOptions{UpdatePrivateDataByKey: true},
+		UserPrivateData:   &card.CardDataDto{CardParamMap: map[string]string{"feedback": tip}},
+	}, nil
+}
+
+// rateCardAnswer 保存用户对卡片中最新回答的评价
+func rateCardAnswer(trackID, userID string, rating int) string {
+	var chat db.Chat
+	if err := (db.Chat{}).FindByTrackID(trackID, &chat); err != nil {
+		logger.Warning(fmt.Errorf("find chat by track id %s error: %v", trackID, err))
+		return "没有找到这条回答，可能已经被清理"
+	}
+	username := ""
+	if c := getAnswerCard(trackID); c != nil && c.rmsg.SenderStaffId == userID {
+		username = c.rmsg.SenderNick
+	}
+	err := saveFeedback(chat, userID, username, rating, "")
+	if err != nil {
+		logger.Error("保存评价失败,错误信息：", err)
+		return "评价失败，请稍后再试"
+	}
+	if rating == db.FeedbackGood {
+		return "👍 感谢你的评价"
+	}
+	return "👎 感谢反馈，我们会努力改进"
+}
+
+// handleCardAction 处理只有提问人可以使用的按钮，重新生成和继续会在后台更新同一张卡片
+func handleCardAction(trackID, userID, action string) string {
+	c := getAnswerCard(trackID)
+	if c == nil {
+		return "卡片已过期，请重新提问"
+	}
+	if c.rmsg.SenderStaffId == "" || c.rmsg.SenderStaffId != userID {
+		return "只有提问人可以使用该按钮"
+	}
+
+	if action == CardActionContext {
+		c.Lock()
+		question, answer := c.rmsg.Text.Content, c.answer
+		c.Unlock()
+		uid := c.rmsg.GetSenderIdentifier()
+		// 这已经是串聊中最近的一次回答时，上下文中已经有这一轮
+		if !c.latestContextAnswer() {
+			if err := llm.AppendHistory(uid, question, answer); err != nil {
+				logger.Error("保存对话上下文失败,错误信息：", err)
+				return "切换失败，请稍后再试"
+			}
+		}
+		public.UserService.SetUserMode(uid, "串聊")
+		public.UserService.SetAnswerID(c.rmsg.SenderNick, c.rmsg.GetChatTitle(), c.aid)
+		return "已切换到串聊，接下来的提问会接着这个回答继续"
+	}
+
+	client, ok := public.DingTalkClientManager.GetClientByOAuthClientID(c.rmsg.RobotCode).(*dingbot.DingTalkClient)
+	if !ok {
+		return "没有找到机器人的凭据，无法更新卡片"
+	}
+	c.Lock()
+	if c.busy {
+		c.Unlock()
+		return "正在生成中，请稍候"
+	}
+	// 重新生成和继续同样要调用模型，计入每日请求次数
+	if !requestAllowed(&c.rmsg) {
+		c.Unlock()
+		return "今日请求次数已达上限，请明天再来"
+	}
+	c.busy = true
+	c.Unlock()
+
+	go func() {
+		defer func() {
+			c.Lock()
+			c.busy = false
+			c.Unlock()
+		}()
+		if action == CardActionRegenerate {
+			regenerateCard(client, trackID, c)
+		} else {
+			continueCard(client, trackID, c)
+		}
+	}()
+	if action == CardActionRegenerate {
+		return "正在重新生成"
+	}
+	return "正在继续生成"
+}
+
+// regenerateCard 重新回答卡片中的问题。串聊中这是最近一次回答时，去掉这一轮后带着之前的对话重新回答，
+// 否则不带之前的回答重新回答
+func regenerateCard(client *dingbot.DingTalkClient, trackID string, c *answerCard) {
+	rmsg := c.rmsg
+	header := fmt.Sprintf("**%s**\n\n", rmsg.Text.Content)
+	updater := client.NewCardUpdater(trackID)
+	updater.Update(header + "稍等，让我重新想一想……")
+	ctx, done := startAnswer(&rmsg, trackID)
+	defer done()
+	var llmErr error
+	var model answerModel
+	opts := []llm.Option{llm.WithContext(ctx), llm.OnStreamError(func(err error) { llmErr = err }), model.option()}
+	if opt := toolOption(&rmsg, c.qid); opt != nil {
+		opts = append(opts, opt)
+	}
+
+	var cli *llm.Client
+	var contentCh <-chan string
+	var err error
+	if c.latestContextAnswer() {
+		cli, _, contentCh, err = llm.RetryQaStream("", rmsg.GetSenderIdentifier(), opts...)
+		if err == nil {
+			defer cli.Close()
+		} else if !errors.Is(err, llm.ErrNoLastTurn) {
+			if uerr := updater.Fail(fmt.Sprintf("%s出错了: %v", header, err)); uerr != nil {
+				logger.Warning(fmt.Errorf("failed to update error card: %v", uerr))
+			}
+			return
+		}
+	}
+	if cli == nil {
+		var cleanup func()
+		contentCh, cleanup, _ = llm.SingleQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
+		defer cleanup()
+	}
+	answer, err := streamCard(ctx, updater, &rmsg, header, contentCh, func() error { return llmErr })
+	if err != nil {
+		return
+	}
+	updateCardAnswer(trackID, c, answer, model.name(), cli)
+}
+
+// continueCard 让模型接着卡片中的回答继续输出，并追加到卡片中
+func continueCard(client *dingbot.DingTalkClient, trackID string, c *answerCard) {
+	rmsg := c.rmsg
+	c.Lock()
+	previous := c.answer
+	c.Unlock()
+	header := fmt.Sprintf("**%s**\n\n%s", rmsg.Text.Content, previous)
+	updater := client.NewCardUpdater(trackID)
+	ctx, done := startAnswer(&rmsg, trackID)
+	defer done()
+	var llmErr error
+	var model answerModel
+	opts := []llm.Option{
+		llm.WithContext(ctx),
+		llm.WithHistory(rmsg.Text.Content, previous),
+		llm.OnStreamError(func(err error) { llmErr = err }),
+		model.option(),
+	}
+	if opt := toolOption(&rmsg, c.qid); opt != nil {
+		opts = append(opts, opt)
+	}
+	contentCh, cleanup, _ := llm.SingleQaStream(continuePrompt, rmsg.GetSenderIdentifier(), opts...)
+	defer cleanup()
+	answer, err := streamCard(ctx, updater, &rmsg, header, contentCh, func() error { return llmErr })
+	if err != nil {
+		return
+	}
+	updateCardAnswer(trackID, c, previous+answer, model.name(), nil)
+}
+
+// latestContextAnswer 卡片中的回答是否为串聊中最近的一次回答
+func (c *answerCard) latestContextAnswer() bool {
+	c.Lock()
+	aid := c.aid
+	c.Unlock()
+	return c.mode == "串聊" && public.UserService.GetAnswerID(c.rmsg.SenderNick, c.rmsg.GetChatTitle()) == aid
+}
+
+// updateCardAnswer 保存卡片中新的回答以及生成回答的模型，串聊时如果这是最近的一次回答，同步更新对话上下文：
+// cli 不为空时保存 cli 中重新生成后的上下文，否则替换上下文中的最后一条回答
+func updateCardAnswer(trackID string, c *answerCard, answer, model string, cli *llm.Client) {
+	rmsg := c.rmsg
+	latest := c.latestContextAnswer()
+	aid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.A,
+		ParentContent: c.qid,
+		Content:       answer,
+		TrackID:       trackID,
+		ModelName:     model,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	if latest {
+		if cli != nil {
+			err = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
+		} else {
+			err = llm.ReplaceLastAnswer(rmsg.GetSenderIdentifier(), answer)
+		}
+		if err != nil {
+			logger.Error("更新对话上下文失败,错误信息：", err)
+		}
+		public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
+	}
+	c.Lock()
+	c.answer, c.aid = answer, aid
+	c.Unlock()
+	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, answer))
+}
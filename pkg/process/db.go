@@ -17,6 +17,7 @@ import (
 func SelectHistory(rmsg *dingbot.ReceiveMsg) error {
 	name := strings.TrimSpace(strings.Split(rmsg.Text.Content, ":")[1])
 	if !public.JudgeAdminUsers(rmsg.SenderStaffId) {
+		AddAudit(rmsg, AuditActionHistory, name, db.AuditDeny, "非管理员")
 		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，您没有查询对话记录的权限，只有程序管理员可以查询！**")
 		if err != nil {
 			logger.Error(fmt.Errorf("send message error: %v", err))
@@ -24,6 +25,7 @@ func SelectHistory(rmsg *dingbot.ReceiveMsg) error {
 		}
 		return nil
 	}
+	AddAudit(rmsg, AuditActionHistory, name, db.AuditAllow, "")
 	// 获取数据列表
 	var chat db.Chat
 	if !chat.Exist(map[string]interface{}{"username": name}) {
@@ -0,0 +1,201 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/cron"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// feedbackReportDays 评价报告统计的天数
+const feedbackReportDays = 7
+
+// Feedback 评价最近一次回答，#反馈 好/差 [原因]，管理员发送 #反馈 报告 查看最近的评价报告
+func Feedback(rmsg *dingbot.ReceiveMsg) error {
+	arg := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#反馈"))
+	verdict, reason, _ := strings.Cut(arg, " ")
+	reason = strings.TrimSpace(reason)
+
+	var rating int
+	switch verdict {
+	case "好", "赞", "👍":
+		rating = db.FeedbackGood
+	case "差", "踩", "👎":
+		rating = db.FeedbackBad
+	case "报告":
+		if !public.JudgeAdminUsers(rmsg.SenderStaffId) {
+			return replyMarkdown(rmsg, "**🤷 抱歉，只有管理员可以查看评价报告**")
+		}
+		return replyMarkdown(rmsg, FeedbackReport(time.Now()))
+	default:
+		return replyMarkdown(rmsg, "**用法:** #反馈 好/差 [原因]，评价最近一次回答，例如 `#反馈 差 答非所问`")
+	}
+
+	aid := public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
+	var answer db.Chat
+	if aid == 0 || (db.Chat{}).Find(map[string]interface{}{"id": aid}, &answer) != nil {
+		return replyMarkdown(rmsg, "**没有找到可以评价的回答，请先提问**")
+	}
+	if err := saveFeedback(answer, rmsg.GetSenderIdentifier(), rmsg.SenderNick, rating, reason); err != nil {
+		logger.Error("保存评价失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**评价失败，请稍后再试**")
+	}
+	if rating == db.FeedbackGood {
+		return replyMarkdown(rmsg, "**👍 感谢你的评价**")
+	}
+	return replyMarkdown(rmsg, "**👎 感谢反馈，我们会根据评价改进提示词**")
+}
+
+// saveFeedback 保存对回答的评价，模板根据回答对应的问题匹配
+func saveFeedback(answer db.Chat, userID, username string, rating int, reason string) error {
+	template := ""
+	var question db.Chat
+	if answer.ParentContent != 0 && (db.Chat{}).Find(map[string]interface{}{"id": answer.ParentContent}, &question) == nil {
+		template = MatchPrompt(question.Content)
+	}
+	return db.Feedback{
+		ChatID:    answer.ID,
+		UserID:    userID,
+		Username:  username,
+		Source:    answer.Source,
+		ModelName: answer.ModelName,
+		Template:  template,
+		Rating:    rating,
+		Reason:    reason,
+	}.Save()
+}
+
+// answerModel 记录生成回答的模型，随回答一起保存，评价时按这个模型统计。
+// 流式请求在单独的协程中确定模型，所以需要加锁
+type answerModel struct {
+	mu    sync.Mutex
+	model string
+}
+
+// option 返回记录模型的请求参数
+func (m *answerModel) option() llm.Option {
+	return llm.OnModel(func(name string) {
+		m.mu.Lock()
+		m.model = name
+		m.mu.Unlock()
+	})
+}
+
+// name 返回生成回答的模型，请求没有发出时为空
+func (m *answerModel) name() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.model
+}
+
+// FeedbackReport 生成最近 7 天的评价报告
+func FeedbackReport(now time.Time) string {
+	since := now.AddDate(0, 0, -feedbackReportDays)
+	var b strings.Builder
+	fmt.Fprintf(&b, "### 📊 回答评价报告\n\n**统计时间:** %s ~ %s\n\n", since.Format("01-02 15:04"), now.Format("01-02 15:04"))
+
+	sections := []struct{ column, title, empty string }{
+		{"model", "模型", "未知模型"},
+		{"template", "提示词模板", "未使用模板"},
+		{"source", "群", "未知来源"},
+	}
+	total := 0
+	for _, s := range sections {
+		stats, err := db.Feedback{}.Stats(s.column, since)
+		if err != nil {
+			logger.Error("统计评价失败,错误信息：", err)
+			return "**统计评价失败，请稍后再试**"
+		}
+		if s.column == "model" {
+			for _, st := range stats {
+				total += st.Good + st.Bad
+			}
+			if total == 0 {
+				b.WriteString("最近没有收到评价")
+				return b.String()
+			}
+		}
+		fmt.Fprintf(&b, "#### %s\n\n", s.title)
+		for _, st := range stats {
+			name := st.Name
+			if name == "" {
+				name = s.empty
+			}
+			fmt.Fprintf(&b, "- %s：👍 %d / 👎 %d（差评率 %d%%）\n", name, st.Good, st.Bad, st.Bad*100/(st.Good+st.Bad))
+		}
+		b.WriteString("\n")
+	}
+
+	worst, err := db.Feedback{}.WorstAnswers(since, public.Config.Feedback.ReportLimit)
+	if err != nil {
+		logger.Error("统计评价失败,错误信息：", err)
+		return "**统计评价失败，请稍后再试**"
+	}
+	if len(worst) == 0 {
+		return b.String()
+	}
+	b.WriteString("#### 差评最多的回答\n\n")
+	for i, w := range worst {
+		var answer, question db.Chat
+		_ = (db.Chat{}).Find(map[string]interface{}{"id": w.ChatID}, &answer)
+		if answer.ParentContent != 0 {
+			_ = (db.Chat{}).Find(map[string]interface{}{"id": answer.ParentContent}, &question)
+		}
+		template := w.Template
+		if template == "" {
+			template = "未使用模板"
+		}
+		fmt.Fprintf(&b, "%d. 👎 %d / 👍 %d，%s，%s，回答编号 %d\n\n", i+1, w.Bad, w.Good, w.Source, template, w.ChatID)
+		fmt.Fprintf(&b, "> **问:** %s\n>\n> **答:** %s\n", reportSnippet(question.Content), reportSnippet(answer.Content))
+		if w.Reason != "" {
+			fmt.Fprintf(&b, ">\n> **原因:** %s\n", w.Reason)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// reportSnippet 截断报告中展示的问答内容
+func reportSnippet(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) > 80 {
+		s = string([]rune(s)[:80]) + "..."
+	}
+	return s
+}
+
+// StartFeedbackReporter 按配置的 cron 表达式把评价报告私聊发送给管理员
+func StartFeedbackReporter() {
+	spec := public.Config.Feedback.ReportSpec
+	if spec == "" || len(public.Config.AdminUsers) == 0 {
+		return
+	}
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		logger.Error(fmt.Sprintf("评价报告的 cron 表达式 %q 无效: %v", spec, err))
+		return
+	}
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		time.Sleep(time.Until(next))
+		client := public.DingTalkClientManager.GetDefaultClient()
+		if client == nil {
+			logger.Warning("no dingtalk client to send feedback report")
+			continue
+		}
+		if err := client.SendToUsers(public.Config.AdminUsers, dingbot.RobotMarkdown("回答评价报告", FeedbackReport(time.Now()))); err != nil {
+			logger.Warning(fmt.Errorf("send feedback report error: %v", err))
+		}
+	}
+}
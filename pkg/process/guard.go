@@ -0,0 +1,80 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/guard"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 敏感信息（密钥、令牌、证件号等）扫描在此
+
+// GuardQuestion 扫描提问中的敏感信息，在发送给模型以及写入数据库之前脱敏，并提醒用户
+func GuardQuestion(rmsg *dingbot.ReceiveMsg) {
+	if public.SecretGuard == nil {
+		return
+	}
+	text, findings := public.SecretGuard.Scan(rmsg.Text.Content)
+	if len(findings) == 0 {
+		return
+	}
+	rmsg.Text.Content = text
+	summary := guard.Summary(findings)
+	logger.Info(fmt.Sprintf("🔐 %s的提问中包含敏感信息：%s，userid：%#v", rmsg.SenderNick, summary, rmsg.SenderStaffId))
+	AddAudit(rmsg, AuditActionGuard, summary, db.AuditAllow, "提问中包含敏感信息")
+
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), guardNotice(findings, "提问"))
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+}
+
+// GuardAnswer 扫描回答中的敏感信息，返回脱敏后的回答，需在写入数据库之前调用
+func GuardAnswer(rmsg *dingbot.ReceiveMsg, answer string) string {
+	text, notice := guardAnswer(rmsg, answer)
+	if notice == "" {
+		return text
+	}
+	return text + "\n\n" + notice
+}
+
+// guardAnswer 扫描回答中的敏感信息并记录审计，返回脱敏后的回答以及需要提醒用户的内容
+func guardAnswer(rmsg *dingbot.ReceiveMsg, answer string) (string, string) {
+	if public.SecretGuard == nil {
+		return answer, ""
+	}
+	text, findings := public.SecretGuard.Scan(answer)
+	if len(findings) == 0 {
+		return answer, ""
+	}
+	summary := guard.Summary(findings)
+	logger.Info(fmt.Sprintf("🔐 %s得到的回答中包含敏感信息：%s", rmsg.SenderNick, summary))
+	AddAudit(rmsg, AuditActionGuard, summary, db.AuditAllow, "回答中包含敏感信息")
+	return text, guardNotice(findings, "回答")
+}
+
+// guardNotice 生成提醒内容
+func guardNotice(findings []guard.Finding, scene string) string {
+	var redacted, flagged []guard.Finding
+	for _, f := range findings {
+		if f.Redacted {
+			redacted = append(redacted, f)
+		} else {
+			flagged = append(flagged, f)
+		}
+	}
+	notice := ""
+	if len(redacted) > 0 {
+		notice = fmt.Sprintf("**🔐 检测到%s中包含 %s，已自动脱敏处理。**", scene, guard.Summary(redacted))
+	}
+	if len(flagged) > 0 {
+		if notice != "" {
+			notice += "\n\n"
+		}
+		notice += fmt.Sprintf("**⚠️ %s中疑似包含%s内容，请注意甄别。**", scene, guard.Summary(flagged))
+	}
+	return notice
+}
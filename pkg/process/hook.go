@@ -0,0 +1,32 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/hook"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// InitHooks 外部告警使用模型总结，并以机器人身份发送到群
+func InitHooks() {
+	public.Hooks.SetSummarizer(hook.SummarizerFunc(func(prompt string) (string, error) {
+		return llm.SingleQa(prompt, "")
+	}))
+	public.Hooks.SetSender(hook.SenderFunc(SendGroupMessage))
+}
+
+// SendGroupMessage 以机器人身份向群发送 Markdown 消息，robotCode 为空时使用第一个凭证
+func SendGroupMessage(robotCode, openConversationId, title, text string) error {
+	var client dingbot.DingTalkClientInterface
+	if robotCode != "" {
+		client = public.DingTalkClientManager.GetClientByOAuthClientID(robotCode)
+	} else {
+		client = public.DingTalkClientManager.GetDefaultClient()
+	}
+	if client == nil {
+		return fmt.Errorf("dingtalk client not found for robot code: %q", robotCode)
+	}
+	return client.SendToGroup(openConversationId, dingbot.RobotMarkdown(title, text))
+}
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"context"
+	"sync"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+)
+
+// stoppedNotice 停止生成后附加在回答末尾的提示
+const stoppedNotice = "> ⏹ 已停止生成"
+
+// inflightAnswer 正在生成的回答
+type inflightAnswer struct {
+	cancel  context.CancelFunc
+	trackID string
+	staffID string
+}
+
+// inflight 正在生成的回答，按会话和发送人索引，同一个人在同一个会话中只记录最新的一个
+var inflight = struct {
+	sync.Mutex
+	m map[string]*inflightAnswer
+}{m: map[string]*inflightAnswer{}}
+
+func inflightKey(rmsg *dingbot.ReceiveMsg) string {
+	return rmsg.ConversationID + "_" + rmsg.GetSenderIdentifier()
+}
+
+// startAnswer 登记一个正在生成的回答，返回发送 停止 后会被取消的 context，以及生成结束后需要调用的函数
+func startAnswer(rmsg *dingbot.ReceiveMsg, trackID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &inflightAnswer{cancel: cancel, trackID: trackID, staffID: rmsg.SenderStaffId}
+	key := inflightKey(rmsg)
+	inflight.Lock()
+	inflight.m[key] = a
+	inflight.Unlock()
+	return ctx, func() {
+		inflight.Lock()
+		if inflight.m[key] == a {
+			delete(inflight.m, key)
+		}
+		inflight.Unlock()
+		cancel()
+	}
+}
+
+// StopAnswer 停止发送人在当前会话中正在生成的回答，已经生成的内容会标记为已停止
+func StopAnswer(rmsg *dingbot.ReceiveMsg) error {
+	inflight.Lock()
+	a := inflight.m[inflightKey(rmsg)]
+	inflight.Unlock()
+	if a == nil {
+		return replyMarkdown(rmsg, "**当前没有正在生成的回答**")
+	}
+	a.cancel()
+	return nil
+}
+
+// stopAnswerByTrack 卡片上的停止按钮，只有提问人可以停止
+func stopAnswerByTrack(trackID, userID string) string {
+	inflight.Lock()
+	defer inflight.Unlock()
+	for _, a := range inflight.m {
+		if a.trackID != trackID {
+			continue
+		}
+		if a.staffID == "" || a.staffID != userID {
+			return "只有提问人可以停止生成"
+		}
+		a.cancel()
+		return "已停止生成"
+	}
+	return "回答已经生成完毕"
+}
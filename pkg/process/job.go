@@ -0,0 +1,287 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/cron"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+const jobUsage = "**用法:** #定时 cron表达式 提问内容\n\ncron 表达式依次为 分 时 日 月 周，例如：\n\n- `#定时 0 9 * * 1 总结上周的云计算行业新闻`\n- `#定时 0 17 * * 5 #周报 提醒大家提交本周周报`\n- `#定时 @daily 今天是几号，有什么节日`"
+
+// AddJob 登记定时任务，到点后向模型提问并把回答发送到当前会话
+func AddJob(rmsg *dingbot.ReceiveMsg) error {
+	spec, prompt := cron.SplitSpec(strings.TrimPrefix(rmsg.Text.Content, "#定时"))
+	var reply string
+	switch {
+	case !public.Config.Schedule.Enable:
+		reply = "**定时任务未开启**"
+	case spec == "" || prompt == "":
+		reply = jobUsage
+	default:
+		reply = addJob(rmsg, spec, prompt)
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+func addJob(rmsg *dingbot.ReceiveMsg, spec, prompt string) string {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return fmt.Sprintf("**cron 表达式有误:** %v\n\n%s", err, jobUsage)
+	}
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		return fmt.Sprintf("**cron 表达式 `%s` 没有可以执行的时间**", spec)
+	}
+	if _, err := GeneratePrompt(prompt); err != nil {
+		return fmt.Sprintf("**提示词 %s 之后需要填写内容**", prompt)
+	}
+	list, err := db.Job{}.List(db.JobListReq{ConversationID: rmsg.ConversationID})
+	if err != nil {
+		logger.Error("查询定时任务失败,错误信息：", err)
+		return "**查询定时任务失败，请稍后再试**"
+	}
+	if len(list) >= public.Config.Schedule.MaxJobs {
+		return fmt.Sprintf("**当前会话最多登记 %d 个定时任务，请先使用 #删除定时 删除不需要的任务**", public.Config.Schedule.MaxJobs)
+	}
+	job := db.Job{
+		Spec:              spec,
+		Prompt:            prompt,
+		ConversationType:  rmsg.ConversationType,
+		ConversationID:    rmsg.ConversationID,
+		ConversationTitle: rmsg.GetChatTitle(),
+		RobotCode:         rmsg.RobotCode,
+		UserID:            rmsg.SenderStaffId,
+		Creator:           rmsg.SenderNick,
+		NextRunAt:         next,
+	}
+	id, err := job.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+		return "**添加定时任务失败，请稍后再试**"
+	}
+	AddAudit(rmsg, AuditActionSchedule, fmt.Sprintf("#%d %s", id, spec), db.AuditAllow, "添加定时任务")
+	return fmt.Sprintf("**✅ 已添加定时任务 #%d**\n\n**时间:** `%s`\n\n**内容:** %s\n\n**下次执行:** %v", id, spec, prompt, public.GetReadTime(next))
+}
+
+// ListJobs 查看当前会话的定时任务，管理员发送 #定时列表 全部 可以查看所有会话的任务
+func ListJobs(rmsg *dingbot.ReceiveMsg) error {
+	all := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#定时列表")) == "全部"
+	req := db.JobListReq{ConversationID: rmsg.ConversationID}
+	if all {
+		if !public.JudgeAdminUsers(rmsg.SenderStaffId) {
+			AddAudit(rmsg, AuditActionSchedule, "", db.AuditDeny, "非管理员查看全部定时任务")
+			return replyMarkdown(rmsg, "**🤷 抱歉，只有管理员可以查看全部定时任务**")
+		}
+		req.ConversationID = ""
+	}
+	list, err := db.Job{}.List(req)
+	var reply string
+	switch {
+	case err != nil:
+		logger.Error("查询定时任务失败,错误信息：", err)
+		reply = "**查询定时任务失败，请稍后再试**"
+	case len(list) == 0:
+		reply = "**没有定时任务**\n\n" + jobUsage
+	default:
+		var b strings.Builder
+		b.WriteString("**定时任务列表**\n")
+		for _, j := range list {
+			fmt.Fprintf(&b, "\n- #%d `%s` %s，下次执行 %v", j.ID, j.Spec, j.Prompt, public.GetReadTime(j.NextRunAt))
+			if all {
+				fmt.Fprintf(&b, "，会话：%s，登记人：%s", j.ConversationTitle, j.Creator)
+			}
+			if j.LastError != "" {
+				fmt.Fprintf(&b, "，最近一次执行失败：%s", j.LastError)
+			}
+		}
+		b.WriteString("\n\n使用 `#删除定时 编号` 删除任务")
+		reply = b.String()
+	}
+	return replyMarkdown(rmsg, reply)
+}
+
+// RemoveJob 删除定时任务，登记人可以删除当前会话的任务，管理员可以删除任意任务
+func RemoveJob(rmsg *dingbot.ReceiveMsg) error {
+	arg := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#删除定时")), "#")
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return replyMarkdown(rmsg, "**用法:** #删除定时 编号，编号可以通过 #定时列表 查看")
+	}
+	admin := public.JudgeAdminUsers(rmsg.SenderStaffId)
+	req := db.JobListReq{ConversationID: rmsg.ConversationID}
+	if admin {
+		req.ConversationID = ""
+	}
+	list, err := db.Job{}.List(req)
+	if err != nil {
+		logger.Error("查询定时任务失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**查询定时任务失败，请稍后再试**")
+	}
+	var job *db.Job
+	for _, j := range list {
+		if uint64(j.ID) == id {
+			job = j
+		}
+	}
+	var reply string
+	switch {
+	case job == nil:
+		reply = fmt.Sprintf("**没有找到定时任务 #%d**", id)
+	case !admin && job.UserID != rmsg.SenderStaffId:
+		AddAudit(rmsg, AuditActionSchedule, fmt.Sprintf("#%d", id), db.AuditDeny, "删除他人的定时任务")
+		reply = "**🤷 抱歉，只有登记人或管理员可以删除该定时任务**"
+	default:
+		if err := (db.Job{}).Delete([]uint{job.ID}); err != nil {
+			logger.Error("删除定时任务失败,错误信息：", err)
+			reply = "**删除定时任务失败，请稍后再试**"
+			break
+		}
+		AddAudit(rmsg, AuditActionSchedule, fmt.Sprintf("#%d %s", job.ID, job.Spec), db.AuditAllow, "删除定时任务")
+		reply = fmt.Sprintf("**已删除定时任务 #%d:** %s", job.ID, job.Prompt)
+	}
+	return replyMarkdown(rmsg, reply)
+}
+
+func replyMarkdown(rmsg *dingbot.ReceiveMsg, reply string) error {
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+// StartJobScheduler 每分钟检查一次到期的定时任务
+func StartJobScheduler() {
+	if !public.Config.Schedule.Enable {
+		return
+	}
+	for {
+		RunDueJobs(time.Now())
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	}
+}
+
+// RunDueJobs 执行到期的定时任务
+// 服务停止期间错过的任务，在 catch_up_hours 内的只补发一次，更早的直接跳过
+func RunDueJobs(now time.Time) {
+	list, err := db.Job{}.List(db.JobListReq{DueBefore: now})
+	if err != nil {
+		logger.Error("查询定时任务失败,错误信息：", err)
+		return
+	}
+	catchUp := time.Duration(public.Config.Schedule.CatchUpHours) * time.Hour
+	for _, job := range list {
+		schedule, err := cron.Parse(job.Spec)
+		if err != nil {
+			logger.Warning(fmt.Errorf("invalid spec of job %d: %v", job.ID, err))
+			continue
+		}
+		// 先更新下一次执行时间，任务执行较慢时不会被重复执行
+		if err := job.UpdateNextRun(schedule.Next(now)); err != nil {
+			logger.Error("更新定时任务失败,错误信息：", err)
+			continue
+		}
+		late := now.Sub(job.NextRunAt)
+		if late > catchUp {
+			logger.Info(fmt.Sprintf("⏰ 定时任务 #%d 错过了 %v 的执行时间，已跳过", job.ID, public.GetReadTime(job.NextRunAt)))
+			continue
+		}
+		note := ""
+		if late > 2*time.Minute {
+			note = fmt.Sprintf("\n\n> 本条为 %v 错过的定时任务补发", public.GetReadTime(job.NextRunAt))
+		}
+		go runJob(job, note)
+	}
+}
+
+// runJob 以登记人的身份向模型提问，回答经过内容审核及敏感信息扫描后发送到登记的会话
+func runJob(job *db.Job, note string) {
+	rmsg := &dingbot.ReceiveMsg{
+		ConversationType:  job.ConversationType,
+		ConversationID:    job.ConversationID,
+		ConversationTitle: job.ConversationTitle,
+		RobotCode:         job.RobotCode,
+		SenderStaffId:     job.UserID,
+		SenderNick:        job.Creator,
+		Text:              dingbot.Text{Content: job.Prompt},
+	}
+	logger.Info(fmt.Sprintf("⏰ 执行定时任务 #%d: %#v", job.ID, job.Prompt))
+	reply, err := jobAnswer(rmsg)
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		if len(lastError) > 250 {
+			lastError = lastError[:250]
+		}
+		reply = fmt.Sprintf("**⚠️ 定时任务 #%d 执行失败**\n\n> 错误信息:%v", job.ID, err)
+	}
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(job.RobotCode)
+	if client == nil {
+		client = public.DingTalkClientManager.GetDefaultClient()
+	}
+	if client == nil {
+		lastError = fmt.Sprintf("dingtalk client not found for robot code: %s", job.RobotCode)
+	} else {
+		text := fmt.Sprintf("%s\n\n---\n\n> ⏰ 定时任务 #%d `%s`%s", reply, job.ID, job.Spec, note)
+		if err := client.SendRobotMessage(job.ConversationType, job.ConversationID, []string{job.UserID}, dingbot.RobotMarkdown("定时任务", text)); err != nil {
+			logger.Warning(fmt.Errorf("send job message error: %v", err))
+			lastError = err.Error()
+		}
+	}
+	if err := job.UpdateResult(lastError); err != nil {
+		logger.Error("更新定时任务失败,错误信息：", err)
+	}
+}
+
+// jobAnswer 与普通提问一样套用提示词模板，记录对话并审核回答
+func jobAnswer(rmsg *dingbot.ReceiveMsg) (string, error) {
+	question, err := GeneratePrompt(rmsg.Text.Content)
+	if err != nil {
+		return "", err
+	}
+	qid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.Q,
+		ParentContent: 0,
+		Content:       rmsg.Text.Content,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	var opts []llm.Option
+	if opt := toolOption(rmsg, qid); opt != nil {
+		opts = append(opts, opt)
+	}
+	reply, err := llm.SingleQa(question, rmsg.GetSenderIdentifier(), opts...)
+	if err != nil {
+		return "", err
+	}
+	reply = ModerateAnswer(rmsg, GuardAnswer(rmsg, strings.TrimSpace(reply)))
+	_, err = db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.A,
+		ParentContent: qid,
+		Content:       reply,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	return reply, nil
+}
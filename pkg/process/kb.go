@@ -0,0 +1,105 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 知识库问答在此
+
+// IngestKnowledgeDir 导入配置的文档目录，内容未变化的文档会被跳过
+func IngestKnowledgeDir() {
+	dir := public.Config.KnowledgeBase.Dir
+	if public.KnowledgeBase == nil || dir == "" {
+		return
+	}
+	count, err := public.KnowledgeBase.IngestDir(public.Config.KnowledgeBase.Collection, dir)
+	if err != nil {
+		logger.Warning(fmt.Errorf("ingest knowledge base dir %s error: %v", dir, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("📚 知识库已导入 %s 目录下的 %d 篇文档", dir, count))
+}
+
+// KnowledgeQa 基于知识库回答问题，指令格式：#知识库 问题
+func KnowledgeQa(rmsg *dingbot.ReceiveMsg) error {
+	if public.KnowledgeBase == nil {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**知识库功能未开启**")
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	question := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#知识库"))
+	if question == "" {
+		msg := fmt.Sprintf("使用如下指令基于知识库提问:\n\n---\n\n**#知识库 请假流程是怎样的？**\n\n---\n\n当前知识库集合：%s", strings.Join(public.KnowledgeBase.Collections(), "、"))
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	if !CheckRequestTimes(rmsg) {
+		return nil
+	}
+	results, err := knowledgeResults(question)
+	if err != nil {
+		logger.Warning(fmt.Errorf("search knowledge base error: %v", err))
+		_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 检索知识库失败了\n\n> 错误信息:%v", err))
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	if len(results) == 0 {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**知识库中没有找到与问题相关的内容**")
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	rmsg.Text.Content = question
+	return chat(rmsg, referenceOptions(results)...)
+}
+
+// alwaysKnowledge 配置为总是使用知识库的群组，对话时自动注入检索结果，检索失败时按普通对话处理
+func alwaysKnowledge(rmsg *dingbot.ReceiveMsg) []kb.Result {
+	if public.KnowledgeBase == nil || rmsg.ConversationType != "2" {
+		return nil
+	}
+	for _, v := range public.Config.KnowledgeBase.AlwaysGroups {
+		if v == rmsg.ConversationID {
+			results, err := knowledgeResults(rmsg.Text.Content)
+			if err != nil {
+				logger.Warning(fmt.Errorf("search knowledge base error: %v", err))
+			}
+			return results
+		}
+	}
+	return nil
+}
+
+// knowledgeResults 检索知识库，没有相关内容时返回空
+func knowledgeResults(question string) ([]kb.Result, error) {
+	conf := public.Config.KnowledgeBase
+	results, err := public.KnowledgeBase.Search(question, conf.TopK, conf.MinScore)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("📚 知识库命中 %d 个片段，来源：%s", len(results), strings.Join(kb.Sources(results), "、")))
+	return results, nil
+}
+
+// referenceOptions 将检索结果作为参考资料注入本次请求
+func referenceOptions(results []kb.Result) []llm.Option {
+	if len(results) == 0 {
+		return nil
+	}
+	return []llm.Option{llm.WithReferences(kb.FormatReferences(results))}
+}
@@ -0,0 +1,180 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 知识库文档管理在此
+
+// knowledgeAdmin 知识库未开启或者非管理员时直接回复，返回 false
+func knowledgeAdmin(rmsg *dingbot.ReceiveMsg, target string) bool {
+	msg := ""
+	switch {
+	case public.KnowledgeBase == nil:
+		msg = "**知识库功能未开启**"
+	case !public.JudgeAdminUsers(rmsg.SenderStaffId):
+		AddAudit(rmsg, AuditActionKnowledge, target, db.AuditDeny, "非管理员")
+		msg = "**🤷 抱歉，只有管理员才能管理知识库文档**"
+	default:
+		return true
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return false
+}
+
+// PrepareIngest 指令格式：#入库 [集合]，之后10分钟内发送给机器人的文件将导入该集合
+func PrepareIngest(rmsg *dingbot.ReceiveMsg) error {
+	coll := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#入库"))
+	if coll == "" {
+		coll = public.Config.KnowledgeBase.Collection
+	}
+	if !knowledgeAdmin(rmsg, coll) {
+		return nil
+	}
+	msg := ""
+	if !kb.ValidName(coll) {
+		msg = fmt.Sprintf("**集合名称 %s 不合法，不能包含空格以及 / \\ : * ? \" < > | 等字符**", coll)
+	} else {
+		public.UserService.SetIngestCollection(rmsg.GetSenderIdentifier(), coll)
+		msg = fmt.Sprintf("**📥 请在10分钟内私聊发送要导入知识库 %s 的文件**\n\n> 支持 md、txt、docx、pdf 文件，同名文档会被覆盖", coll)
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return err
+}
+
+// ReceiveFile 管理员发送过 #入库 指令时将文件导入知识库，否则作为当前会话的附件
+func ReceiveFile(ctx context.Context, rmsg *dingbot.ReceiveMsg) error {
+	if public.UserService.GetIngestCollection(rmsg.GetSenderIdentifier()) != "" {
+		return IngestFile(ctx, rmsg)
+	}
+	return AttachFile(ctx, rmsg)
+}
+
+// IngestFile 下载用户发送的文件，提取文本后导入知识库
+func IngestFile(ctx context.Context, rmsg *dingbot.ReceiveMsg) error {
+	name := rmsg.Content.FileName
+	coll := public.UserService.GetIngestCollection(rmsg.GetSenderIdentifier())
+	if !knowledgeAdmin(rmsg, coll+"/"+name) {
+		return nil
+	}
+	reply := func(msg string) error {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	text, err := extractMessageFile(ctx, rmsg)
+	if err != nil {
+		return reply(err.Error())
+	}
+	chunks, err := public.KnowledgeBase.AddDocument(coll, name, text)
+	if err != nil {
+		logger.Warning(fmt.Errorf("add document %s error: %v", name, err))
+		return reply(fmt.Sprintf("[Wrong] 导入知识库失败了\n\n> 错误信息:%v", err))
+	}
+	public.UserService.ClearIngestCollection(rmsg.GetSenderIdentifier())
+	AddAudit(rmsg, AuditActionKnowledge, coll+"/"+name, db.AuditAllow, "导入文档")
+	logger.Info(fmt.Sprintf("📚 %s将 %s 导入知识库 %s，共 %d 个片段", rmsg.SenderNick, name, coll, chunks))
+	return reply(fmt.Sprintf("**📚 已将 %s 导入知识库 %s，共 %d 个片段**", name, coll, chunks))
+}
+
+// ListKnowledge 列出知识库中的集合及文档
+func ListKnowledge(rmsg *dingbot.ReceiveMsg) error {
+	msg := ""
+	if public.KnowledgeBase == nil {
+		msg = "**知识库功能未开启**"
+	} else if public.KnowledgeBase.Empty() {
+		msg = "**知识库中还没有文档**"
+	} else {
+		var b strings.Builder
+		for _, coll := range public.KnowledgeBase.Collections() {
+			docs := public.KnowledgeBase.Documents(coll)
+			fmt.Fprintf(&b, "**📚 %s**（%d 篇）\n\n", coll, len(docs))
+			for _, d := range docs {
+				fmt.Fprintf(&b, "- %s（%d 个片段，%s）\n", d.Name, d.Chunks, d.UpdatedAt.Format("2006-01-02 15:04"))
+			}
+			b.WriteString("\n")
+		}
+		msg = strings.TrimSpace(b.String())
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return err
+}
+
+// RemoveKnowledge 指令格式：#删除文档 [集合] 文档名，不指定集合时使用默认集合
+func RemoveKnowledge(rmsg *dingbot.ReceiveMsg) error {
+	args := strings.Fields(strings.TrimPrefix(rmsg.Text.Content, "#删除文档"))
+	coll, name := public.Config.KnowledgeBase.Collection, ""
+	switch len(args) {
+	case 1:
+		name = args[0]
+	case 2:
+		coll, name = args[0], args[1]
+	}
+	if !knowledgeAdmin(rmsg, coll+"/"+name) {
+		return nil
+	}
+	msg := ""
+	if name == "" {
+		msg = "使用如下指令删除知识库文档:\n\n---\n\n**#删除文档 [集合] 文档名**\n\n---\n\n不指定集合时从默认集合中删除，文档名可通过 **#知识库列表** 查看"
+	} else {
+		ok, err := public.KnowledgeBase.RemoveDocument(coll, name)
+		switch {
+		case err != nil:
+			logger.Warning(fmt.Errorf("remove document %s error: %v", name, err))
+			msg = fmt.Sprintf("[Wrong] 删除文档失败了\n\n> 错误信息:%v", err)
+		case !ok:
+			msg = fmt.Sprintf("**知识库 %s 中没有文档 %s**", coll, name)
+		default:
+			AddAudit(rmsg, AuditActionKnowledge, coll+"/"+name, db.AuditAllow, "删除文档")
+			msg = fmt.Sprintf("**🗑 已从知识库 %s 中删除文档 %s**", coll, name)
+		}
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return err
+}
+
+// extractMessageFile 下载消息中的文件并提取文本，返回的错误可以直接回复给用户
+func extractMessageFile(ctx context.Context, rmsg *dingbot.ReceiveMsg) (string, error) {
+	name := rmsg.Content.FileName
+	if !kb.Supported(name) {
+		return "", fmt.Errorf("**不支持处理 %s**\n\n> 支持 md、txt、log 等文本文件以及 docx、pdf 文件", name)
+	}
+	clientId, _ := ctx.Value(public.DingTalkClientIdKeyName).(string)
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(clientId)
+	if client == nil || rmsg.Content.DownloadCode == "" {
+		return "", fmt.Errorf("**无法下载该文件**\n\n> 需要在配置文件中为该机器人配置 credentials")
+	}
+	data, err := client.DownloadMessageFile(rmsg.Content.DownloadCode, rmsg.RobotCode)
+	if err != nil {
+		logger.Warning(fmt.Errorf("download message file %s error: %v", name, err))
+		return "", fmt.Errorf("[Wrong] 下载文件失败了\n\n> 错误信息:%v", err)
+	}
+	text, err := kb.Extract(name, data)
+	if err != nil {
+		logger.Warning(fmt.Errorf("extract %s error: %v", name, err))
+		return "", fmt.Errorf("[Wrong] 提取文件内容失败了\n\n> 错误信息:%v", err)
+	}
+	return text, nil
+}
@@ -0,0 +1,119 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/moderation"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 内容审核相关的处理在此
+
+// blockedAnswer 回答被整体拦截时展示的内容
+const blockedAnswer = "**🚫 回答内容未通过审核，已被拦截。**"
+
+// ModerateQuestion 审核提问内容，返回 false 表示问题已被拦截
+// 命中 mask 分类时会直接修改 rmsg.Text.Content
+func ModerateQuestion(rmsg *dingbot.ReceiveMsg) bool {
+	if public.Moderator.Empty() {
+		return true
+	}
+	rst, err := public.Moderator.Check(rmsg.Text.Content)
+	if err != nil {
+		logger.Warning(fmt.Errorf("moderation api error: %v", err))
+	}
+	if len(rst.Hits) == 0 {
+		return true
+	}
+	categories := strings.Join(rst.Categories(), ",")
+	if rst.Has(moderation.ActionBlock) {
+		AddAudit(rmsg, AuditActionChat, categories, db.AuditDeny, "问题中包含敏感词")
+		logger.Info(fmt.Sprintf("🙋 %s提问的问题中包含敏感词汇，userid：%#v，消息: %#v", rmsg.SenderNick, rmsg.SenderStaffId, rmsg.Text.Content))
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**🤷 抱歉，您提问的问题中包含敏感词汇，请审核自己的对话内容之后再进行！**")
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return false
+	}
+	if rst.Has(moderation.ActionNotify) {
+		notifyModeration(rmsg, "提问", categories)
+	}
+	if rst.Has(moderation.ActionMask) {
+		rmsg.Text.Content = moderation.Mask(rmsg.Text.Content, rst)
+	}
+	if rst.Has(moderation.ActionWarn) {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("**⚠️ 您的提问中包含需要注意的内容（%s），请注意言辞。**", categories))
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+	}
+	return true
+}
+
+// ModerateAnswer 审核回答内容，返回可以展示给用户的内容
+func ModerateAnswer(rmsg *dingbot.ReceiveMsg, answer string) string {
+	if public.Moderator.Empty() {
+		return answer
+	}
+	rst, err := public.Moderator.Check(answer)
+	if err != nil {
+		logger.Warning(fmt.Errorf("moderation api error: %v", err))
+	}
+	if len(rst.Hits) == 0 {
+		return answer
+	}
+	categories := strings.Join(rst.Categories(), ",")
+	if rst.Has(moderation.ActionNotify) {
+		notifyModeration(rmsg, "回答", categories)
+	}
+	// 审核接口的命中没有位置信息，无法打码，只能整体拦截
+	for _, h := range rst.Hits {
+		if h.Start < 0 && h.Action == moderation.ActionBlock {
+			AddAudit(rmsg, AuditActionModeration, categories, db.AuditDeny, "回答未通过审核")
+			return blockedAnswer
+		}
+	}
+	answer = moderation.Mask(answer, rst)
+	if rst.Has(moderation.ActionWarn) {
+		answer += "\n\n> ⚠️ 回答中可能包含敏感内容，请注意甄别。"
+	}
+	return answer
+}
+
+// moderationNotifyWindow 同一用户同一场景命中相同分类时，该时间内只通知管理员一次
+const moderationNotifyWindow = 10 * time.Minute
+
+// moderationNotified 最近已经通知过管理员的命中
+var moderationNotified = cache.New(moderationNotifyWindow, time.Minute)
+
+// notifyModeration 记录命中审核规则的内容，并在后台私信通知管理员
+func notifyModeration(rmsg *dingbot.ReceiveMsg, scene, categories string) {
+	logger.Warning(fmt.Sprintf("🚨 %s的%s命中了内容审核规则，userid：%#v，分类: %s", rmsg.SenderNick, scene, rmsg.SenderStaffId, categories))
+	AddAudit(rmsg, AuditActionModeration, categories, db.AuditAllow, scene+"命中内容审核规则")
+	if len(public.Config.AdminUsers) == 0 {
+		return
+	}
+	// 流式回复时每一段回答都会审核，同样的命中只通知一次
+	key := rmsg.GetSenderIdentifier() + "|" + scene + "|" + categories
+	if moderationNotified.Add(key, true, cache.DefaultExpiration) != nil {
+		return
+	}
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(rmsg.RobotCode)
+	if client == nil {
+		return
+	}
+	text := fmt.Sprintf("### 🚨 内容审核提醒\n\n**用户:** %s（%s）\n\n**来源:** %s\n\n**场景:** %s\n\n**分类:** %s",
+		rmsg.SenderNick, rmsg.SenderStaffId, rmsg.GetChatTitle(), scene, categories)
+	go func() {
+		if err := client.SendToUsers(public.Config.AdminUsers, dingbot.RobotMarkdown("内容审核提醒", text)); err != nil {
+			logger.Warning(fmt.Errorf("notify admin error: %v", err))
+		}
+	}()
+}
@@ -1,8 +1,10 @@
 package process
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
@@ -15,46 +17,84 @@ import (
 
 // 域名信息
 func DomainMsg(rmsg *dingbot.ReceiveMsg) error {
-	qObj := db.Chat{
-		Username:      rmsg.SenderNick,
-		Source:        rmsg.GetChatTitle(),
-		ChatType:      db.Q,
-		ParentContent: 0,
-		Content:       rmsg.Text.Content,
-	}
-	qid, err := qObj.Add()
-	if err != nil {
-		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	return opsCommand(rmsg, "#域名 域名，例如 `#域名 example.com`", func(args []string) (string, error) {
+		dm, err := ops.LookupDomain(context.Background(), args[0])
+		if err != nil {
+			return "", err
+		}
+		reply := fmt.Sprintf("**域名:** %v\n\n**创建时间:** %v\n\n**到期时间:** %v\n\n**更新时间:** %v\n\n**服务商:** %v",
+			dm.Domain, orNone(dm.CreateDate), orNone(dm.ExpiryDate), orNone(dm.UpdatedDate), orNone(dm.Registrar))
+		if len(dm.Status) > 0 {
+			reply += "\n\n**状态:** " + strings.Join(dm.Status, ", ")
+		}
+		if len(dm.NameServers) > 0 {
+			reply += "\n\n**DNS 服务器:** " + strings.Join(dm.NameServers, ", ")
+		}
+		reply += fmt.Sprintf("\n\n**数据来源:** %s %s", strings.ToUpper(dm.Source), dm.Server)
+		return reply, nil
+	})
+}
+
+// orNone 空值显示为 未知
+func orNone(s string) string {
+	if s == "" {
+		return "未知"
 	}
-	domain := strings.TrimSpace(strings.Split(rmsg.Text.Content, " ")[1])
-	dm, err := ops.GetDomainMsg(domain)
-	if err != nil {
-		return err
+	return s
+}
+
+// 证书信息
+func DomainCertMsg(rmsg *dingbot.ReceiveMsg) error {
+	return opsCommand(rmsg, "#证书 主机[:端口] [SNI]，例如 `#证书 example.com`、`#证书 smtp.example.com:587`", func(args []string) (string, error) {
+		sni := ""
+		if len(args) > 1 {
+			sni = args[1]
+		}
+		rst, err := ops.InspectCert(context.Background(), args[0], sni)
+		if err != nil {
+			return "", err
+		}
+		return formatCertReport(rst), nil
+	})
+}
+
+// formatCertReport 证书检查结果的展示格式
+func formatCertReport(rst ops.CertReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**地址:** %s\n\n**SNI:** %s", rst.Addr, rst.ServerName)
+	if rst.StartTLS != "" {
+		fmt.Fprintf(&b, "\n\n**STARTTLS:** %s", strings.ToUpper(rst.StartTLS))
 	}
-	// 回复@我的用户
-	reply := fmt.Sprintf("**创建时间:** %v\n\n**到期时间:** %v\n\n**服务商:** %v", dm.CreateDate, dm.ExpiryDate, dm.Registrar)
-	aObj := db.Chat{
-		Username:      rmsg.SenderNick,
-		Source:        rmsg.GetChatTitle(),
-		ChatType:      db.A,
-		ParentContent: qid,
-		Content:       reply,
+	fmt.Fprintf(&b, "\n\n**协议:** %s %s", rst.TLSVersion, rst.CipherSuite)
+	if rst.Verified {
+		b.WriteString("\n\n**证书校验:** ✅ 通过")
+	} else {
+		fmt.Fprintf(&b, "\n\n**证书校验:** ❌ %s", rst.VerifyError)
 	}
-	_, err = aObj.Add()
-	if err != nil {
-		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	leaf := rst.Leaf()
+	fmt.Fprintf(&b, "\n\n**证书创建时间:** %v\n\n**证书到期时间:** %v\n\n**剩余天数:** %d",
+		public.GetReadTime(leaf.NotBefore), public.GetReadTime(leaf.NotAfter), rst.DaysLeft)
+	switch {
+	case !rst.OCSPStapled:
+		b.WriteString("\n\n**OCSP Stapling:** 未提供")
+	case rst.OCSPNextUpdate.IsZero():
+		fmt.Fprintf(&b, "\n\n**OCSP Stapling:** %s", rst.OCSPStatus)
+	default:
+		fmt.Fprintf(&b, "\n\n**OCSP Stapling:** %s，下次更新 %v", rst.OCSPStatus, public.GetReadTime(rst.OCSPNextUpdate))
 	}
-	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, reply))
-	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
-	if err != nil {
-		logger.Error(fmt.Errorf("send message error: %v", err))
-		return err
+	b.WriteString("\n\n**证书链:**\n")
+	for i, cert := range rst.Chain {
+		fmt.Fprintf(&b, "\n%d. %s\n    - 颁发机构: %s\n    - 有效期: %v ~ %v\n    - 密钥: %s，签名: %s",
+			i+1, cert.Subject, cert.Issuer, public.GetReadTime(cert.NotBefore), public.GetReadTime(cert.NotAfter), cert.KeyType, cert.SignatureAlgorithm)
+		if len(cert.SANs) > 0 {
+			fmt.Fprintf(&b, "\n    - SAN: %s", strings.Join(cert.SANs, ", "))
+		}
 	}
-	return nil
+	return b.String()
 }
 
-// 证书信息
-func DomainCertMsg(rmsg *dingbot.ReceiveMsg) error {
+// opsCommand 记录问答并回复运维指令的结果，缺少参数时回复用法，查询失败时回复失败原因
+func opsCommand(rmsg *dingbot.ReceiveMsg, usage string, run func(args []string) (string, error)) error {
 	qObj := db.Chat{
 		Username:      rmsg.SenderNick,
 		Source:        rmsg.GetChatTitle(),
@@ -66,14 +106,12 @@ func DomainCertMsg(rmsg *dingbot.ReceiveMsg) error {
 	if err != nil {
 		logger.Error("往MySQL新增数据失败,错误信息：", err)
 	}
-	domain := strings.TrimSpace(strings.Split(rmsg.Text.Content, " ")[1])
-	dm, err := ops.GetDomainCertMsg(domain)
-	if err != nil {
-		return err
+	var reply string
+	if args := strings.Fields(rmsg.Text.Content)[1:]; len(args) == 0 {
+		reply = "**用法:** " + usage
+	} else if reply, err = run(args); err != nil {
+		reply = fmt.Sprintf("**查询失败:** %v", err)
 	}
-	cert := dm.PeerCertificates[0]
-	// 回复@我的用户
-	reply := fmt.Sprintf("**证书创建时间:** %v\n\n**证书到期时间:** %v\n\n**证书颁发机构:** %v\n\n", public.GetReadTime(cert.NotBefore), public.GetReadTime(cert.NotAfter), cert.Issuer.Organization)
 	aObj := db.Chat{
 		Username:      rmsg.SenderNick,
 		Source:        rmsg.GetChatTitle(),
@@ -88,8 +126,95 @@ func DomainCertMsg(rmsg *dingbot.ReceiveMsg) error {
 	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, reply))
 	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
 	if err != nil {
-		logger.Error(fmt.Errorf("send message error: %v", err))
+		logger.Warning(fmt.Errorf("send message error: %v", err))
 		return err
 	}
 	return nil
 }
+
+// DNS 查询
+func DNSMsg(rmsg *dingbot.ReceiveMsg) error {
+	return opsCommand(rmsg, "#dns 域名 [记录类型] [@DNS服务器]，例如 `#dns example.com MX @223.5.5.5`", func(args []string) (string, error) {
+		name, qtype, server := args[0], "", public.Config.Ops.DNSServer
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "@") {
+				server = strings.TrimPrefix(arg, "@")
+			} else {
+				qtype = arg
+			}
+		}
+		rst, err := ops.LookupDNS(context.Background(), name, qtype, server)
+		if err != nil {
+			return "", err
+		}
+		records := "无"
+		if len(rst.Records) > 0 {
+			records = "\n\n- " + strings.Join(rst.Records, "\n- ")
+		}
+		return fmt.Sprintf("**域名:** %s\n\n**类型:** %s\n\n**解析服务器:** %s\n\n**耗时:** %v\n\n**记录:** %s",
+			rst.Name, rst.Type, rst.Server, rst.Latency.Round(time.Millisecond), records), nil
+	})
+}
+
+// HTTP 探测
+func HTTPMsg(rmsg *dingbot.ReceiveMsg) error {
+	return opsCommand(rmsg, "#http 地址，例如 `#http https://example.com`", func(args []string) (string, error) {
+		rst, err := ops.ProbeHTTP(context.Background(), args[0])
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "**地址:** %s\n\n**状态:** %s\n\n**耗时:** %v", rst.URL, rst.Status, rst.Latency.Round(time.Millisecond))
+		if rst.Server != "" {
+			fmt.Fprintf(&b, "\n\n**Server:** %s", rst.Server)
+		}
+		if len(rst.Redirects) > 0 {
+			b.WriteString("\n\n**重定向:**\n")
+			for _, hop := range rst.Redirects {
+				fmt.Fprintf(&b, "\n- %d %s", hop.StatusCode, hop.URL)
+			}
+		}
+		if rst.TLS != nil {
+			fmt.Fprintf(&b, "\n\n**TLS:** %s\n\n**证书域名:** %s\n\n**证书颁发机构:** %s\n\n**证书到期时间:** %v",
+				rst.TLS.Version, rst.TLS.Subject, rst.TLS.Issuer, public.GetReadTime(rst.TLS.NotAfter))
+			if rst.TLS.VerifyError != "" {
+				fmt.Fprintf(&b, "\n\n**证书校验失败:** %s", rst.TLS.VerifyError)
+			}
+		}
+		return b.String(), nil
+	})
+}
+
+// 端口检测
+func TCPMsg(rmsg *dingbot.ReceiveMsg) error {
+	return opsCommand(rmsg, "#tcp 主机:端口，例如 `#tcp example.com:443`", func(args []string) (string, error) {
+		rst, err := ops.CheckTCP(context.Background(), args[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("**地址:** %s\n\n**状态:** 端口可以连接\n\n**远端地址:** %s\n\n**耗时:** %v",
+			rst.Addr, rst.RemoteAddr, rst.Latency.Round(time.Millisecond)), nil
+	})
+}
+
+// IP 信息
+func IPMsg(rmsg *dingbot.ReceiveMsg) error {
+	return opsCommand(rmsg, "#ip 地址，例如 `#ip 8.8.8.8`", func(args []string) (string, error) {
+		rst, err := ops.LookupIPInfo(context.Background(), args[0])
+		if err != nil {
+			return "", err
+		}
+		hosts := "无"
+		if len(rst.Hosts) > 0 {
+			hosts = strings.Join(rst.Hosts, ", ")
+		}
+		asn := "未找到"
+		switch {
+		case public.Config.Ops.ASNDB == "":
+			asn = "未配置 ASN 数据库"
+		case rst.ASN != nil:
+			asn = fmt.Sprintf("AS%d %s (%s)", rst.ASN.Number, rst.ASN.Name, rst.ASN.Country)
+		}
+		return fmt.Sprintf("**IP:** %s\n\n**反向解析:** %s\n\n**ASN:** %s", rst.IP, hosts, asn), nil
+	})
+}
@@ -38,9 +38,11 @@ func ProcessRequest(rmsg *dingbot.ReceiveMsg) error {
 			// 重置用户对话模式
 			public.UserService.ClearUserMode(rmsg.GetSenderIdentifier())
 			// 清空用户对话上下文
-			public.UserService.ClearUserSessionContext(rmsg.GetSenderIdentifier())
+			llm.ClearConversation(rmsg.GetSenderIdentifier())
 			// 清空用户对话的答案ID
 			public.UserService.ClearAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
+			// 清空用户会话中的附件
+			public.UserService.ClearUserAttachments(rmsg.GetSenderIdentifier())
 			_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[RecyclingSymbol]已重置与**%s** 的对话模式\n\n> 可以开始新的对话 [Bubble]", rmsg.SenderNick))
 			if err != nil {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -68,7 +70,10 @@ func ProcessRequest(rmsg *dingbot.ReceiveMsg) error {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
 			}
 		case "余额":
-			if public.JudgeAdminUsers(rmsg.SenderStaffId) {
+			if !public.JudgeAdminUsers(rmsg.SenderStaffId) {
+				AddAudit(rmsg, AuditActionBalance, "", db.AuditDeny, "非管理员")
+			} else {
+				AddAudit(rmsg, AuditActionBalance, "", db.AuditAllow, "")
 				cacheMsg := public.UserService.GetUserMode("system_balance")
 				if cacheMsg == "" {
 					rst, err := public.GetBalance()
@@ -92,48 +97,44 @@ func ProcessRequest(rmsg *dingbot.ReceiveMsg) error {
 				}
 			}
 		default:
-			if public.FirstCheck(rmsg) {
-				// 检查是否启用流式模式
-				if public.Config.StreamMode {
-					logger.Info("📡 使用串聊流式模式")
-					if public.Config.CardTemplateID != "" {
-						logger.Info("🎴 使用流式卡片输出")
-						// 使用流式卡片输出
-						return DoStreamWithCard("串聊", rmsg, public.Config.CardTemplateID)
-					} else {
-						logger.Info("💬 使用简化流式输出")
-						// 使用流式普通输出
-						return DoStream("串聊", rmsg)
-					}
-				}
-				logger.Info("💭 使用传统串聊模式")
-				return Do("串聊", rmsg)
-			} else {
-				// 检查是否启用流式模式
-				if public.Config.StreamMode {
-					logger.Info("📡 使用单聊流式模式")
-					if public.Config.CardTemplateID != "" {
-						logger.Info("🎴 使用流式卡片输出")
-						// 使用流式卡片输出
-						return DoStreamWithCard("单聊", rmsg, public.Config.CardTemplateID)
-					} else {
-						logger.Info("💬 使用简化流式输出")
-						// 使用流式普通输出
-						return DoStream("单聊", rmsg)
-					}
-				}
-				logger.Info("💭 使用传统单聊模式")
-				return Do("单聊", rmsg)
-			}
+			// 知识库检索结果与会话附件一起作为参考资料
+			results := append(alwaysKnowledge(rmsg), attachmentResults(rmsg)...)
+			return chat(rmsg, referenceOptions(results)...)
 		}
 	}
 	return nil
 }
 
+// chat 按当前对话模式及输出方式向模型提问
+func chat(rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
+	if public.FirstCheck(rmsg) {
+		// 检查是否启用流式模式
+		if public.Config.StreamMode {
+			logger.Info("📡 使用串聊流式模式")
+			return streamAnswer("串聊", rmsg, opts...)
+		}
+		logger.Info("💭 使用传统串聊模式")
+		return Do("串聊", rmsg, opts...)
+	} else {
+		// 检查是否启用流式模式
+		if public.Config.StreamMode {
+			logger.Info("📡 使用单聊流式模式")
+			return streamAnswer("单聊", rmsg, opts...)
+		}
+		logger.Info("💭 使用传统单聊模式")
+		return Do("单聊", rmsg, opts...)
+	}
+}
+
 // 执行处理请求
-func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
+func Do(mode string, rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
 	// 先把模式注入
 	public.UserService.SetUserMode(rmsg.GetSenderIdentifier(), mode)
+	// 发送 停止 可以中断，停止后不再回复回答
+	ctx, done := startAnswer(rmsg, "")
+	defer done()
+	var model answerModel
+	opts = append(opts, llm.WithContext(ctx), model.option())
 	switch mode {
 	case "单聊":
 		qObj := db.Chat{
@@ -147,11 +148,18 @@ func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
 		if err != nil {
 			logger.Error("往MySQL新增数据失败,错误信息：", err)
 		}
-		reply, err := llm.SingleQa(rmsg.Text.Content, rmsg.GetSenderIdentifier())
+		if opt := toolOption(rmsg, qid); opt != nil {
+			opts = append(opts, opt)
+		}
+		reply, err := llm.SingleQa(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
+		if err != nil && ctx.Err() != nil {
+			logger.Info(fmt.Sprintf("⏹ %s停止了回答的生成", rmsg.SenderNick))
+			return replyMarkdown(rmsg, stoppedNotice)
+		}
 		if err != nil {
 			logger.Info(fmt.Errorf("gpt request error: %v", err))
 			if strings.Contains(fmt.Sprintf("%v", err), "maximum question length exceeded") {
-				public.UserService.ClearUserSessionContext(rmsg.GetSenderIdentifier())
+				llm.ClearConversation(rmsg.GetSenderIdentifier())
 				_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v\n\n> 已超过最大文本限制，请缩短提问文字的字数。", err))
 				if err != nil {
 					logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -171,27 +179,30 @@ func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
 		} else {
 			reply = strings.TrimSpace(reply)
 			reply = strings.Trim(reply, "\n")
+			reply = GuardAnswer(rmsg, reply)
 			aObj := db.Chat{
 				Username:      rmsg.SenderNick,
 				Source:        rmsg.GetChatTitle(),
 				ChatType:      db.A,
 				ParentContent: qid,
 				Content:       reply,
+				ModelName:     model.name(),
 			}
-			_, err := aObj.Add()
+			aid, err := aObj.Add()
 			if err != nil {
 				logger.Error("往MySQL新增数据失败,错误信息：", err)
 			}
+			// 记录最近一次回答，供 #反馈 使用
+			public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
 			logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, reply))
-			if public.JudgeSensitiveWord(reply) {
-				reply = public.SolveSensitiveWord(reply)
-			}
+			reply = ModerateAnswer(rmsg, reply)
 			// 回复@我的用户
 			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), FormatMarkdown(reply))
 			if err != nil {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
 				return err
 			}
+			replyVoice(rmsg, reply)
 		}
 	case "串聊":
 		lastAid := public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
@@ -206,11 +217,18 @@ func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
 		if err != nil {
 			logger.Error("往MySQL新增数据失败,错误信息：", err)
 		}
-		cli, reply, err := llm.ContextQa(rmsg.Text.Content, rmsg.GetSenderIdentifier())
+		if opt := toolOption(rmsg, qid); opt != nil {
+			opts = append(opts, opt)
+		}
+		cli, reply, err := llm.ContextQa(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
+		if err != nil && ctx.Err() != nil {
+			logger.Info(fmt.Sprintf("⏹ %s停止了回答的生成", rmsg.SenderNick))
+			return replyMarkdown(rmsg, stoppedNotice)
+		}
 		if err != nil {
 			logger.Info(fmt.Sprintf("gpt request error: %v", err))
 			if strings.Contains(fmt.Sprintf("%v", err), "maximum text length exceeded") {
-				public.UserService.ClearUserSessionContext(rmsg.GetSenderIdentifier())
+				llm.ClearConversation(rmsg.GetSenderIdentifier())
 				_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v\n\n> 串聊已超过最大文本限制，对话已重置，请重新发起。", err))
 				if err != nil {
 					logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -230,12 +248,14 @@ func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
 		} else {
 			reply = strings.TrimSpace(reply)
 			reply = strings.Trim(reply, "\n")
+			reply = GuardAnswer(rmsg, reply)
 			aObj := db.Chat{
 				Username:      rmsg.SenderNick,
 				Source:        rmsg.GetChatTitle(),
 				ChatType:      db.A,
 				ParentContent: qid,
 				Content:       reply,
+				ModelName:     model.name(),
 			}
 			aid, err := aObj.Add()
 			if err != nil {
@@ -244,15 +264,14 @@ func Do(mode string, rmsg *dingbot.ReceiveMsg) error {
 			// 将当前回答的ID放入缓存
 			public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
 			logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, reply))
-			if public.JudgeSensitiveWord(reply) {
-				reply = public.SolveSensitiveWord(reply)
-			}
+			reply = ModerateAnswer(rmsg, reply)
 			// 回复@我的用户
-			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), FormatMarkdown(reply))
+			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), threadTag(rmsg)+FormatMarkdown(reply))
 			if err != nil {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
 				return err
 			}
+			replyVoice(rmsg, reply)
 			_ = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
 		}
 	default:
@@ -300,6 +319,19 @@ func FormatMarkdown(md string) string {
 // CheckRequestTimes 分析处理请求逻辑
 // 主要提供单日请求限额的功能
 func CheckRequestTimes(rmsg *dingbot.ReceiveMsg) bool {
+	if requestAllowed(rmsg) {
+		return true
+	}
+	logger.Info(fmt.Sprintf("亲爱的: %s，您今日请求次数已达上限，请明天再来，交互发问资源有限，请务必斟酌您的问题，给您带来不便，敬请谅解!", rmsg.SenderNick))
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Staple] **一个好的问题，胜过十个好的答案！** \n\n亲爱的%s:\n\n您今日请求次数已达上限，请明天再来，交互发问资源有限，请务必斟酌您的问题，给您带来不便，敬请谅解！\n\n如有需要，可联系管理员升级为VIP用户。", rmsg.SenderNick))
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	return false
+}
+
+// requestAllowed 判断用户今日的请求次数是否超过限制，未超过时计数加1，不回复用户
+func requestAllowed(rmsg *dingbot.ReceiveMsg) bool {
 	if public.Config.MaxRequest == 0 {
 		return true
 	}
@@ -307,16 +339,11 @@ func CheckRequestTimes(rmsg *dingbot.ReceiveMsg) bool {
 	// 用户是管理员或VIP用户，不判断访问次数是否超过限制
 	if public.JudgeAdminUsers(rmsg.SenderStaffId) || public.JudgeVipUsers(rmsg.SenderStaffId) {
 		return true
-	} else {
-		// 用户不是管理员和VIP用户，判断访问次数是否超过限制
-		if count >= public.Config.MaxRequest {
-			logger.Info(fmt.Sprintf("亲爱的: %s，您今日请求次数已达上限，请明天再来，交互发问资源有限，请务必斟酌您的问题，给您带来不便，敬请谅解!", rmsg.SenderNick))
-			_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Staple] **一个好的问题，胜过十个好的答案！** \n\n亲爱的%s:\n\n您今日请求次数已达上限，请明天再来，交互发问资源有限，请务必斟酌您的问题，给您带来不便，敬请谅解！\n\n如有需要，可联系管理员升级为VIP用户。", rmsg.SenderNick))
-			if err != nil {
-				logger.Warning(fmt.Errorf("send message error: %v", err))
-			}
-			return false
-		}
+	}
+	// 用户不是管理员和VIP用户，判断访问次数是否超过限制
+	if count >= public.Config.MaxRequest {
+		AddAudit(rmsg, AuditActionChat, "", db.AuditDeny, fmt.Sprintf("超出单日请求上限: %d", public.Config.MaxRequest))
+		return false
 	}
 	// 访问次数未超过限制，将计数加1
 	public.UserService.SetUseRequestCount(rmsg.GetSenderIdentifier(), count+1)
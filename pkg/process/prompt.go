@@ -25,3 +25,16 @@ func GeneratePrompt(msg string) (rst string, err error) {
 	}
 	return
 }
+
+// MatchPrompt 根据套用模板后的问题找出使用的提示词模板，没有使用模板时返回空
+func MatchPrompt(question string) string {
+	for _, prompt := range *public.Prompt {
+		if prompt.Prefix != "" && strings.HasPrefix(question, prompt.Prefix) {
+			return prompt.Title
+		}
+		if prompt.Prefix == "" && prompt.Suffix != "" && strings.HasSuffix(question, prompt.Suffix) {
+			return prompt.Title
+		}
+	}
+	return ""
+}
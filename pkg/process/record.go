@@ -0,0 +1,202 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+var summaryCountPattern = regexp.MustCompile(`^(?:最近)?(\d+)条?$`)
+
+// RecordGroupMessage 记录开启了消息记录的群里的消息，返回 true 表示消息没有 @机器人，只需要记录不需要回复
+func RecordGroupMessage(rmsg *dingbot.ReceiveMsg) bool {
+	if !public.Config.GroupRecord.Enable || rmsg.ConversationType != "2" {
+		return false
+	}
+	if !(db.RecordGroup{}).Exist(rmsg.ConversationID) {
+		return false
+	}
+	content := rmsg.Text.Content
+	// 指令不记录，记录前先脱敏
+	if content != "" && !strings.HasPrefix(content, "#") {
+		if public.SecretGuard != nil {
+			content, _ = public.SecretGuard.Scan(content)
+		}
+		err := db.GroupMessage{
+			ConversationID: rmsg.ConversationID,
+			SenderNick:     rmsg.SenderNick,
+			SenderStaffId:  rmsg.SenderStaffId,
+			Content:        content,
+		}.Add()
+		if err != nil {
+			logger.Error("记录群消息失败,错误信息：", err)
+		} else if err := (db.GroupMessage{}).Trim(rmsg.ConversationID, public.Config.GroupRecord.MaxMessages); err != nil {
+			logger.Error("清理群消息失败,错误信息：", err)
+		}
+	}
+	return !rmsg.IsInAtList
+}
+
+// SwitchGroupRecord 开启或关闭当前群的消息记录，仅管理员可用，关闭时删除已经记录的消息
+func SwitchGroupRecord(rmsg *dingbot.ReceiveMsg) error {
+	arg := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#群记录"))
+	recording := (db.RecordGroup{}).Exist(rmsg.ConversationID)
+	var reply string
+	switch {
+	case !public.Config.GroupRecord.Enable:
+		reply = "**群消息记录未开启**"
+	case rmsg.ConversationType != "2":
+		reply = "**请在群聊中使用该指令**"
+	case arg != "开启" && arg != "关闭":
+		status := "未开启"
+		if recording {
+			status = "已开启"
+		}
+		reply = fmt.Sprintf("**当前群消息记录%s**\n\n管理员发送 `#群记录 开启` 或 `#群记录 关闭` 切换，开启后可以使用 `#总结` 总结群聊内容", status)
+	case !public.JudgeAdminUsers(rmsg.SenderStaffId):
+		AddAudit(rmsg, AuditActionRecord, arg, db.AuditDeny, "非管理员")
+		reply = "**🤷 抱歉，只有管理员可以切换群消息记录**"
+	case arg == "开启" && recording, arg == "关闭" && !recording:
+		reply = fmt.Sprintf("**当前群消息记录已经%s**", arg)
+	case arg == "开启":
+		err := db.RecordGroup{
+			ConversationID:    rmsg.ConversationID,
+			ConversationTitle: rmsg.GetChatTitle(),
+			Operator:          rmsg.SenderNick,
+		}.Add()
+		if err != nil {
+			logger.Error("往MySQL新增数据失败,错误信息：", err)
+			reply = "**开启群消息记录失败，请稍后再试**"
+			break
+		}
+		AddAudit(rmsg, AuditActionRecord, arg, db.AuditAllow, "开启群消息记录")
+		reply = fmt.Sprintf("**📝 已开启群消息记录**\n\n机器人会记录本群的消息（保留最近 %d 条，最多 %d 天），用于 `#总结`，管理员发送 `#群记录 关闭` 可以关闭并删除记录",
+			public.Config.GroupRecord.MaxMessages, public.Config.GroupRecord.RetentionDays)
+	default:
+		if err := (db.RecordGroup{}).Delete(rmsg.ConversationID); err != nil {
+			logger.Error("关闭群消息记录失败,错误信息：", err)
+			reply = "**关闭群消息记录失败，请稍后再试**"
+			break
+		}
+		AddAudit(rmsg, AuditActionRecord, arg, db.AuditAllow, "关闭群消息记录")
+		reply = "**已关闭群消息记录，并删除了已记录的消息**"
+	}
+	return replyMarkdown(rmsg, reply)
+}
+
+// SummarizeGroup 总结群聊内容，支持 #总结、#总结 最近50条、#总结 今天
+func SummarizeGroup(rmsg *dingbot.ReceiveMsg) error {
+	arg := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#总结"))
+	limit := public.Config.GroupRecord.SummaryMessages
+	var since time.Time
+	scope := fmt.Sprintf("最近 %d 条消息", limit)
+	if arg == "今天" {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		limit = public.Config.GroupRecord.MaxMessages
+		scope = "今天的消息"
+	} else if m := summaryCountPattern.FindStringSubmatch(arg); m != nil {
+		limit, _ = strconv.Atoi(m[1])
+		if limit <= 0 || limit > public.Config.GroupRecord.MaxMessages {
+			limit = public.Config.GroupRecord.MaxMessages
+		}
+		scope = fmt.Sprintf("最近 %d 条消息", limit)
+	} else if arg != "" {
+		return replyMarkdown(rmsg, "**用法:** #总结 [最近N条|今天]，例如 `#总结`、`#总结 最近50条`、`#总结 今天`")
+	}
+
+	switch {
+	case !public.Config.GroupRecord.Enable:
+		return replyMarkdown(rmsg, "**群消息记录未开启**")
+	case rmsg.ConversationType != "2":
+		return replyMarkdown(rmsg, "**请在群聊中使用该指令**")
+	case !(db.RecordGroup{}).Exist(rmsg.ConversationID):
+		return replyMarkdown(rmsg, "**当前群没有开启消息记录**\n\n请管理员发送 `#群记录 开启` 后再使用")
+	}
+	list, err := db.GroupMessage{}.List(rmsg.ConversationID, since, limit)
+	if err != nil {
+		logger.Error("查询群消息失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**查询群消息失败，请稍后再试**")
+	}
+	transcript, count := groupTranscript(list, public.Config.MaxQuestionLen/2)
+	if count == 0 {
+		return replyMarkdown(rmsg, fmt.Sprintf("**%s中没有记录到聊天内容**", scope))
+	}
+	// 总结同样要调用模型，计入每日请求次数
+	if !CheckRequestTimes(rmsg) {
+		return nil
+	}
+
+	prompt := fmt.Sprintf("以下是钉钉群「%s」的聊天记录，每行的格式为 [时间] 昵称: 内容。请用中文总结：\n"+
+		"1. 讨论了哪些主要话题；\n2. 达成了哪些结论或决定；\n3. 有哪些待办事项及负责人。\n"+
+		"提到观点、结论或待办时注明对应的发言人昵称，不要编造聊天记录中没有的内容，使用 Markdown 输出。\n\n%s", rmsg.GetChatTitle(), transcript)
+	qid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.Q,
+		ParentContent: 0,
+		Content:       rmsg.Text.Content,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	reply, err := llm.SingleQa(prompt, rmsg.GetSenderIdentifier())
+	if err != nil {
+		logger.Info(fmt.Errorf("gpt request error: %v", err))
+		return replyMarkdown(rmsg, fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v", err))
+	}
+	reply = ModerateAnswer(rmsg, GuardAnswer(rmsg, strings.TrimSpace(reply)))
+	_, err = db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.A,
+		ParentContent: qid,
+		Content:       reply,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	return replyMarkdown(rmsg, fmt.Sprintf("**📝 群聊总结**（%s，共 %d 条）\n\n%s", scope, count, reply))
+}
+
+// groupTranscript 把群消息整理成聊天记录，超过 maxRunes 时丢弃较早的消息，返回实际使用的消息数量
+func groupTranscript(list []*db.GroupMessage, maxRunes int) (string, int) {
+	var lines []string
+	total := 0
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		line := fmt.Sprintf("[%s] %s: %s", m.CreatedAt.Format("01-02 15:04"), m.SenderNick, strings.ReplaceAll(m.Content, "\n", " "))
+		total += utf8.RuneCountInString(line) + 1
+		if total > maxRunes && len(lines) > 0 {
+			break
+		}
+		lines = append(lines, line)
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n"), len(lines)
+}
+
+// StartGroupRecordCleaner 每小时删除一次超过保留天数的群消息
+func StartGroupRecordCleaner() {
+	if !public.Config.GroupRecord.Enable {
+		return
+	}
+	for {
+		before := time.Now().AddDate(0, 0, -public.Config.GroupRecord.RetentionDays)
+		if err := (db.GroupMessage{}).PurgeBefore(before); err != nil {
+			logger.Error("清理群消息失败,错误信息：", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,152 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// RetryAnswer 串聊中去掉最后一轮回答后重新回答，#重来 [模型] [temperature]，例如 #重来 gpt-4o 0.2
+func RetryAnswer(rmsg *dingbot.ReceiveMsg) error {
+	var opts []llm.Option
+	for _, arg := range strings.Fields(strings.TrimPrefix(rmsg.Text.Content, "#重来")) {
+		if t, err := strconv.ParseFloat(arg, 32); err == nil {
+			if t < 0 || t > 2 {
+				return replyMarkdown(rmsg, "**temperature 的取值范围为 0 ~ 2**\n\n**用法:** #重来 [模型] [temperature]，例如 `#重来`、`#重来 gpt-4o 0.2`")
+			}
+			opts = append(opts, llm.WithTemperature(float32(t)))
+			continue
+		}
+		if !slices.Contains(retryModels(), arg) {
+			return replyMarkdown(rmsg, fmt.Sprintf("**不支持指定模型 %s**\n\n可以指定的模型：%s", arg, strings.Join(retryModels(), "、")))
+		}
+		opts = append(opts, llm.WithModel(arg))
+	}
+	return retryLastTurn(rmsg, "", opts...)
+}
+
+// retryModels #重来 时可以指定的模型
+func retryModels() []string {
+	models := []string{public.Config.Model}
+	if public.Config.VisionModel != public.Config.Model {
+		models = append(models, public.Config.VisionModel)
+	}
+	for _, m := range public.Config.RetryModels {
+		if !slices.Contains(models, m) {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// EditQuestion 串聊中把最后一轮的问题替换为新的问题后重新回答，#改 <新的问题>，新的问题同样可以使用提示词模板
+func EditQuestion(rmsg *dingbot.ReceiveMsg) error {
+	question := strings.TrimSpace(strings.TrimPrefix(rmsg.Text.Content, "#改"))
+	if question == "" {
+		return replyMarkdown(rmsg, "**用法:** #改 <新的问题>，替换串聊中最后一次的提问并重新回答")
+	}
+	question, err := GeneratePrompt(question)
+	if err != nil {
+		_, err = rmsg.ReplyToDingtalk(string(dingbot.TEXT), question)
+		return err
+	}
+	rmsg.Text.Content = question
+	GuardQuestion(rmsg)
+	return retryLastTurn(rmsg, rmsg.Text.Content)
+}
+
+// retryLastTurn 重新回答串聊中的最后一轮问答，question 不为空时替换原来的问题。
+// 重新回答作为原问题的另一个回答记录，替换的问题作为原问题的同级问题记录
+func retryLastTurn(rmsg *dingbot.ReceiveMsg, question string, opts ...llm.Option) error {
+	if !public.FirstCheck(rmsg) {
+		return replyMarkdown(rmsg, "**该指令仅在串聊模式下可用**")
+	}
+	// 重新回答同样要调用模型，计入每日请求次数
+	if !CheckRequestTimes(rmsg) {
+		return nil
+	}
+	// 找到上一次回答及其问题，重新挂到对话记录中
+	var lastAnswer, lastQuestion db.Chat
+	if aid := public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle()); aid != 0 {
+		if (db.Chat{}).Find(map[string]interface{}{"id": aid}, &lastAnswer) == nil && lastAnswer.ParentContent != 0 {
+			_ = (db.Chat{}).Find(map[string]interface{}{"id": lastAnswer.ParentContent}, &lastQuestion)
+		}
+	}
+	// 替换的问题先保存，工具调用记录挂在实际提问的问题下
+	qid := lastQuestion.ID
+	if question != "" {
+		qid = saveRetryQuestion(rmsg, lastQuestion.ParentContent, question)
+	}
+	if opt := toolOption(rmsg, qid); opt != nil {
+		opts = append(opts, opt)
+	}
+	// 发送 停止 可以中断，停止后不再回复回答
+	ctx, done := startAnswer(rmsg, "")
+	defer done()
+	var model answerModel
+	opts = append(opts, llm.WithContext(ctx), model.option())
+	cli, asked, reply, err := llm.RetryQa(question, rmsg.GetSenderIdentifier(), opts...)
+	defer cli.Close()
+	if errors.Is(err, llm.ErrNoLastTurn) {
+		return replyMarkdown(rmsg, "**当前串聊中没有可以重新回答的对话**")
+	}
+	if err != nil && ctx.Err() != nil {
+		logger.Info(fmt.Sprintf("⏹ %s停止了回答的生成", rmsg.SenderNick))
+		return replyMarkdown(rmsg, stoppedNotice)
+	}
+	if err != nil {
+		logger.Info(fmt.Sprintf("gpt request error: %v", err))
+		return replyMarkdown(rmsg, fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v", err))
+	}
+	// 原来的问题没有记录时补上
+	if qid == 0 {
+		qid = saveRetryQuestion(rmsg, lastQuestion.ParentContent, asked)
+	}
+
+	reply = GuardAnswer(rmsg, strings.Trim(strings.TrimSpace(reply), "\n"))
+	aid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.A,
+		ParentContent: qid,
+		Content:       reply,
+		ModelName:     model.name(),
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
+	_ = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
+	logger.Info(fmt.Sprintf("🤖 %s重新得到的答案: %#v", rmsg.SenderNick, reply))
+
+	reply = ModerateAnswer(rmsg, reply)
+	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), threadTag(rmsg)+FormatMarkdown(reply))
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+// saveRetryQuestion 保存重新提问的问题，parent 为原问题所接的回答，返回问题的编号
+func saveRetryQuestion(rmsg *dingbot.ReceiveMsg, parent uint, question string) uint {
+	qid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.Q,
+		ParentContent: parent,
+		Content:       question,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	return qid
+}
@@ -1,11 +1,13 @@
 package process
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
 
 	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
@@ -15,22 +17,22 @@ import (
 )
 
 // DoStream 使用流式输出执行处理请求
-func DoStream(mode string, rmsg *dingbot.ReceiveMsg) error {
+func DoStream(mode string, rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
 	// 先把模式注入
 	public.UserService.SetUserMode(rmsg.GetSenderIdentifier(), mode)
 
 	switch mode {
 	case "单聊":
-		return doSingleChatStream(rmsg)
+		return doSingleChatStream(rmsg, opts...)
 	case "串聊":
-		return doContextChatStream(rmsg)
+		return doContextChatStream(rmsg, opts...)
 	default:
 		return nil
 	}
 }
 
 // doSingleChatStream 单聊流式处理
-func doSingleChatStream(rmsg *dingbot.ReceiveMsg) error {
+func doSingleChatStream(rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
 	// 保存问题到数据库
 	qObj := db.Chat{
 		Username:      rmsg.SenderNick,
@@ -44,12 +46,19 @@ func doSingleChatStream(rmsg *dingbot.ReceiveMsg) error {
 		logger.Error("往MySQL新增数据失败,错误信息：", err)
 	}
 
-	// 获取流式内容
-	contentCh, cleanup, err := llm.SingleQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier())
+	// 获取流式内容，发送 停止 可以中断
+	ctx, done := startAnswer(rmsg, "")
+	defer done()
+	var model answerModel
+	if opt := toolOption(rmsg, qid); opt != nil {
+		opts = append(opts, opt)
+	}
+	opts = append(opts, llm.WithContext(ctx), model.option())
+	contentCh, cleanup, err := llm.SingleQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
 	if err != nil {
 		logger.Info(fmt.Errorf("gpt request error: %v", err))
 		if strings.Contains(fmt.Sprintf("%v", err), "maximum question length exceeded") {
-			public.UserService.ClearUserSessionContext(rmsg.GetSenderIdentifier())
+			llm.ClearConversation(rmsg.GetSenderIdentifier())
 			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v\n\n> 已超过最大文本限制，请缩短提问文字的字数。", err))
 			if err != nil {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -64,21 +73,13 @@ func doSingleChatStream(rmsg *dingbot.ReceiveMsg) error {
 	}
 	defer cleanup()
 
-	// 使用简化版本:直接累积内容后一次性回复
-	fullContent := ""
-	for content := range contentCh {
-		fullContent += content
-	}
-
+	// 先回复占位消息，再按段落分批回复
+	fullContent, shown := streamReplies(ctx, rmsg, contentCh)
 	if fullContent == "" {
 		logger.Warning("get gpt result failed: empty response")
 		return nil
 	}
 
-	// 格式化和处理答案
-	fullContent = strings.TrimSpace(fullContent)
-	fullContent = strings.Trim(fullContent, "\n")
-
 	// 保存答案到数据库
 	aObj := db.Chat{
 		Username:      rmsg.SenderNick,
@@ -86,31 +87,23 @@ func doSingleChatStream(rmsg *dingbot.ReceiveMsg) error {
 		ChatType:      db.A,
 		ParentContent: qid,
 		Content:       fullContent,
+		ModelName:     model.name(),
 	}
-	_, err = aObj.Add()
+	aid, err := aObj.Add()
 	if err != nil {
 		logger.Error("往MySQL新增数据失败,错误信息：", err)
 	}
+	// 记录最近一次回答，供 #反馈 使用
+	public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
 
 	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, fullContent))
-
-	// 敏感词过滤
-	if public.JudgeSensitiveWord(fullContent) {
-		fullContent = public.SolveSensitiveWord(fullContent)
-	}
-
-	// 回复用户
-	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), FormatMarkdown(fullContent))
-	if err != nil {
-		logger.Warning(fmt.Errorf("send message error: %v", err))
-		return err
-	}
+	replyVoice(rmsg, shown)
 
 	return nil
 }
 
 // doContextChatStream 串聊流式处理
-func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
+func doContextChatStream(rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
 	// 保存问题到数据库
 	lastAid := public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
 	qObj := db.Chat{
@@ -125,12 +118,19 @@ func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
 		logger.Error("往MySQL新增数据失败,错误信息：", err)
 	}
 
-	// 获取流式内容
-	cli, contentCh, err := llm.ContextQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier())
+	// 获取流式内容，发送 停止 可以中断
+	ctx, done := startAnswer(rmsg, "")
+	defer done()
+	var model answerModel
+	if opt := toolOption(rmsg, qid); opt != nil {
+		opts = append(opts, opt)
+	}
+	opts = append(opts, llm.WithContext(ctx), model.option())
+	cli, contentCh, err := llm.ContextQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
 	if err != nil {
 		logger.Info(fmt.Sprintf("gpt request error: %v", err))
 		if strings.Contains(fmt.Sprintf("%v", err), "maximum text length exceeded") {
-			public.UserService.ClearUserSessionContext(rmsg.GetSenderIdentifier())
+			llm.ClearConversation(rmsg.GetSenderIdentifier())
 			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 请求 OpenAI 失败了\n\n> 错误信息:%v\n\n> 串聊已超过最大文本限制，对话已重置，请重新发起。", err))
 			if err != nil {
 				logger.Warning(fmt.Errorf("send message error: %v", err))
@@ -145,21 +145,13 @@ func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
 	}
 	defer cli.Close()
 
-	// 使用简化版本:直接累积内容后一次性回复
-	fullContent := ""
-	for content := range contentCh {
-		fullContent += content
-	}
-
+	// 先回复占位消息，再按段落分批回复
+	fullContent, shown := streamReplies(ctx, rmsg, contentCh)
 	if fullContent == "" {
 		logger.Warning("get gpt result failed: empty response")
 		return nil
 	}
 
-	// 格式化和处理答案
-	fullContent = strings.TrimSpace(fullContent)
-	fullContent = strings.Trim(fullContent, "\n")
-
 	// 保存答案到数据库
 	aObj := db.Chat{
 		Username:      rmsg.SenderNick,
@@ -167,6 +159,7 @@ func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
 		ChatType:      db.A,
 		ParentContent: qid,
 		Content:       fullContent,
+		ModelName:     model.name(),
 	}
 	aid, err := aObj.Add()
 	if err != nil {
@@ -177,18 +170,7 @@ func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
 	public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
 
 	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, fullContent))
-
-	// 敏感词过滤
-	if public.JudgeSensitiveWord(fullContent) {
-		fullContent = public.SolveSensitiveWord(fullContent)
-	}
-
-	// 回复用户
-	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), FormatMarkdown(fullContent))
-	if err != nil {
-		logger.Warning(fmt.Errorf("send message error: %v", err))
-		return err
-	}
+	replyVoice(rmsg, shown)
 
 	// 保存对话上下文
 	_ = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
@@ -196,44 +178,129 @@ func doContextChatStream(rmsg *dingbot.ReceiveMsg) error {
 	return nil
 }
 
-// DoStreamWithCard 使用流式卡片输出执行处理请求 (需要配置卡片模板)
-func DoStreamWithCard(mode string, rmsg *dingbot.ReceiveMsg, cardTemplateID string) error {
-	// 先把模式注入
-	public.UserService.SetUserMode(rmsg.GetSenderIdentifier(), mode)
+// 分批回复时每条消息的长度范围
+const (
+	streamChunkMinRunes = 200
+	streamChunkMaxRunes = 2000
+)
+
+// streamReplyInterval 两次回复之间的最小间隔，避免触发机器人的发送频率限制
+var streamReplyInterval = time.Second
 
-	// 检查是否有 RobotCode，如果没有则降级为简化流式模式
-	clientId := rmsg.RobotCode
-	if clientId == "" {
-		logger.Warning("RobotCode is empty, fallback to simple stream mode")
-		return DoStream(mode, rmsg)
+// streamReplies 没有卡片可用时的流式回复：先回复“思考中…”，再在段落边界分批回复。
+// 敏感信息在分批之前脱敏，每批单独做内容审核，被整体拦截后不再回复后续内容，ctx 被取消时回复已停止；
+// 完整回答结束后只做一次敏感信息的审计和提醒。返回脱敏后的完整回答以及实际展示给用户的内容
+func streamReplies(ctx context.Context, rmsg *dingbot.ReceiveMsg, contentCh <-chan string) (answer, shown string) {
+	if _, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), threadTag(rmsg)+"思考中…"); err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	// 跨分片的敏感信息会先暂存在过滤器中
+	secrets := public.SecretGuard.NewStreamFilter()
+	safeCh := make(chan string)
+	go func() {
+		defer close(safeCh)
+		for content := range contentCh {
+			if text := secrets.Write(content); text != "" {
+				safeCh <- text
+			}
+		}
+		if text := secrets.Flush(); text != "" {
+			safeCh <- text
+		}
+	}()
+	var replies []string
+	blocked := false
+	lastReply := time.Now()
+	_, err := dingbot.ChunkStream(safeCh, streamChunkMinRunes, streamChunkMaxRunes, func(chunk string) error {
+		if blocked {
+			return nil
+		}
+		reply := ModerateAnswer(rmsg, chunk)
+		blocked = reply == blockedAnswer
+		replies = append(replies, reply)
+		time.Sleep(streamReplyInterval - time.Since(lastReply))
+		lastReply = time.Now()
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), FormatMarkdown(reply))
+		return err
+	})
+	answer, notice := guardAnswer(rmsg, strings.TrimSpace(secrets.Raw()))
+	if err == nil && notice != "" && !blocked {
+		_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), notice)
 	}
+	if err == nil && ctx.Err() != nil {
+		_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), stoppedNotice)
+	}
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+	}
+	if notice != "" {
+		answer += "\n\n" + notice
+	}
+	return answer, strings.Join(replies, "\n\n")
+}
 
-	// 获取钉钉客户端
-	dingClient := public.DingTalkClientManager.GetClientByOAuthClientID(clientId)
-	if dingClient == nil {
-		logger.Warning(fmt.Errorf("dingtalk client not found for robot code: %s, fallback to simple stream mode", clientId))
-		return DoStream(mode, rmsg)
+// aiCardUnavailable 记录创建内置 AI 卡片失败的机器人（例如应用没有卡片权限），一段时间内不再尝试
+var aiCardUnavailable = cache.New(time.Hour, 10*time.Minute)
+
+// streamAnswer 按能力选择流式输出方式：配置了卡片模板时使用该模板的卡片；
+// 机器人可以投放卡片时使用钉钉内置的 AI 卡片；否则先回复“思考中…”再按段落分批回复
+func streamAnswer(mode string, rmsg *dingbot.ReceiveMsg, opts ...llm.Option) error {
+	switch {
+	case public.Config.CardTemplateID != "":
+		logger.Info("🎴 使用流式卡片输出")
+		return DoStreamWithCard(mode, rmsg, public.Config.CardTemplateID, opts...)
+	case aiCardAvailable(rmsg):
+		logger.Info("🎴 使用钉钉内置 AI 卡片输出")
+		return DoStreamWithCard(mode, rmsg, dingbot.AICardTemplateID, opts...)
+	default:
+		logger.Info("💬 使用分批流式输出")
+		return DoStream(mode, rmsg, opts...)
+	}
+}
+
+// aiCardAvailable 能否投放内置 AI 卡片：需要机器人对应的应用凭证，私聊时需要用户的 staffId，且最近没有创建失败过
+func aiCardAvailable(rmsg *dingbot.ReceiveMsg) bool {
+	if _, err := robotClient(rmsg); err != nil {
+		return false
 	}
+	if rmsg.ConversationType != "2" && rmsg.SenderStaffId == "" {
+		return false
+	}
+	_, failed := aiCardUnavailable.Get(rmsg.RobotCode)
+	return !failed
+}
 
+// robotClient 返回机器人对应的钉钉客户端，用于投放卡片
+func robotClient(rmsg *dingbot.ReceiveMsg) (*dingbot.DingTalkClient, error) {
+	if rmsg.RobotCode == "" {
+		return nil, fmt.Errorf("RobotCode is empty")
+	}
+	dingClient := public.DingTalkClientManager.GetClientByOAuthClientID(rmsg.RobotCode)
+	if dingClient == nil {
+		return nil, fmt.Errorf("dingtalk client not found for robot code: %s", rmsg.RobotCode)
+	}
 	client, ok := dingClient.(*dingbot.DingTalkClient)
 	if !ok {
-		logger.Warning("invalid dingtalk client type, fallback to simple stream mode")
-		return DoStream(mode, rmsg)
+		return nil, fmt.Errorf("invalid dingtalk client type")
 	}
+	return client, nil
+}
 
-	// 生成唯一追踪ID
-	trackID := uuid.New().String()
+// DoStreamWithCard 使用流式卡片输出执行处理请求，cardTemplateID 为 dingbot.AICardTemplateID 时使用钉钉内置的 AI 卡片
+func DoStreamWithCard(mode string, rmsg *dingbot.ReceiveMsg, cardTemplateID string, opts ...llm.Option) error {
+	// 先把模式注入
+	public.UserService.SetUserMode(rmsg.GetSenderIdentifier(), mode)
 
-	// 创建并投放卡片
-	accessToken, err := client.GetAccessToken()
+	// 没有可用的钉钉客户端时降级为简化流式模式
+	client, err := robotClient(rmsg)
 	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
+		logger.Warning(fmt.Errorf("%v, fallback to simple stream mode", err))
+		return DoStream(mode, rmsg, opts...)
 	}
+	builtin := cardTemplateID == dingbot.AICardTemplateID
 
-	cardClient, err := dingbot.NewStreamCardClient()
-	if err != nil {
-		return fmt.Errorf("failed to create stream card client: %w", err)
-	}
+	// 生成唯一追踪ID
+	trackID := uuid.New().String()
 
 	// 构建OpenSpaceID
 	var openSpaceID string
@@ -257,148 +324,155 @@ func DoStreamWithCard(mode string, rmsg *dingbot.ReceiveMsg, cardTemplateID stri
 			"content": "",
 		},
 	}
+	if builtin {
+		createReq.CardData = dingbot.AICardData()
+	}
 
-	if err := cardClient.CreateAndDeliverCard(accessToken, createReq); err != nil {
+	// 创建并投放卡片
+	if err := client.CreateAndDeliverCard(createReq); err != nil {
 		logger.Warning(fmt.Errorf("failed to create card: %v", err))
+		if builtin {
+			aiCardUnavailable.SetDefault(rmsg.RobotCode, struct{}{})
+		}
 		// 卡片创建失败,降级为普通消息
-		return DoStream(mode, rmsg)
+		return DoStream(mode, rmsg, opts...)
 	}
 
-	// 发送初始状态
-	initialContent := fmt.Sprintf("**%s**\n\n%s", rmsg.Text.Content, "稍等，让我想一想……")
-	if err := client.UpdateAIStreamCard(trackID, initialContent, false); err != nil {
-		logger.Warning(fmt.Errorf("failed to update initial card: %v", err))
+	// 卡片的更新都交给单独的协程，合并频繁的更新并在失败时重试
+	header := threadTag(rmsg) + fmt.Sprintf("**%s**\n\n", rmsg.Text.Content)
+	updater := client.NewCardUpdater(trackID)
+	if builtin {
+		updater = client.NewAICardUpdater(trackID)
 	}
+	updater.Update(header + "稍等，让我想一想……")
 
-	// 获取流式内容
+	// 获取流式内容，发送 停止 或点击卡片上的停止按钮可以中断
+	ctx, done := startAnswer(rmsg, trackID)
+	defer done()
+	var llmErr error
+	var model answerModel
+	opts = append(opts, llm.WithContext(ctx), llm.OnStreamError(func(err error) { llmErr = err }), model.option())
+	// 先保存问题，工具调用记录挂在问题下
+	qid := saveStreamQuestion(mode, rmsg)
+	if opt := toolOption(rmsg, qid); opt != nil {
+		opts = append(opts, opt)
+	}
 	var contentCh <-chan string
 	var cli *llm.Client
 	if mode == "单聊" {
 		var cleanup func()
-		contentCh, cleanup, err = llm.SingleQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier())
-		defer cleanup()
+		contentCh, cleanup, err = llm.SingleQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
+		if err == nil {
+			defer cleanup()
+		}
 	} else {
-		cli, contentCh, err = llm.ContextQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier())
-		defer cli.Close()
+		cli, contentCh, err = llm.ContextQaStream(rmsg.Text.Content, rmsg.GetSenderIdentifier(), opts...)
+		if err == nil {
+			defer cli.Close()
+		}
 	}
-
 	if err != nil {
-		errorMsg := fmt.Sprintf("**%s**\n\n出错了: %v", rmsg.Text.Content, err)
-		if err := client.UpdateAIStreamCard(trackID, errorMsg, true); err != nil {
+		if err := updater.Fail(fmt.Sprintf("%s出错了: %v", header, err)); err != nil {
 			logger.Warning(fmt.Errorf("failed to update error card: %v", err))
 		}
 		return err
 	}
 
-	// 实时流式更新卡片内容
-	questionHeader := fmt.Sprintf("**%s**\n\n", rmsg.Text.Content)
-	fullContent := questionHeader
-
-	// 使用缓冲机制避免更新过于频繁
-	updateBuffer := ""
-	lastUpdateTime := time.Now()
-	minUpdateInterval := 300 * time.Millisecond // 最小更新间隔300ms
-
-	for {
-		content, ok := <-contentCh
-		if !ok {
-			// 流结束,发送最后的更新(如果有未发送的缓冲内容)
-			if updateBuffer != "" {
-				fullContent += updateBuffer
-				if err := client.UpdateAIStreamCard(trackID, fullContent, true); err != nil {
-					logger.Error(fmt.Errorf("failed to finalize card: %v", err))
-				}
-			} else {
-				// 标记为完成
-				if err := client.UpdateAIStreamCard(trackID, fullContent, true); err != nil {
-					logger.Error(fmt.Errorf("failed to finalize card: %v", err))
-				}
-			}
-
-			// 保存到数据库并处理后续逻辑
-			saveStreamResult(mode, rmsg, fullContent[len(questionHeader):], cli)
-			return nil
-		}
-
-		// 累积接收到的内容到缓冲区
-		updateBuffer += content
-
-		// 检查是否应该更新(距离上次更新超过最小间隔)
-		if time.Since(lastUpdateTime) >= minUpdateInterval {
-			fullContent += updateBuffer
-			updateBuffer = ""
-
-			// 立即更新卡片
-			if err := client.UpdateAIStreamCard(trackID, fullContent, false); err != nil {
-				logger.Warning(fmt.Errorf("failed to update card: %v", err))
-			}
+	answer, err := streamCard(ctx, updater, rmsg, header, contentCh, func() error { return llmErr })
+	if err != nil {
+		return err
+	}
+	replyVoice(rmsg, answer)
 
-			lastUpdateTime = time.Now()
-		}
+	// 保存到数据库并处理后续逻辑
+	aid := saveStreamAnswer(mode, rmsg, qid, answer, model.name(), cli, trackID)
+	// 操作按钮在自定义的卡片模板中，内置 AI 卡片没有按钮
+	if public.Config.CardActions && !builtin {
+		rememberAnswerCard(trackID, mode, rmsg, answer, qid, aid)
 	}
+	return nil
 }
 
-// saveStreamResult 保存流式结果到数据库
-func saveStreamResult(mode string, rmsg *dingbot.ReceiveMsg, answer string, cli *llm.Client) {
-	answer = strings.TrimSpace(answer)
-	answer = strings.Trim(answer, "\n")
-
-	if mode == "单聊" {
-		qObj := db.Chat{
-			Username:      rmsg.SenderNick,
-			Source:        rmsg.GetChatTitle(),
-			ChatType:      db.Q,
-			ParentContent: 0,
-			Content:       rmsg.Text.Content,
-		}
-		qid, err := qObj.Add()
-		if err != nil {
-			logger.Error("往MySQL新增数据失败,错误信息：", err)
-		}
+// streamCard 把流式内容实时更新到卡片，结束后对完整回答做与普通回复一致的审核，再完成卡片，返回审核后的回答。
+// ctx 被取消时保留已经生成的内容并标记为已停止；llmErr 返回模型请求中出现的错误，出错时卡片会标记为失败并返回该错误
+func streamCard(ctx context.Context, updater *dingbot.CardUpdater, rmsg *dingbot.ReceiveMsg, header string, contentCh <-chan string, llmErr func() error) (string, error) {
+	// 敏感信息和敏感词在推送到卡片之前脱敏、打码，跨分片的内容会先暂存在过滤器中
+	secrets := public.SecretGuard.NewStreamFilter()
+	filter := public.Moderator.NewStreamFilter()
+	for content := range contentCh {
+		updater.Update(header + filter.Write(secrets.Write(content)))
+	}
 
-		aObj := db.Chat{
-			Username:      rmsg.SenderNick,
-			Source:        rmsg.GetChatTitle(),
-			ChatType:      db.A,
-			ParentContent: qid,
-			Content:       answer,
+	answer := strings.Trim(strings.TrimSpace(secrets.Raw()), "\n")
+	answer = GuardAnswer(rmsg, answer)
+	answer = ModerateAnswer(rmsg, answer)
+	if ctx.Err() != nil {
+		logger.Info(fmt.Sprintf("⏹ %s停止了回答的生成", rmsg.SenderNick))
+		if err := updater.Finish(strings.TrimSpace(header+answer) + "\n\n" + stoppedNotice); err != nil {
+			logger.Error(fmt.Errorf("failed to finalize card: %v", err))
 		}
-		_, err = aObj.Add()
-		if err != nil {
-			logger.Error("往MySQL新增数据失败,错误信息：", err)
-		}
-	} else { // 串聊
-		lastAid := public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
-		qObj := db.Chat{
-			Username:      rmsg.SenderNick,
-			Source:        rmsg.GetChatTitle(),
-			ChatType:      db.Q,
-			ParentContent: lastAid,
-			Content:       rmsg.Text.Content,
+		return answer, nil
+	}
+	if err := llmErr(); err != nil {
+		logger.Info(fmt.Errorf("gpt request error: %v", err))
+		// 已经输出的内容保留在卡片中，没有输出内容时流中只有错误信息
+		partial := ""
+		if answer != "" && answer != strings.TrimSpace(err.Error()) {
+			partial = answer + "\n\n"
 		}
-		qid, err := qObj.Add()
-		if err != nil {
-			logger.Error("往MySQL新增数据失败,错误信息：", err)
+		if uerr := updater.Fail(fmt.Sprintf("%s%s> 出错了: %v", header, partial, err)); uerr != nil {
+			logger.Error(fmt.Errorf("failed to finalize card: %v", uerr))
 		}
+		return "", err
+	}
+	if err := updater.Finish(header + answer); err != nil {
+		logger.Error(fmt.Errorf("failed to finalize card: %v", err))
+	}
+	return answer, nil
+}
 
-		aObj := db.Chat{
-			Username:      rmsg.SenderNick,
-			Source:        rmsg.GetChatTitle(),
-			ChatType:      db.A,
-			ParentContent: qid,
-			Content:       answer,
-		}
-		aid, err := aObj.Add()
-		if err != nil {
-			logger.Error("往MySQL新增数据失败,错误信息：", err)
-		}
+// saveStreamQuestion 保存流式提问的问题到数据库，返回问题的编号
+func saveStreamQuestion(mode string, rmsg *dingbot.ReceiveMsg) uint {
+	var parent uint
+	if mode == "串聊" {
+		parent = public.UserService.GetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
+	}
+	qid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.Q,
+		ParentContent: parent,
+		Content:       rmsg.Text.Content,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	return qid
+}
 
-		public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
+// saveStreamAnswer 保存流式结果到数据库，model 为生成回答的模型，返回回答的编号
+func saveStreamAnswer(mode string, rmsg *dingbot.ReceiveMsg, qid uint, answer, model string, cli *llm.Client, trackID string) uint {
+	answer = strings.TrimSpace(answer)
+	answer = strings.Trim(answer, "\n")
 
-		if cli != nil {
-			_ = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
-		}
+	aid, err := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.A,
+		ParentContent: qid,
+		Content:       answer,
+		TrackID:       trackID,
+		ModelName:     model,
+	}.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+	// 记录最近一次回答，供 #反馈 使用
+	public.UserService.SetAnswerID(rmsg.SenderNick, rmsg.GetChatTitle(), aid)
+	if mode == "串聊" && cli != nil {
+		_ = cli.ChatContext.SaveConversation(rmsg.GetSenderIdentifier())
 	}
 
 	logger.Info(fmt.Sprintf("🤖 %s得到的答案: %#v", rmsg.SenderNick, answer))
+	return aid
 }
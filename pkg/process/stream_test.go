@@ -0,0 +1,167 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/cache"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/guard"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// fakeUserService 只实现分批回复用到的对话模式，用户处于单聊模式
+type fakeUserService struct {
+	cache.UserServiceInterface
+}
+
+func (fakeUserService) GetUserMode(string) string { return "单聊" }
+
+// openTestDB 使用内存数据库代替 db.DB
+func openTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个连接都是一个独立的内存数据库，只使用一个连接
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := conn.AutoMigrate(db.Audit{}, db.Chat{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = prev })
+}
+
+// fakeStream 按固定长度把文本切成流式分片
+func fakeStream(text string, size int) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		runes := []rune(text)
+		for i := 0; i < len(runes); i += size {
+			ch <- string(runes[i:min(i+size, len(runes))])
+		}
+	}()
+	return ch
+}
+
+// newReplyServer 模拟会话的 webhook，返回收到的 Markdown 消息
+func newReplyServer(t *testing.T) (*dingbot.ReceiveMsg, func() []string) {
+	t.Helper()
+	logger.InitLogger("info")
+	users, interval := public.UserService, streamReplyInterval
+	public.UserService, streamReplyInterval = fakeUserService{}, 0
+	t.Cleanup(func() { public.UserService, streamReplyInterval = users, interval })
+
+	var mu sync.Mutex
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg dingbot.MarkDownMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		texts = append(texts, msg.MarkDown.Text)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	rmsg := &dingbot.ReceiveMsg{
+		SessionWebhook:   srv.URL,
+		ConversationType: "1",
+		SenderStaffId:    "staff",
+		SenderNick:       "tester",
+	}
+	return rmsg, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), texts...)
+	}
+}
+
+func TestStreamReplies_Chunks(t *testing.T) {
+	rmsg, replies := newReplyServer(t)
+	first, second := strings.Repeat("甲", 250), strings.Repeat("乙", 250)
+	text := first + "\n\n" + second + "\n\n结尾"
+
+	answer, shown := streamReplies(context.Background(), rmsg, fakeStream(text, 7))
+	if answer != text {
+		t.Errorf("expected answer %q, got %q", text, answer)
+	}
+	if shown != text {
+		t.Errorf("expected shown %q, got %q", text, shown)
+	}
+	want := []string{"思考中…", first, second, "结尾"}
+	if got := replies(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected replies %q, got %q", want, got)
+	}
+}
+
+func TestStreamReplies_Stopped(t *testing.T) {
+	rmsg, replies := newReplyServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	answer, _ := streamReplies(ctx, rmsg, fakeStream("已经生成的部分", 3))
+	if answer != "已经生成的部分" {
+		t.Errorf("expected partial answer to be kept, got %q", answer)
+	}
+	got := replies()
+	if len(got) != 3 || got[0] != "思考中…" || got[1] != "已经生成的部分" || got[2] != stoppedNotice {
+		t.Errorf("expected placeholder, partial answer and stopped notice, got %q", got)
+	}
+}
+
+func TestStreamReplies_SecretsGuardedOnce(t *testing.T) {
+	rmsg, replies := newReplyServer(t)
+	openTestDB(t)
+	g, err := guard.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := public.SecretGuard
+	public.SecretGuard = g
+	t.Cleanup(func() { public.SecretGuard = prev })
+
+	secret := "sk-abcdefghijklmnopqrstuvwxyz123456"
+	text := strings.Repeat("甲", 200) + "，key: " + secret + "\n\n" + strings.Repeat("乙", 200) + "，还是 " + secret
+
+	answer, _ := streamReplies(context.Background(), rmsg, fakeStream(text, 5))
+	notices := 0
+	for _, reply := range replies() {
+		if strings.Contains(reply, "sk-abcdefghij") {
+			t.Errorf("secret should be redacted before replying, got %q", reply)
+		}
+		if strings.Contains(reply, "已自动脱敏") {
+			notices++
+		}
+	}
+	if notices != 1 {
+		t.Errorf("expected a single notice, got %d in %q", notices, replies())
+	}
+	if strings.Contains(answer, "sk-abcdefghij") || strings.Count(answer, "已自动脱敏") != 1 {
+		t.Errorf("expected the saved answer redacted with one notice at the end, got %q", answer)
+	}
+	var count int64
+	db.DB.Model(&db.Audit{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected one audit row, got %d", count)
+	}
+}
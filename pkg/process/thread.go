@@ -0,0 +1,367 @@
+package process
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// defaultThreadName 默认话题在指令中使用的名称
+const defaultThreadName = "默认"
+
+// 每个用户最多可以创建的话题数量，以及话题名称的最大长度
+const (
+	maxThreads         = 20
+	maxThreadNameRunes = 20
+)
+
+// threadTitlePrompt 根据对话内容生成话题标题的提示词
+const threadTitlePrompt = "请用不超过 10 个字概括下面这段对话的主题，只输出标题，不要加标点和引号：\n\n"
+
+// threadStore 把当前话题的对话上下文保存到数据库，包括默认话题
+type threadStore struct{}
+
+// ThreadStore 返回按话题保存对话上下文的存储，在程序启动时设置给 llm.Store
+func ThreadStore() llm.ConversationStore {
+	return threadStore{}
+}
+
+// Load 读取当前话题保存的对话上下文
+func (threadStore) Load(userid string) string {
+	thread := storedThread(userid)
+	if thread == nil {
+		return ""
+	}
+	return decodeThreadContext(thread.Context)
+}
+
+// Save 保存当前话题的对话上下文，命名话题第一次保存时根据对话内容生成标题，每个话题只生成一次
+func (threadStore) Save(userid, content string) {
+	thread := currentThread(userid)
+	if thread == nil {
+		if err := saveDefaultThread(userid, content); err != nil {
+			logger.Error("保存话题上下文失败,错误信息：", err)
+		}
+		return
+	}
+	if err := thread.UpdateContext(encodeThreadContext(content)); err != nil {
+		logger.Error("保存话题上下文失败,错误信息：", err)
+		return
+	}
+	if thread.Title != "" || thread.TitleRequested {
+		return
+	}
+	claimed, err := thread.ClaimTitle()
+	if err != nil {
+		logger.Error("保存话题标题失败,错误信息：", err)
+		return
+	}
+	if claimed {
+		go titleThread(*thread, content)
+	}
+}
+
+// Clear 清空当前话题的对话上下文
+func (threadStore) Clear(userid string) {
+	thread := storedThread(userid)
+	if thread == nil {
+		return
+	}
+	if err := thread.UpdateContext(""); err != nil {
+		logger.Error("清空话题上下文失败,错误信息：", err)
+	}
+}
+
+// currentThread 获取用户当前所在的命名话题，在默认话题中时返回 nil
+func currentThread(userid string) *db.Thread {
+	thread, err := db.Thread{}.FindCurrent(userid)
+	if err != nil {
+		logger.Error("查询当前话题失败,错误信息：", err)
+		return nil
+	}
+	if thread == nil || thread.Name == "" {
+		return nil
+	}
+	return thread
+}
+
+// storedThread 获取保存用户当前话题上下文的记录，默认话题还没有保存过时返回 nil
+func storedThread(userid string) *db.Thread {
+	if thread := currentThread(userid); thread != nil {
+		return thread
+	}
+	thread, err := db.Thread{}.Find(userid, "")
+	if err != nil {
+		logger.Error("查询当前话题失败,错误信息：", err)
+		return nil
+	}
+	return thread
+}
+
+// titleThread 让模型根据对话内容生成话题标题
+func titleThread(thread db.Thread, content string) {
+	history := llm.HistoryText(content, 1000)
+	if history == "" {
+		return
+	}
+	title, err := llm.SingleQa(threadTitlePrompt+history, thread.UserID)
+	if err != nil {
+		logger.Warning(fmt.Errorf("generate thread title error: %v", err))
+		return
+	}
+	title = strings.Trim(strings.TrimSpace(title), "\"'“”《》。")
+	if utf8.RuneCountInString(title) > maxThreadNameRunes {
+		title = string([]rune(title)[:maxThreadNameRunes])
+	}
+	if title == "" {
+		return
+	}
+	if err := thread.UpdateTitle(title); err != nil {
+		logger.Error("保存话题标题失败,错误信息：", err)
+	}
+}
+
+func encodeThreadContext(content string) string {
+	return base64.StdEncoding.EncodeToString([]byte(content))
+}
+
+func decodeThreadContext(content string) string {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// threadTag 串聊在命名话题中进行时，在回复开头标注当前话题
+func threadTag(rmsg *dingbot.ReceiveMsg) string {
+	if !public.FirstCheck(rmsg) {
+		return ""
+	}
+	thread := currentThread(rmsg.GetSenderIdentifier())
+	if thread == nil {
+		return ""
+	}
+	return fmt.Sprintf("> 💬 话题：%s\n\n", thread.Name)
+}
+
+// threadName 解析指令后面的话题名称
+func threadName(rmsg *dingbot.ReceiveMsg, command string) string {
+	fields := strings.Fields(strings.TrimPrefix(rmsg.Text.Content, command))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// NewThread 新建话题并切换过去，#新话题 <名称>
+func NewThread(rmsg *dingbot.ReceiveMsg) error {
+	name := threadName(rmsg, "#新话题")
+	if name == "" {
+		return replyMarkdown(rmsg, "**用法:** #新话题 <名称>，新建一个串聊话题并切换过去，例如 `#新话题 周报`")
+	}
+	if name == defaultThreadName {
+		return replyMarkdown(rmsg, fmt.Sprintf("**「%s」是保留的话题名称，请换一个名称**", defaultThreadName))
+	}
+	if utf8.RuneCountInString(name) > maxThreadNameRunes {
+		return replyMarkdown(rmsg, fmt.Sprintf("**话题名称不能超过 %d 个字**", maxThreadNameRunes))
+	}
+	userid := rmsg.GetSenderIdentifier()
+	exist, err := db.Thread{}.Find(userid, name)
+	if err != nil {
+		logger.Error("查询话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**新建话题失败，请稍后再试**")
+	}
+	if exist != nil {
+		return replyMarkdown(rmsg, fmt.Sprintf("**话题「%s」已经存在，发送 `#切换 %s` 切换过去**", name, name))
+	}
+	list, err := db.Thread{}.List(userid)
+	if err != nil {
+		logger.Error("查询话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**新建话题失败，请稍后再试**")
+	}
+	count := 0
+	for _, v := range list {
+		if v.Name != "" {
+			count++
+		}
+	}
+	if count >= maxThreads {
+		return replyMarkdown(rmsg, fmt.Sprintf("**最多只能创建 %d 个话题，请先使用 #删除话题 删除不用的话题**", maxThreads))
+	}
+
+	thread := db.Thread{UserID: userid, Name: name, LastUsedAt: time.Now()}
+	thread.ID, err = thread.Add()
+	if err != nil {
+		logger.Error("新建话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**新建话题失败，请稍后再试**")
+	}
+	if err := switchThread(rmsg, &thread); err != nil {
+		logger.Error("切换话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**切换话题失败，请稍后再试**")
+	}
+	return replyMarkdown(rmsg, fmt.Sprintf("**🆕 已新建并切换到话题「%s」**\n\n接下来的串聊都会在这个话题中进行，发送 `#话题列表` 查看全部话题，发送 `#切换 %s` 回到默认话题", name, defaultThreadName))
+}
+
+// ListThreads 查看全部话题，#话题列表
+func ListThreads(rmsg *dingbot.ReceiveMsg) error {
+	list, err := db.Thread{}.List(rmsg.GetSenderIdentifier())
+	if err != nil {
+		logger.Error("查询话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**查询话题失败，请稍后再试**")
+	}
+	current := ""
+	for _, v := range list {
+		if v.Current {
+			current = v.Name
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("### 💬 话题列表\n\n")
+	line := func(name, title string, lastUsed time.Time, isCurrent bool) {
+		fmt.Fprintf(&b, "- **%s**", name)
+		if isCurrent {
+			b.WriteString("（当前）")
+		}
+		if title != "" {
+			fmt.Fprintf(&b, "：%s", title)
+		}
+		if !lastUsed.IsZero() {
+			fmt.Fprintf(&b, "，最后使用于 %s", lastUsed.Format("01-02 15:04"))
+		}
+		b.WriteString("\n")
+	}
+	line(defaultThreadName, "", time.Time{}, current == "")
+	for _, v := range list {
+		if v.Name != "" {
+			line(v.Name, v.Title, v.LastUsedAt, v.Current)
+		}
+	}
+	b.WriteString("\n> 发送 `#切换 <名称>` 切换话题，`#新话题 <名称>` 新建话题，`#删除话题 <名称>` 删除话题")
+	return replyMarkdown(rmsg, b.String())
+}
+
+// SwitchThread 切换到指定话题，#切换 <名称>，#切换 默认 回到默认话题
+func SwitchThread(rmsg *dingbot.ReceiveMsg) error {
+	name := threadName(rmsg, "#切换")
+	if name == "" {
+		return replyMarkdown(rmsg, fmt.Sprintf("**用法:** #切换 <名称>，切换到指定话题，发送 `#切换 %s` 回到默认话题", defaultThreadName))
+	}
+	userid := rmsg.GetSenderIdentifier()
+	var target *db.Thread
+	if name != defaultThreadName {
+		var err error
+		target, err = db.Thread{}.Find(userid, name)
+		if err != nil {
+			logger.Error("查询话题失败,错误信息：", err)
+			return replyMarkdown(rmsg, "**切换话题失败，请稍后再试**")
+		}
+		if target == nil {
+			return replyMarkdown(rmsg, fmt.Sprintf("**话题「%s」不存在，发送 `#新话题 %s` 新建**", name, name))
+		}
+	}
+	if current := currentThread(userid); (current == nil && target == nil) || (current != nil && target != nil && current.ID == target.ID) {
+		public.UserService.SetUserMode(userid, "串聊")
+		return replyMarkdown(rmsg, fmt.Sprintf("**当前已经在话题「%s」中**", name))
+	}
+	if err := switchThread(rmsg, target); err != nil {
+		logger.Error("切换话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**切换话题失败，请稍后再试**")
+	}
+	return replyMarkdown(rmsg, fmt.Sprintf("**🔀 已切换到话题「%s」**\n\n接下来的串聊会接着这个话题的上下文进行", name))
+}
+
+// DeleteThread 删除指定话题，#删除话题 <名称>，删除当前话题时回到默认话题
+func DeleteThread(rmsg *dingbot.ReceiveMsg) error {
+	name := threadName(rmsg, "#删除话题")
+	if name == "" {
+		return replyMarkdown(rmsg, "**用法:** #删除话题 <名称>，删除指定的话题及其上下文")
+	}
+	if name == defaultThreadName {
+		return replyMarkdown(rmsg, "**默认话题不能删除，可以发送 `重置` 清空它的上下文**")
+	}
+	userid := rmsg.GetSenderIdentifier()
+	thread, err := db.Thread{}.Find(userid, name)
+	if err != nil {
+		logger.Error("查询话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**删除话题失败，请稍后再试**")
+	}
+	if thread == nil {
+		return replyMarkdown(rmsg, fmt.Sprintf("**话题「%s」不存在**", name))
+	}
+	tips := ""
+	if thread.Current {
+		if err := switchThread(rmsg, nil); err != nil {
+			logger.Error("切换话题失败,错误信息：", err)
+			return replyMarkdown(rmsg, "**删除话题失败，请稍后再试**")
+		}
+		tips = fmt.Sprintf("\n\n已回到话题「%s」", defaultThreadName)
+	}
+	if err := thread.Delete(); err != nil {
+		logger.Error("删除话题失败,错误信息：", err)
+		return replyMarkdown(rmsg, "**删除话题失败，请稍后再试**")
+	}
+	return replyMarkdown(rmsg, fmt.Sprintf("**🗑️ 已删除话题「%s」**%s", name, tips))
+}
+
+// switchThread 保存当前话题的上下文后切换到 target，target 为 nil 时回到默认话题。
+// 切换后恢复目标话题的上下文，并进入串聊模式
+func switchThread(rmsg *dingbot.ReceiveMsg, target *db.Thread) error {
+	userid := rmsg.GetSenderIdentifier()
+	content := public.UserService.GetUserSessionContext(userid)
+	// 话题在每次对话后都已保存，缓存过期时不要用空内容覆盖
+	if content != "" {
+		if current := currentThread(userid); current != nil {
+			if err := current.UpdateContext(encodeThreadContext(content)); err != nil {
+				return err
+			}
+		} else if err := saveDefaultThread(userid, content); err != nil {
+			return err
+		}
+	}
+
+	var id uint
+	if target != nil {
+		id = target.ID
+	}
+	if err := (db.Thread{}).SetCurrent(userid, id); err != nil {
+		return err
+	}
+
+	content = ""
+	if target != nil {
+		content = decodeThreadContext(target.Context)
+	} else if thread, err := (db.Thread{}).Find(userid, ""); err == nil && thread != nil {
+		content = decodeThreadContext(thread.Context)
+	}
+	if content == "" {
+		public.UserService.ClearUserSessionContext(userid)
+	} else {
+		public.UserService.SetUserSessionContext(userid, content)
+	}
+	public.UserService.ClearAnswerID(rmsg.SenderNick, rmsg.GetChatTitle())
+	public.UserService.SetUserMode(userid, "串聊")
+	return nil
+}
+
+// saveDefaultThread 保存默认话题的上下文
+func saveDefaultThread(userid, content string) error {
+	thread, err := db.Thread{}.Find(userid, "")
+	if err != nil {
+		return err
+	}
+	if thread == nil {
+		_, err = db.Thread{UserID: userid, LastUsedAt: time.Now(), Context: encodeThreadContext(content)}.Add()
+		return err
+	}
+	return thread.UpdateContext(encodeThreadContext(content))
+}
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/tools"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// InitTools 注册内置工具
+func InitTools() {
+	if err := tools.RegisterOps(tools.Default); err != nil {
+		logger.Warning(fmt.Errorf("register ops tools error: %v", err))
+	}
+}
+
+// toolOption 当前用户可以使用的工具，qid 为触发工具调用的问题编号，未开启工具调用或没有可用工具时返回 nil
+func toolOption(rmsg *dingbot.ReceiveMsg, qid uint) llm.Option {
+	if !public.Config.Tools.Enable {
+		return nil
+	}
+	list := tools.Default.List(public.JudgeAdminUsers(rmsg.SenderStaffId), public.Config.Tools.Disabled...)
+	if len(list) == 0 {
+		return nil
+	}
+	return llm.WithTools(list, func(call llm.ToolCall) {
+		logToolCall(rmsg, qid, call)
+	})
+}
+
+// logToolCall 将工具调用脱敏后记录到对话记录中，挂在触发调用的问题下
+func logToolCall(rmsg *dingbot.ReceiveMsg, qid uint, call llm.ToolCall) {
+	content := fmt.Sprintf("%s(%s) => %s", call.Name, call.Arguments, call.Result)
+	if call.Err != nil {
+		content = fmt.Sprintf("%s(%s) => error: %v", call.Name, call.Arguments, call.Err)
+	}
+	content, _ = public.SecretGuard.Scan(content)
+	logger.Info(fmt.Sprintf("🔧 %s触发工具调用: %s", rmsg.SenderNick, content))
+	tObj := db.Chat{
+		Username:      rmsg.SenderNick,
+		Source:        rmsg.GetChatTitle(),
+		ChatType:      db.T,
+		ParentContent: qid,
+		Content:       content,
+	}
+	if _, err := tObj.Add(); err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+	}
+}
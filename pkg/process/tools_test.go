@@ -0,0 +1,44 @@
+package process
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/guard"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+func TestLogToolCall_LinkedAndRedacted(t *testing.T) {
+	openTestDB(t)
+	g, err := guard.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := public.SecretGuard
+	public.SecretGuard = g
+	t.Cleanup(func() { public.SecretGuard = prev })
+
+	rmsg := &dingbot.ReceiveMsg{SenderNick: "张三"}
+	logToolCall(rmsg, 42, llm.ToolCall{
+		Name:      "env",
+		Arguments: "{}",
+		Result:    "OPENAI_KEY=sk-abcdefghijklmnopqrstuvwxyz123456",
+	})
+
+	var rows []db.Chat
+	if err := db.DB.Where("chat_type = ?", db.T).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected one tool call row, got %d", len(rows))
+	}
+	if rows[0].ParentContent != 42 {
+		t.Errorf("expected the tool call linked to question 42, got %d", rows[0].ParentContent)
+	}
+	if strings.Contains(rows[0].Content, "sk-abcdefghij") {
+		t.Errorf("expected the tool result redacted, got %q", rows[0].Content)
+	}
+}
@@ -0,0 +1,109 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 图片、图文消息在此处理
+
+// DefaultImageQuestion 只发送图片没有文字时的默认提问
+const DefaultImageQuestion = "请描述这张图片的内容"
+
+// ImageQuestion 下载消息中的图片，连同文字一起发送给识图模型
+func ImageQuestion(ctx context.Context, rmsg *dingbot.ReceiveMsg) error {
+	clientId, _ := ctx.Value(public.DingTalkClientIdKeyName).(string)
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(clientId)
+	if client == nil {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), "**无法下载图片**\n\n> 需要在配置文件中为该机器人配置 credentials")
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+		return err
+	}
+	var paths []string
+	for _, code := range rmsg.PictureCodes() {
+		path, err := saveMessagePicture(client, code, rmsg.RobotCode)
+		if err != nil {
+			logger.Warning(fmt.Errorf("download message picture error: %v", err))
+			_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), fmt.Sprintf("[Wrong] 下载图片失败了\n\n> 错误信息:%v", err))
+			if err != nil {
+				logger.Warning(fmt.Errorf("send message error: %v", err))
+			}
+			return err
+		}
+		paths = append(paths, path)
+	}
+	if strings.TrimSpace(rmsg.Text.Content) == "" {
+		rmsg.Text.Content = DefaultImageQuestion
+	}
+	logger.Info(fmt.Sprintf("🖼 %s发送了 %d 张图片: %#v", rmsg.SenderNick, len(paths), rmsg.Text.Content))
+	if !CheckRequestTimes(rmsg) {
+		return nil
+	}
+	return chat(rmsg, llm.WithImages(paths...))
+}
+
+// uploadDir 用户发送的图片的保存目录
+const uploadDir = "data/uploads"
+
+// saveMessagePicture 下载图片并保存到 data/uploads 目录，返回文件路径
+func saveMessagePicture(client dingbot.DingTalkClientInterface, downloadCode, robotCode string) (string, error) {
+	data, err := client.DownloadMessageFile(downloadCode, robotCode)
+	if err != nil {
+		return "", err
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("unsupported picture type: %s", contentType)
+	}
+	ext := "." + strings.TrimPrefix(contentType, "image/")
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(uploadDir, time.Now().Format("20060102-150405")+"-"+uuid.New().String()[:8]+ext)
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// StartUploadCleaner 每小时删除一次超过保存天数的图片，串聊上下文中引用的图片不存在时会被跳过
+func StartUploadCleaner() {
+	for {
+		cleanUploads(time.Now().AddDate(0, 0, -public.Config.UploadRetentionDays))
+		time.Sleep(time.Hour)
+	}
+}
+
+// cleanUploads 删除 before 之前保存的图片
+func cleanUploads(before time.Time) {
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(fmt.Errorf("read upload dir error: %v", err))
+		}
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || info.ModTime().After(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(uploadDir, e.Name())); err != nil {
+			logger.Warning(fmt.Errorf("remove upload %s error: %v", e.Name(), err))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/llm"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// 语音消息在此处理
+
+// TranscribeVoice 钉钉没有返回识别结果时，下载语音并调用语音转写接口，转写失败时回复用户并返回 false
+func TranscribeVoice(ctx context.Context, rmsg *dingbot.ReceiveMsg) bool {
+	reply := func(msg string) {
+		_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), msg)
+		if err != nil {
+			logger.Warning(fmt.Errorf("send message error: %v", err))
+		}
+	}
+	clientId, _ := ctx.Value(public.DingTalkClientIdKeyName).(string)
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(clientId)
+	if client == nil || rmsg.Content.DownloadCode == "" {
+		reply("**无法识别该语音消息**\n\n> 需要在配置文件中为该机器人配置 credentials")
+		return false
+	}
+	data, err := client.DownloadMessageFile(rmsg.Content.DownloadCode, rmsg.RobotCode)
+	if err != nil {
+		logger.Warning(fmt.Errorf("download voice error: %v", err))
+		reply(fmt.Sprintf("[Wrong] 下载语音失败了\n\n> 错误信息:%v", err))
+		return false
+	}
+	text, err := llm.Transcribe("voice"+audioExt(data), data)
+	if err != nil {
+		logger.Warning(fmt.Errorf("transcribe voice error: %v", err))
+		reply(fmt.Sprintf("[Wrong] 语音转写失败了\n\n> 错误信息:%v", err))
+		return false
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		reply("**没有听清您说的内容，请再说一遍**")
+		return false
+	}
+	logger.Info(fmt.Sprintf("🎙 %s的语音转写结果: %#v", rmsg.SenderNick, text))
+	rmsg.Text.Content = text
+	return true
+}
+
+// audioExt 根据文件头判断音频格式，转写接口依据文件扩展名识别格式
+func audioExt(data []byte) string {
+	switch {
+	case strings.HasPrefix(string(data), "#!AMR"):
+		return ".amr"
+	case strings.HasPrefix(string(data), "OggS"):
+		return ".ogg"
+	case strings.HasPrefix(string(data), "ID3"), len(data) > 1 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return ".mp3"
+	case strings.HasPrefix(http.DetectContentType(data), "audio/wave"):
+		return ".wav"
+	}
+	return ".m4a"
+}
+
+// replyVoice 语音提问时，将回答合成语音后再发送一条语音消息，失败时只打印日志
+func replyVoice(rmsg *dingbot.ReceiveMsg, answer string) {
+	conf := public.Config.Voice
+	if !conf.Enable || !conf.Reply || rmsg.Msgtype != dingbot.AUDIO {
+		return
+	}
+	text := speakable(answer)
+	if text == "" || utf8.RuneCountInString(text) > conf.ReplyMaxChars {
+		return
+	}
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(rmsg.RobotCode)
+	if client == nil {
+		logger.Warning(fmt.Errorf("dingtalk client not found for robot code: %s, skip voice reply", rmsg.RobotCode))
+		return
+	}
+	data, duration, err := llm.Speech(text)
+	if err != nil {
+		logger.Warning(fmt.Errorf("speech error: %v", err))
+		return
+	}
+	if len(data) > dingbot.MaxVoiceBytes || duration > dingbot.MaxVoiceDuration {
+		logger.Warning(fmt.Errorf("voice reply is too large: %d bytes, %dms, skip voice reply", len(data), duration))
+		return
+	}
+	media, err := client.UploadMedia(data, "reply.mp3", dingbot.MediaTypeVoice, "audio/mpeg")
+	if err != nil {
+		logger.Warning(fmt.Errorf("upload voice error: %v", err))
+		return
+	}
+	err = client.SendRobotMessage(rmsg.ConversationType, rmsg.ConversationID, []string{rmsg.SenderStaffId}, dingbot.RobotAudio(media.MediaID, duration))
+	if err != nil {
+		logger.Warning(fmt.Errorf("send voice error: %v", err))
+	}
+}
+
+var (
+	codeBlockRe = regexp.MustCompile("(?s)```.*?```")
+	linkRe      = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markRe      = regexp.MustCompile("[*#>`|_~]")
+)
+
+// speakable 去掉 Markdown 标记，代码块不朗读
+func speakable(md string) string {
+	s := codeBlockRe.ReplaceAllString(md, "（代码略）")
+	s = linkRe.ReplaceAllString(s, "$1")
+	s = markRe.ReplaceAllString(s, "")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,281 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/logger"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/ops"
+	"github.com/eryajf/chatgpt-dingtalk/public"
+)
+
+// watchKindName 监控类型的中文名称
+func watchKindName(kind string) string {
+	if kind == db.WatchDomain {
+		return "域名"
+	}
+	return "证书"
+}
+
+// watchThreshold 告警的剩余天数
+func watchThreshold(kind string) int {
+	if kind == db.WatchDomain {
+		return public.Config.Monitor.DomainDays
+	}
+	return public.Config.Monitor.CertDays
+}
+
+// AddWatch 登记证书或域名到期监控，登记前先检查一次，确认目标可以查询
+func AddWatch(rmsg *dingbot.ReceiveMsg, kind string) error {
+	args := strings.Fields(rmsg.Text.Content)
+	var reply string
+	switch {
+	case !public.Config.Monitor.Enable:
+		reply = "**到期监控未开启**"
+	case len(args) < 2:
+		reply = fmt.Sprintf("**用法:** #监控%s 域名，例如 `#监控%s example.com`", watchKindName(kind), watchKindName(kind))
+	default:
+		reply = addWatch(rmsg, kind, normalizeWatchTarget(kind, args[1]))
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+func addWatch(rmsg *dingbot.ReceiveMsg, kind, target string) string {
+	filter := map[string]interface{}{"kind": kind, "target": target, "conversation_id": rmsg.ConversationID}
+	if (db.Watch{}).Exist(filter) {
+		return fmt.Sprintf("**%s %s 已经在监控中**", watchKindName(kind), target)
+	}
+	list, err := db.Watch{}.List(db.WatchListReq{ConversationID: rmsg.ConversationID})
+	if err != nil {
+		logger.Error("查询监控失败,错误信息：", err)
+		return "**查询监控失败，请稍后再试**"
+	}
+	if len(list) >= public.Config.Monitor.MaxWatches {
+		return fmt.Sprintf("**当前会话最多登记 %d 个监控，请先使用 #取消监控 删除不需要的监控**", public.Config.Monitor.MaxWatches)
+	}
+	expireAt, err := checkWatch(kind, target)
+	if err != nil {
+		return fmt.Sprintf("**查询失败:** %v", err)
+	}
+	w := db.Watch{
+		Kind:              kind,
+		Target:            target,
+		ConversationType:  rmsg.ConversationType,
+		ConversationID:    rmsg.ConversationID,
+		ConversationTitle: rmsg.GetChatTitle(),
+		RobotCode:         rmsg.RobotCode,
+		UserID:            rmsg.SenderStaffId,
+		Creator:           rmsg.SenderNick,
+		ExpireAt:          expireAt,
+		CheckedAt:         time.Now(),
+	}
+	id, err := w.Add()
+	if err != nil {
+		logger.Error("往MySQL新增数据失败,错误信息：", err)
+		return "**添加监控失败，请稍后再试**"
+	}
+	AddAudit(rmsg, AuditActionMonitor, kind+":"+target, db.AuditAllow, "添加监控")
+	return fmt.Sprintf("**✅ 已添加%s监控 #%d**\n\n**目标:** %s\n\n**到期时间:** %v\n\n**剩余天数:** %d\n\n每天 %s 检查一次，剩余不足 %d 天时在当前会话告警",
+		watchKindName(kind), id, target, public.GetReadTime(expireAt), daysLeft(expireAt), public.Config.Monitor.CheckTime, watchThreshold(kind))
+}
+
+// normalizeWatchTarget 统一监控目标的写法，避免同一个域名重复登记
+func normalizeWatchTarget(kind, target string) string {
+	target = strings.ToLower(strings.TrimSpace(target))
+	if kind == db.WatchDomain {
+		target = strings.TrimPrefix(strings.TrimPrefix(target, "https://"), "http://")
+		target = strings.SplitN(target, "/", 2)[0]
+		target = strings.SplitN(target, ":", 2)[0]
+	} else if !strings.Contains(target, "://") {
+		target = strings.SplitN(target, "/", 2)[0]
+	}
+	return strings.TrimSuffix(target, ".")
+}
+
+// ListWatches 查看当前会话登记的监控
+func ListWatches(rmsg *dingbot.ReceiveMsg) error {
+	list, err := db.Watch{}.List(db.WatchListReq{ConversationID: rmsg.ConversationID})
+	var reply string
+	switch {
+	case err != nil:
+		logger.Error("查询监控失败,错误信息：", err)
+		reply = "**查询监控失败，请稍后再试**"
+	case len(list) == 0:
+		reply = "**当前会话没有登记监控**\n\n可以使用 `#监控证书 example.com` 或 `#监控域名 example.com` 添加"
+	default:
+		var b strings.Builder
+		b.WriteString("**到期监控列表**\n")
+		for _, w := range list {
+			fmt.Fprintf(&b, "\n- #%d %s %s，到期时间 %v，剩余 %d 天", w.ID, watchKindName(w.Kind), w.Target, public.GetReadTime(w.ExpireAt), daysLeft(w.ExpireAt))
+			if w.LastError != "" {
+				fmt.Fprintf(&b, "，最近一次检查失败：%s", w.LastError)
+			}
+		}
+		b.WriteString("\n\n使用 `#取消监控 编号或域名` 删除监控")
+		reply = b.String()
+	}
+	_, err = rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+// RemoveWatch 按编号或域名删除当前会话的监控
+func RemoveWatch(rmsg *dingbot.ReceiveMsg) error {
+	args := strings.Fields(rmsg.Text.Content)
+	var reply string
+	if len(args) < 2 {
+		reply = "**用法:** #取消监控 编号或域名，例如 `#取消监控 3`、`#取消监控 example.com`"
+	} else {
+		reply = removeWatch(rmsg, args[1])
+	}
+	_, err := rmsg.ReplyToDingtalk(string(dingbot.MARKDOWN), reply)
+	if err != nil {
+		logger.Warning(fmt.Errorf("send message error: %v", err))
+		return err
+	}
+	return nil
+}
+
+func removeWatch(rmsg *dingbot.ReceiveMsg, arg string) string {
+	list, err := db.Watch{}.List(db.WatchListReq{ConversationID: rmsg.ConversationID})
+	if err != nil {
+		logger.Error("查询监控失败,错误信息：", err)
+		return "**查询监控失败，请稍后再试**"
+	}
+	id, _ := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+	var ids []uint
+	var targets []string
+	for _, w := range list {
+		if uint64(w.ID) == id || w.Target == normalizeWatchTarget(w.Kind, arg) {
+			ids = append(ids, w.ID)
+			targets = append(targets, fmt.Sprintf("%s %s", watchKindName(w.Kind), w.Target))
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Sprintf("**当前会话没有找到监控 %s**", arg)
+	}
+	if err := (db.Watch{}).Delete(ids); err != nil {
+		logger.Error("删除监控失败,错误信息：", err)
+		return "**删除监控失败，请稍后再试**"
+	}
+	AddAudit(rmsg, AuditActionMonitor, strings.Join(targets, ","), db.AuditAllow, "取消监控")
+	return "**已取消监控:** " + strings.Join(targets, "、")
+}
+
+// checkWatch 查询证书或域名的到期时间
+func checkWatch(kind, target string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if kind == db.WatchDomain {
+		dm, err := ops.LookupDomain(ctx, target)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if dm.ExpiryDate == "" {
+			return time.Time{}, fmt.Errorf("no expiry date found for %s", target)
+		}
+		return ops.ParseWhoisTime(dm.ExpiryDate)
+	}
+	rst, err := ops.InspectCert(ctx, target, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rst.Leaf().NotAfter, nil
+}
+
+func daysLeft(t time.Time) int {
+	return int(time.Until(t).Hours() / 24)
+}
+
+// StartWatchScheduler 每天在配置的时间检查全部监控
+func StartWatchScheduler() {
+	if !public.Config.Monitor.Enable {
+		return
+	}
+	for {
+		next := nextCheckTime(time.Now(), public.Config.Monitor.CheckTime)
+		logger.Info(fmt.Sprintf("⏰ 下次到期监控检查时间: %v", public.GetReadTime(next)))
+		time.Sleep(time.Until(next))
+		CheckWatches()
+	}
+}
+
+// nextCheckTime 下一次检查时间，时间格式不正确时使用 09:30
+func nextCheckTime(now time.Time, hhmm string) time.Time {
+	at, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		logger.Warning(fmt.Errorf("invalid monitor check_time %q, use 09:30", hhmm))
+		at, _ = time.Parse("15:04", "09:30")
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// CheckWatches 检查全部监控，即将到期或检查失败时在登记的会话中告警
+func CheckWatches() {
+	list, err := db.Watch{}.List(db.WatchListReq{})
+	if err != nil {
+		logger.Error("查询监控失败,错误信息：", err)
+		return
+	}
+	for _, w := range list {
+		expireAt, err := checkWatch(w.Kind, w.Target)
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+			if len(lastError) > 250 {
+				lastError = lastError[:250]
+			}
+			expireAt = w.ExpireAt
+		}
+		if err := w.UpdateResult(expireAt, lastError); err != nil {
+			logger.Error("更新监控结果失败,错误信息：", err)
+		}
+
+		var text string
+		switch {
+		case err != nil:
+			text = fmt.Sprintf("### ⚠️ %s检查失败\n\n**目标:** %s\n\n**错误:** %v\n\n**上次记录的到期时间:** %v",
+				watchKindName(w.Kind), w.Target, err, public.GetReadTime(w.ExpireAt))
+		case daysLeft(expireAt) <= watchThreshold(w.Kind):
+			status := fmt.Sprintf("剩余 %d 天", daysLeft(expireAt))
+			if expireAt.Before(time.Now()) {
+				status = "已过期"
+			}
+			text = fmt.Sprintf("### ⚠️ %s即将到期\n\n**目标:** %s\n\n**到期时间:** %v\n\n**状态:** %s\n\n请及时续期",
+				watchKindName(w.Kind), w.Target, public.GetReadTime(expireAt), status)
+		default:
+			continue
+		}
+		sendWatchAlert(w, text)
+	}
+}
+
+// sendWatchAlert 通过机器人 OpenAPI 主动发送告警，SessionWebhook 有效期较短，不能用于定时消息
+func sendWatchAlert(w *db.Watch, text string) {
+	client := public.DingTalkClientManager.GetClientByOAuthClientID(w.RobotCode)
+	if client == nil {
+		logger.Warning(fmt.Errorf("dingtalk client not found for robot code: %s, skip alert of watch %d", w.RobotCode, w.ID))
+		return
+	}
+	err := client.SendRobotMessage(w.ConversationType, w.ConversationID, []string{w.UserID}, dingbot.RobotMarkdown(watchKindName(w.Kind)+"到期提醒", text))
+	if err != nil {
+		logger.Warning(fmt.Errorf("send watch alert error: %v", err))
+	}
+}
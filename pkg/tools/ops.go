@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eryajf/chatgpt-dingtalk/pkg/ops"
+)
+
+// domainArgs 运维工具的域名参数
+type domainArgs struct {
+	Domain string `json:"domain"`
+}
+
+var domainSchema = json.RawMessage(`{"type":"object","properties":{"domain":{"type":"string","description":"域名，例如 example.com，不要带协议和路径"}},"required":["domain"]}`)
+
+// RegisterOps 注册运维相关的工具
+func RegisterOps(r *Registry) error {
+	for _, t := range []Tool{
+		{
+			Name:        "domain_whois",
+			Description: "查询域名的注册信息，包括注册时间、到期时间、注册商、状态和 DNS 服务器",
+			Parameters:  domainSchema,
+			Handler:     domainWhois,
+		},
+		{
+			Name:        "domain_cert",
+			Description: "检查证书，返回完整证书链、SAN、密钥类型、校验结果、剩余天数、OCSP Stapling、TLS 版本和加密套件，支持 SMTP/IMAP 的 STARTTLS",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"domain":{"type":"string","description":"主机名，可以带端口，例如 example.com、example.com:8443、smtp://mail.example.com:587"},"sni":{"type":"string","description":"可选，TLS SNI，默认与主机名相同"}},"required":["domain"]}`),
+			Handler:     domainCert,
+		},
+		{
+			Name:        "dns_lookup",
+			Description: "查询域名的 DNS 记录，支持 A、AAAA、CNAME、MX、NS、TXT、PTR",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","description":"要查询的域名，PTR 记录填写 IP"},"type":{"type":"string","enum":["A","AAAA","CNAME","MX","NS","TXT","PTR"]},"server":{"type":"string","description":"可选，DNS 服务器地址，例如 223.5.5.5"}},"required":["name"]}`),
+			Handler:     dnsLookup,
+		},
+		{
+			Name:        "http_probe",
+			Description: "请求网址，返回状态码、耗时、重定向链以及 HTTPS 证书信息",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"要探测的网址，例如 https://example.com"}},"required":["url"]}`),
+			Handler:     httpProbe,
+		},
+		{
+			Name:        "tcp_check",
+			Description: "检测主机的 TCP 端口是否可以连接",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"addr":{"type":"string","description":"主机:端口，例如 example.com:443"}},"required":["addr"]}`),
+			Handler:     tcpCheck,
+		},
+		{
+			Name:        "ip_info",
+			Description: "查询 IP 地址的反向解析和所属 ASN",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"ip":{"type":"string"}},"required":["ip"]}`),
+			Handler:     ipInfo,
+		},
+		{
+			Name:        "feed_fetch",
+			Description: "获取 RSS 或 Atom 订阅源的最新文章标题、链接、发布时间和摘要",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"订阅源地址"},"limit":{"type":"integer","description":"可选，返回的文章数量，默认 10"}},"required":["url"]}`),
+			Handler:     feedFetch,
+		},
+	} {
+		if err := r.Register(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseDomain(args json.RawMessage) (string, error) {
+	var a domainArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	domain := strings.TrimSpace(a.Domain)
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	domain = strings.TrimSuffix(strings.SplitN(domain, "/", 2)[0], ".")
+	if domain == "" {
+		return "", errors.New("domain is required")
+	}
+	return domain, nil
+}
+
+func domainWhois(ctx context.Context, args json.RawMessage) (string, error) {
+	domain, err := parseDomain(args)
+	if err != nil {
+		return "", err
+	}
+	return jsonResult(ops.LookupDomain(ctx, domain))
+}
+
+func domainCert(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		Domain string `json:"domain"`
+		SNI    string `json:"sni"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(a.Domain) == "" {
+		return "", errors.New("domain is required")
+	}
+	return jsonResult(ops.InspectCert(ctx, a.Domain, a.SNI))
+}
+
+func dnsLookup(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Server string `json:"server"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	return jsonResult(ops.LookupDNS(ctx, a.Name, a.Type, a.Server))
+}
+
+func httpProbe(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	return jsonResult(ops.ProbeHTTP(ctx, a.URL))
+}
+
+func tcpCheck(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		Addr string `json:"addr"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	return jsonResult(ops.CheckTCP(ctx, a.Addr))
+}
+
+func ipInfo(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		IP string `json:"ip"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	return jsonResult(ops.LookupIPInfo(ctx, a.IP))
+}
+
+func feedFetch(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		URL   string `json:"url"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	return jsonResult(ops.FetchFeed(ctx, a.URL, a.Limit))
+}
+
+// jsonResult 将探测结果序列化后交给模型
+func jsonResult(v interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
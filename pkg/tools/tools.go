@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Handler 工具的执行函数，args 为模型生成的 JSON 参数，返回交给模型的结果文本
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool 可以被模型调用的工具
+type Tool struct {
+	// Name 工具名称，只能包含字母、数字、下划线和中划线
+	Name string
+	// Description 工具说明，模型根据说明决定何时调用
+	Description string
+	// Parameters 参数的 JSON Schema
+	Parameters json.RawMessage
+	// AdminOnly 仅管理员可用
+	AdminOnly bool
+	Handler   Handler
+}
+
+// Registry 工具注册表
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]Tool{}}
+}
+
+// Default 默认注册表
+var Default = NewRegistry()
+
+// Register 注册工具，名称重复或参数不合法时返回错误
+func (r *Registry) Register(t Tool) error {
+	if !validName(t.Name) {
+		return fmt.Errorf("invalid tool name: %q", t.Name)
+	}
+	if t.Handler == nil {
+		return fmt.Errorf("tool %s has no handler", t.Name)
+	}
+	if len(t.Parameters) == 0 {
+		t.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	if !json.Valid(t.Parameters) {
+		return fmt.Errorf("tool %s has invalid parameters schema", t.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[t.Name]; ok {
+		return fmt.Errorf("tool %s already registered", t.Name)
+	}
+	r.tools[t.Name] = t
+	return nil
+}
+
+// Get 按名称获取工具
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// List 用户可用的工具，按名称排序；admin 为 false 时不包含仅管理员可用的工具
+// disabled 中的工具会被排除
+func (r *Registry) List(admin bool, disabled ...string) []Tool {
+	skip := map[string]bool{}
+	for _, name := range disabled {
+		skip[name] = true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var rst []Tool
+	for _, t := range r.tools {
+		if skip[t.Name] || (t.AdminOnly && !admin) {
+			continue
+		}
+		rst = append(rst, t)
+	}
+	sort.Slice(rst, func(i, j int) bool { return rst[i].Name < rst[j].Name })
+	return rst
+}
+
+// Register 在默认注册表中注册工具
+func Register(t Tool) error {
+	return Default.Register(t)
+}
+
+func validName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	handler := func(ctx context.Context, args json.RawMessage) (string, error) { return "ok", nil }
+	if err := r.Register(Tool{Name: "ping", Handler: handler}); err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	if err := r.Register(Tool{Name: "ping", Handler: handler}); err == nil {
+		t.Errorf("duplicate tool should be rejected")
+	}
+	if err := r.Register(Tool{Name: "bad name", Handler: handler}); err == nil {
+		t.Errorf("invalid name should be rejected")
+	}
+	if err := r.Register(Tool{Name: "nohandler"}); err == nil {
+		t.Errorf("tool without handler should be rejected")
+	}
+	if err := r.Register(Tool{Name: "reboot", AdminOnly: true, Handler: handler}); err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+
+	if got := r.List(false); len(got) != 1 || got[0].Name != "ping" {
+		t.Errorf("non-admin tools = %v, want [ping]", got)
+	}
+	if got := r.List(true); len(got) != 2 || got[0].Name != "ping" || got[1].Name != "reboot" {
+		t.Errorf("admin tools = %v, want [ping reboot]", got)
+	}
+	if got := r.List(true, "ping"); len(got) != 1 || got[0].Name != "reboot" {
+		t.Errorf("tools with ping disabled = %v, want [reboot]", got)
+	}
+	if tool, ok := r.Get("ping"); !ok || string(tool.Parameters) == "" {
+		t.Errorf("default parameters schema not set")
+	}
+}
+
+func TestParseDomain(t *testing.T) {
+	cases := map[string]string{
+		`{"domain":"example.com"}`:               "example.com",
+		`{"domain":" https://example.com/a/b "}`: "example.com",
+		`{"domain":"example.com."}`:              "example.com",
+	}
+	for args, want := range cases {
+		got, err := parseDomain(json.RawMessage(args))
+		if err != nil || got != want {
+			t.Errorf("parseDomain(%s) = %q, %v, want %q", args, got, err, want)
+		}
+	}
+	if _, err := parseDomain(json.RawMessage(`{}`)); err == nil {
+		t.Errorf("empty domain should be rejected")
+	}
+}
@@ -1,18 +1,29 @@
 package public
 
 import (
+	"log"
+
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/eryajf/chatgpt-dingtalk/config"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/cache"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/db"
 	"github.com/eryajf/chatgpt-dingtalk/pkg/dingbot"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/guard"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/hook"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/kb"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/moderation"
+	"github.com/eryajf/chatgpt-dingtalk/pkg/ops"
 )
 
 var UserService cache.UserServiceInterface
 var Config *config.Configuration
 var Prompt *[]config.Prompt
 var DingTalkClientManager dingbot.DingTalkClientManagerInterface
+var Moderator *moderation.Moderator
+var SecretGuard *guard.Guard
+var KnowledgeBase *kb.Store
+var Hooks *hook.Service
 
 const DingTalkClientIdKeyName = "DingTalkClientId"
 
@@ -21,6 +32,44 @@ func InitSvc() {
 	Config = config.LoadConfig()
 	// 加载prompt
 	Prompt = config.LoadPrompt()
+	// 加载敏感词库
+	var err error
+	Moderator, err = moderation.New(Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 加载敏感信息扫描器
+	if Config.SecretGuard.Enable {
+		SecretGuard, err = guard.New(Config.SecretGuard.Detectors)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// 加载知识库，向量化接口在 main 中设置
+	if Config.KnowledgeBase.Enable {
+		KnowledgeBase, err = kb.Open("data/kb", Config.KnowledgeBase.ChunkSize, Config.KnowledgeBase.ChunkOverlap)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// 运维工具的探测范围及 ASN 数据库
+	policy, err := ops.NewTargetPolicy(Config.Ops.AllowNetworks, Config.Ops.DenyNetworks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ops.SetTargetPolicy(policy)
+	if Config.Ops.ASNDB != "" {
+		asnDB, err := ops.LoadASNDB(Config.Ops.ASNDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ops.SetASNDB(asnDB)
+	}
+	// 加载外部告警接入的 Webhook，模型及发送接口在 main 中设置
+	Hooks, err = hook.New(Config.Webhook)
+	if err != nil {
+		log.Fatal(err)
+	}
 	// 初始化缓存
 	UserService = cache.NewUserService()
 	// 初始化钉钉开放平台的客户端，用于访问上传图片等能力
@@ -3,12 +3,12 @@ package public
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"os"
 	"strings"
 	"time"
-	"unicode/utf8"
 )
 
 // 将内容写入到文件，如果文件名带路径，则会判断路径是否存在，不存在则创建
@@ -158,34 +158,20 @@ func CheckRequest(ts, sg string) bool {
 	return false
 }
 
-// JudgeSensitiveWord 判断内容是否包含敏感词
-func JudgeSensitiveWord(s string) bool {
-	if len(Config.SensitiveWords) == 0 {
+// CheckAuditToken 校验审计日志查询接口的 Authorization 请求头，未配置 audit_token 时一律拒绝
+func CheckAuditToken(auth string) bool {
+	if Config.AuditToken == "" {
 		return false
 	}
-	for _, v := range Config.SensitiveWords {
-		if strings.Contains(s, v) {
-			return true
-		}
-	}
-	return false
+	return subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+Config.AuditToken)) == 1
 }
 
-// SolveSensitiveWord 将敏感词用 🚫 占位
-func SolveSensitiveWord(s string) string {
-	for _, v := range Config.SensitiveWords {
-		if strings.Contains(s, v) {
-			return strings.Replace(s, v, printStars(utf8.RuneCountInString(v)), -1)
-		}
-	}
-	return s
+// JudgeSensitiveWord 判断内容是否包含敏感词
+func JudgeSensitiveWord(s string) bool {
+	return len(Moderator.CheckLocal(s).Hits) > 0
 }
 
-// 将对应敏感词替换为 🚫
-func printStars(num int) string {
-	s := ""
-	for i := 0; i < num; i++ {
-		s += "🚫"
-	}
-	return s
+// SolveSensitiveWord 将需要打码的敏感词用 🚫 占位
+func SolveSensitiveWord(s string) string {
+	return Moderator.Mask(s)
 }
@@ -75,3 +75,28 @@ func TestCheckRequestWithCredentials_Failed_WithInvalidConfig(t *testing.T) {
 		return
 	}
 }
+
+func TestCheckAuditToken(t *testing.T) {
+	Config = &config.Configuration{AuditToken: "audit-token-for-test"}
+	tests := []struct {
+		auth string
+		want bool
+	}{
+		{"Bearer audit-token-for-test", true},
+		{"audit-token-for-test", false},
+		{"Bearer invalid-token", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := CheckAuditToken(tt.auth); got != tt.want {
+			t.Errorf("CheckAuditToken(%q) should be %v, but %v", tt.auth, tt.want, got)
+		}
+	}
+}
+
+func TestCheckAuditToken_Failed_WithEmptyConfig(t *testing.T) {
+	Config = &config.Configuration{AuditToken: ""}
+	if CheckAuditToken("Bearer ") {
+		t.Errorf("pass should be false when audit_token is not configured, but true")
+	}
+}